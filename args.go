@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Argument schemas describe the arguments of each Invoke function as a struct,
+// and are registered with the function in router.go.
+// Field order is the positional order, the json tag is the name used in
+// JSON argument mode, and the arg tag marks fields that are "required", or
+// "optional" to say they may be left off the end of the positional form.
+// Numbers are passed positionally in decimal and lists as compact JSON.
+
+type noArgs struct{}
+
+type userIdArgs struct {
+	UserId string `json:"userId" arg:"required"`
+}
+
+type spIdArgs struct {
+	SpId string `json:"spId" arg:"required"`
+}
+
+type issueIdentityArgs struct {
+	UserId       string   `json:"userId" arg:"required"`
+	PublicKey    string   `json:"publicKey"`
+	MetadataHash string   `json:"metadataHash" arg:"required"`
+	Guardians    []string `json:"guardians" arg:"optional"`
+	MajorityAt   int64    `json:"majorityAt" arg:"optional"`
+}
+
+type getIdentityArgs struct {
+	UserId string `json:"userId" arg:"required"`
+	View   string `json:"view" arg:"optional"`
+}
+
+type addServiceProviderArgs struct {
+	SpId            string   `json:"spId" arg:"required"`
+	Name            string   `json:"name" arg:"required"`
+	PublicKey       string   `json:"publicKey" arg:"required"`
+	Category        string   `json:"category" arg:"optional"`
+	AllowedScopes   []string `json:"allowedScopes" arg:"optional"`
+	ContactEndpoint string   `json:"contactEndpoint" arg:"optional"`
+	MspId           string   `json:"mspId" arg:"optional"`
+}
+
+type requestServiceProviderRegistrationArgs struct {
+	SpId            string   `json:"spId" arg:"required"`
+	Name            string   `json:"name" arg:"required"`
+	PublicKey       string   `json:"publicKey" arg:"required"`
+	Category        string   `json:"category" arg:"required"`
+	Scopes          []string `json:"scopes" arg:"required"`
+	ContactEndpoint string   `json:"contactEndpoint"`
+}
+
+type rejectServiceProviderArgs struct {
+	SpId   string `json:"spId" arg:"required"`
+	Reason string `json:"reason"`
+}
+
+type listServiceProviderRequestsArgs struct {
+	Status   string `json:"status" arg:"optional"`
+	PageSize int    `json:"pageSize" arg:"optional"`
+	Bookmark string `json:"bookmark" arg:"optional"`
+}
+
+type lookupIdentityArgs struct {
+	SpId   string   `json:"spId" arg:"required"`
+	UserId string   `json:"userId" arg:"required"`
+	Scopes []string `json:"scopes" arg:"required"`
+}
+
+type addProviderKeyArgs struct {
+	SpId         string `json:"spId" arg:"required"`
+	KeyId        string `json:"keyId" arg:"required"`
+	PublicKey    string `json:"publicKey" arg:"required"`
+	Purpose      string `json:"purpose" arg:"required"`
+	ValidFrom    int64  `json:"validFrom"`
+	ValidUntil   int64  `json:"validUntil"`
+	SigningKeyId string `json:"signingKeyId" arg:"required"`
+	Signature    string `json:"signature" arg:"required"`
+}
+
+type retireProviderKeyArgs struct {
+	SpId         string `json:"spId" arg:"required"`
+	KeyId        string `json:"keyId" arg:"required"`
+	SigningKeyId string `json:"signingKeyId" arg:"required"`
+	Signature    string `json:"signature" arg:"required"`
+}
+
+type verifyProviderMessageArgs struct {
+	SpId      string `json:"spId" arg:"required"`
+	KeyId     string `json:"keyId" arg:"required"`
+	Message   string `json:"message" arg:"required"`
+	Signature string `json:"signature" arg:"required"`
+}
+
+type rotateUserKeyArgs struct {
+	UserId    string `json:"userId" arg:"required"`
+	PublicKey string `json:"publicKey" arg:"required"`
+	SignerId  string `json:"signerId" arg:"required"`
+	Signature string `json:"signature" arg:"required"`
+}
+
+type updateUserMetadataHashArgs struct {
+	UserId       string `json:"userId" arg:"required"`
+	MetadataHash string `json:"metadataHash" arg:"required"`
+}
+
+type setUserMetadataHashArgs struct {
+	UserId       string `json:"userId" arg:"required"`
+	MetadataHash string `json:"metadataHash" arg:"required"`
+	SignerId     string `json:"signerId" arg:"required"`
+	Signature    string `json:"signature" arg:"required"`
+}
+
+type promoteDependentArgs struct {
+	UserId    string `json:"userId" arg:"required"`
+	PublicKey string `json:"publicKey" arg:"required"`
+	Signature string `json:"signature" arg:"required"`
+}
+
+type setRecoveryContactsArgs struct {
+	UserId    string   `json:"userId" arg:"required"`
+	Contacts  []string `json:"contacts" arg:"required"`
+	Threshold int      `json:"threshold" arg:"required"`
+	SignerId  string   `json:"signerId" arg:"required"`
+	Signature string   `json:"signature" arg:"required"`
+}
+
+type initiateRecoveryArgs struct {
+	UserId       string             `json:"userId" arg:"required"`
+	NewPublicKey string             `json:"newPublicKey" arg:"required"`
+	Approvals    []RecoveryApproval `json:"approvals" arg:"required"`
+}
+
+type cancelRecoveryArgs struct {
+	UserId    string `json:"userId" arg:"required"`
+	SignerId  string `json:"signerId" arg:"required"`
+	Signature string `json:"signature" arg:"required"`
+}
+
+type renewIdentityArgs struct {
+	UserId     string `json:"userId" arg:"required"`
+	ValidUntil int64  `json:"validUntil" arg:"optional"`
+}
+
+type verifyIdentityArgs struct {
+	UserId    string `json:"userId" arg:"required"`
+	Message   string `json:"message" arg:"required"`
+	Signature string `json:"signature" arg:"required"`
+}
+
+type batchIssueIdentitiesArgs struct {
+	Identities []BatchIdentity `json:"identities" arg:"required"`
+}
+
+type setMaxBatchSizeArgs struct {
+	Size int `json:"size" arg:"required"`
+}
+
+type recordPageArgs struct {
+	RecordType string `json:"recordType" arg:"required"`
+	PageSize   int    `json:"pageSize" arg:"required"`
+	Bookmark   string `json:"bookmark"`
+}
+
+type migrateArgs struct {
+	RecordType string   `json:"recordType" arg:"required"`
+	Ids        []string `json:"ids" arg:"required"`
+}
+
+type migrateKeysArgs struct {
+	RecordType string `json:"recordType" arg:"required"`
+	PageSize   int    `json:"pageSize" arg:"required"`
+}
+
+type queryIdentitiesArgs struct {
+	Query    IdentityQuery `json:"query" arg:"required"`
+	PageSize int           `json:"pageSize" arg:"required"`
+	Bookmark string        `json:"bookmark"`
+}
+
+type compactStatsArgs struct {
+	Limit    int    `json:"limit" arg:"required"`
+	Bookmark string `json:"bookmark"`
+}
+
+// FieldError reports why one named argument is invalid.
+type FieldError struct {
+	Field string `json:"field"`
+	Error string `json:"error"`
+}
+
+// jsonArgs returns the fields of args in JSON argument mode, which is a
+// single argument holding a JSON object. Any other arguments, including a
+// single argument that only looks like an object, are positional.
+func jsonArgs(args []string) (map[string]json.RawMessage, bool) {
+	if len(args) != 1 || !strings.HasPrefix(strings.TrimSpace(args[0]), "{") {
+		return nil, false
+	}
+
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal([]byte(args[0]), &fields)
+
+	return fields, err == nil
+}
+
+// normalizeArgs converts a JSON object argument into positional arguments,
+// validating it against schema. Positional arguments are validated against
+// schema and returned unchanged.
+func normalizeArgs(schema interface{}, args []string) ([]string, error) {
+	schemaType := reflect.TypeOf(schema)
+	fields, ok := jsonArgs(args)
+
+	if !ok {
+		return args, validatePositionalArgs(schemaType, args)
+	}
+
+	value := reflect.New(schemaType).Elem()
+	fieldErrors := []FieldError{}
+	known := map[string]bool{}
+
+	for i := 0; i < schemaType.NumField(); i++ {
+		field := schemaType.Field(i)
+		name := field.Tag.Get("json")
+		known[name] = true
+		raw, present := fields[name]
+
+		if !present || bytes.Equal(raw, []byte("null")) {
+			if field.Tag.Get("arg") == "required" {
+				fieldErrors = append(fieldErrors, FieldError{name, "is required"})
+			}
+
+			continue
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.DisallowUnknownFields()
+		err := decoder.Decode(value.Field(i).Addr().Interface())
+
+		if err != nil && strings.HasPrefix(err.Error(), "json: unknown field ") {
+			fieldErrors = append(fieldErrors, FieldError{name, "has an " + strings.TrimPrefix(err.Error(), "json: ")})
+		} else if err != nil {
+			fieldErrors = append(fieldErrors, FieldError{name, "must be " + describeType(field.Type)})
+		}
+	}
+
+	for name := range fields {
+		if !known[name] {
+			fieldErrors = append(fieldErrors, FieldError{name, "is not a known field"})
+		}
+	}
+
+	if len(fieldErrors) > 0 {
+		// Unknown fields come from map iteration, so sort for identical
+		// responses on every endorsing peer.
+		sort.Slice(fieldErrors, func(i, j int) bool {
+			return fieldErrors[i].Field < fieldErrors[j].Field
+		})
+
+		return nil, newInvalidArgsError(fieldErrors)
+	}
+
+	return positionalArgs(value)
+}
+
+// validatePositionalArgs checks the values of positional arguments against
+// schemaType the way JSON argument mode checks fields: required values must
+// not be empty, integers must be decimal and other non-string values JSON.
+// Empty values of optional fields are left to the handler, and so is the
+// number of arguments.
+func validatePositionalArgs(schemaType reflect.Type, args []string) error {
+	fieldErrors := []FieldError{}
+
+	for i := 0; i < len(args) && i < schemaType.NumField(); i++ {
+		field := schemaType.Field(i)
+		name := field.Tag.Get("json")
+
+		if args[i] == "" {
+			if field.Tag.Get("arg") == "required" {
+				fieldErrors = append(fieldErrors, FieldError{name, "is required"})
+			}
+
+			continue
+		}
+
+		var err error
+
+		switch field.Type.Kind() {
+		case reflect.String:
+		case reflect.Int, reflect.Int64:
+			_, err = strconv.ParseInt(args[i], 10, 64)
+		default:
+			decoder := json.NewDecoder(strings.NewReader(args[i]))
+			decoder.DisallowUnknownFields()
+			err = decoder.Decode(reflect.New(field.Type).Interface())
+		}
+
+		if err != nil && strings.HasPrefix(err.Error(), "json: unknown field ") {
+			fieldErrors = append(fieldErrors, FieldError{name, "has an " + strings.TrimPrefix(err.Error(), "json: ")})
+		} else if err != nil {
+			fieldErrors = append(fieldErrors, FieldError{name, "must be " + describeType(field.Type)})
+		}
+	}
+
+	if len(fieldErrors) > 0 {
+		return newInvalidArgsError(fieldErrors)
+	}
+
+	return nil
+}
+
+// positionalArgs renders a schema struct as positional arguments. Integers
+// that may be left empty are rendered empty when zero, as positional callers
+// send them, so that both forms sign the same arguments. Trailing optional
+// fields are dropped when all of them are zero.
+func positionalArgs(value reflect.Value) ([]string, error) {
+	schemaType := value.Type()
+	positional := make([]string, schemaType.NumField())
+
+	for i := range positional {
+		switch field := value.Field(i); field.Kind() {
+		case reflect.String:
+			positional[i] = field.String()
+		case reflect.Int, reflect.Int64:
+			if field.Int() != 0 || schemaType.Field(i).Tag.Get("arg") == "required" {
+				positional[i] = strconv.FormatInt(field.Int(), 10)
+			}
+		default:
+			encoded, err := json.Marshal(field.Interface())
+
+			if err != nil {
+				return nil, err
+			}
+
+			positional[i] = string(encoded)
+		}
+	}
+
+	end := len(positional)
+	trim := true
+
+	for end > 0 && schemaType.Field(end-1).Tag.Get("arg") == "optional" {
+		end--
+		trim = trim && isZero(value.Field(end))
+	}
+
+	if trim {
+		return positional[:end], nil
+	}
+
+	return positional, nil
+}
+
+func isZero(value reflect.Value) bool {
+	return reflect.DeepEqual(value.Interface(), reflect.Zero(value.Type()).Interface())
+}
+
+func describeType(fieldType reflect.Type) string {
+	switch fieldType.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Int, reflect.Int64:
+		return "an integer"
+	case reflect.Slice:
+		if fieldType.Elem().Kind() == reflect.String {
+			return "an array of strings"
+		}
+
+		return "an array of objects"
+	}
+
+	return "a " + fieldType.Kind().String()
+}
+
+func newInvalidArgsError(fieldErrors []FieldError) error {
+	return &ChaincodeError{Code: codeInvalidArgument, Message: "Invalid arguments", Details: fieldErrors}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeArgs(t *testing.T) {
+	tests := []struct {
+		schema   interface{}
+		args     []string
+		expected []string
+		details  string
+	}{
+		// JSON argument mode.
+		{getIdentityArgs{}, []string{`{"userId":"alice"}`}, []string{"alice"}, ""},
+		{renewIdentityArgs{}, []string{`{"userId":"alice","validUntil":4102444800}`}, []string{"alice", "4102444800"}, ""},
+		{issueIdentityArgs{}, []string{`{"publicKey":7,"extra":true}`}, nil, "[{extra is not a known field} {metadataHash is required} {publicKey must be a string} {userId is required}]"},
+		// A single argument that is not a JSON object is positional.
+		{getIdentityArgs{}, []string{"{alice"}, []string{"{alice"}, ""},
+		{getIdentityArgs{}, []string{`{"userId":`}, []string{`{"userId":`}, ""},
+		// Positional arguments are checked against the same schema.
+		{renewIdentityArgs{}, []string{"alice", ""}, []string{"alice", ""}, ""},
+		{renewIdentityArgs{}, []string{"alice", "soon"}, nil, "[{validUntil must be an integer}]"},
+		{issueIdentityArgs{}, []string{"", "", "hash", `["bob"]`, "4102444800"}, nil, "[{userId is required}]"},
+		{migrateArgs{}, []string{"user", "user0"}, nil, "[{ids must be an array of strings}]"},
+		{queryIdentitiesArgs{}, []string{`{"name":"Erin"}`, "10", ""}, nil, `[{query has an unknown field "name"}]`},
+		// The number of positional arguments is left to the handler.
+		{getIdentityArgs{}, []string{"alice", "status", "extra"}, []string{"alice", "status", "extra"}, ""},
+	}
+
+	for _, test := range tests {
+		args, err := normalizeArgs(test.schema, test.args)
+
+		if test.details == "" {
+			if err != nil || !reflect.DeepEqual(args, test.expected) {
+				t.Errorf("%T %q: expected %q, got %q: %v", test.schema, test.args, test.expected, args, err)
+			}
+
+			continue
+		}
+
+		chaincodeError, ok := err.(*ChaincodeError)
+
+		if !ok || chaincodeError.Code != codeInvalidArgument || fmt.Sprint(chaincodeError.Details) != test.details {
+			t.Errorf("%T %q: expected details %s, got %v", test.schema, test.args, test.details, err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	defaultMaxBatchSize = 100
+
+	// batchSizeLimit bounds setMaxBatchSize so that a single transaction's
+	// read/write set stays within what the orderer accepts.
+	batchSizeLimit = 1000
+)
+
+// BatchIdentity is one entry of a batchIssueIdentities call. Guardians and
+// MajorityAt are only set for dependents.
+type BatchIdentity struct {
+	UserId       string   `json:"userId"`
+	PublicKey    string   `json:"publicKey"`
+	MetadataHash string   `json:"metadataHash"`
+	Guardians    []string `json:"guardians,omitempty"`
+	MajorityAt   int64    `json:"majorityAt,omitempty"`
+}
+
+// BatchEntryError describes why one entry of a rejected batch is invalid.
+type BatchEntryError struct {
+	Index  int    `json:"index"`
+	UserId string `json:"userId"`
+	Error  string `json:"error"`
+}
+
+// batchIssueIdentities issues every identity in a JSON array of
+// BatchIdentity, or none of them. A rejected batch lists the error of each
+// invalid entry in the details of the error.
+func (t *IdentityChaincode) batchIssueIdentities(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return incorrectArgumentCount()
+	}
+
+	var entries []BatchIdentity
+	err := json.Unmarshal([]byte(args[0]), &entries)
+
+	if err != nil {
+		return invalidArgument("Expected a JSON array of identities")
+	}
+
+	if len(entries) == 0 {
+		return invalidArgument("Batch is empty")
+	}
+
+	maxBatchSize, err := getMaxBatchSize(stub)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if len(entries) > maxBatchSize {
+		return invalidArgument("Batch exceeds the maximum size of " + strconv.Itoa(maxBatchSize))
+	}
+
+	batch := map[string]*User{}
+	entryErrors := []BatchEntryError{}
+
+	for i, entry := range entries {
+		if _, ok := batch[entry.UserId]; ok {
+			entryErrors = append(entryErrors, BatchEntryError{i, entry.UserId, "Duplicate user ID in batch"})
+			continue
+		}
+
+		user, err := newUserRecord(stub, entry.UserId, entry.PublicKey, entry.MetadataHash, entry.Guardians, entry.MajorityAt, batch)
+
+		if err != nil {
+			entryErrors = append(entryErrors, BatchEntryError{i, entry.UserId, err.Error()})
+			continue
+		}
+
+		batch[entry.UserId] = user
+	}
+
+	if len(entryErrors) > 0 {
+		return errorResponse(&ChaincodeError{Code: codeInvalidArgument, Message: "Batch rejected", Details: entryErrors})
+	}
+
+	deltas := statDeltas{}
+
+	for _, entry := range entries {
+		err = storeUser(stub, entry.UserId, batch[entry.UserId])
+
+		if err != nil {
+			return errorResponse(err)
+		}
+
+		deltas.addIdentity(batch[entry.UserId])
+	}
+
+	err = deltas.write(stub)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(nil)
+}
+
+// setMaxBatchSize changes how many identities batchIssueIdentities accepts.
+func (t *IdentityChaincode) setMaxBatchSize(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return incorrectArgumentCount()
+	}
+
+	size, err := strconv.Atoi(args[0])
+
+	if err != nil || size < 1 || size > batchSizeLimit {
+		return invalidArgument("Batch size must be between 1 and " + strconv.Itoa(batchSizeLimit))
+	}
+
+	err = stub.PutState("maxBatchSize", []byte(strconv.Itoa(size)))
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(nil)
+}
+
+func getMaxBatchSize(stub shim.ChaincodeStubInterface) (int, error) {
+	size, err := stub.GetState("maxBatchSize")
+
+	if err != nil {
+		return 0, err
+	}
+
+	if size == nil {
+		return defaultMaxBatchSize, nil
+	}
+
+	return strconv.Atoi(string(size))
+}
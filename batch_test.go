@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestBatchIssueIdentitiesReportsEachInvalidEntry(t *testing.T) {
+	stub := newTestStub(t)
+	expectStatus(t, stub.Invoke("issueIdentity", "alice", newTestPublicKey(t), "h"), shim.OK)
+	majorityAt := stub.Now().Add(24 * time.Hour).Unix()
+
+	entries := []BatchIdentity{
+		{UserId: "erin", PublicKey: newTestPublicKey(t), MetadataHash: "h1"},
+		// Erin is a guardian issued earlier in the same batch.
+		{UserId: "fay", MetadataHash: "h2", Guardians: []string{"erin", "alice"}, MajorityAt: majorityAt},
+		{UserId: "erin", PublicKey: newTestPublicKey(t), MetadataHash: "h3"},
+		{UserId: "alice", PublicKey: newTestPublicKey(t), MetadataHash: "h4"},
+		{UserId: "gus", MetadataHash: "h5", Guardians: []string{"fay"}, MajorityAt: majorityAt},
+		{UserId: "hal", MetadataHash: "h6", Guardians: []string{"nobody"}, MajorityAt: majorityAt},
+		{UserId: "ivy", MetadataHash: "h7", Guardians: []string{"alice"}, MajorityAt: stub.Now().Add(-time.Hour).Unix()},
+		{UserId: "jon", MetadataHash: "h8"},
+		{UserId: "", PublicKey: newTestPublicKey(t)},
+	}
+
+	batch, err := json.Marshal(entries)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response := stub.Invoke("batchIssueIdentities", string(batch))
+	expectError(t, response, codeInvalidArgument)
+
+	var rejection struct {
+		Message string            `json:"message"`
+		Details []BatchEntryError `json:"details"`
+	}
+
+	err = json.Unmarshal(response.Payload, &rejection)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []BatchEntryError{
+		{2, "erin", "Duplicate user ID in batch"},
+		{3, "alice", "User already exists"},
+		{4, "gus", "Guardian is a dependent: fay"},
+		{5, "hal", "Guardian not found: nobody"},
+		{6, "ivy", "Majority time must be in the future"},
+		{7, "jon", "Public key is required"},
+		{8, "", "User ID is required"},
+	}
+
+	if rejection.Message != "Batch rejected" || !reflect.DeepEqual(rejection.Details, expected) {
+		t.Fatalf("unexpected rejection %+v", rejection)
+	}
+
+	// A rejected batch issues none of its entries, not even the valid ones.
+	expectError(t, stub.Invoke("getIdentity", "erin"), codeNotFound)
+
+	batch, err = json.Marshal(entries[:2])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectStatus(t, stub.Invoke("batchIssueIdentities", string(batch)), shim.OK)
+	response = stub.Invoke("getIdentity", "fay")
+	expectStatus(t, response, shim.OK)
+
+	var fay User
+	err = json.Unmarshal(response.Payload, &fay)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(fay.Guardians, []string{"erin", "alice"}) || fay.MajorityAt != majorityAt {
+		t.Fatalf("unexpected dependent %+v", fay)
+	}
+
+	expectStatus(t, stub.Invoke("getIdentity", "erin"), shim.OK)
+}
+
+func TestBatchIssueIdentitiesHonoursMaxBatchSize(t *testing.T) {
+	stub := newTestStub(t)
+	batch, err := json.Marshal([]BatchIdentity{
+		{UserId: "alice", PublicKey: newTestPublicKey(t), MetadataHash: "h1"},
+		{UserId: "bob", PublicKey: newTestPublicKey(t), MetadataHash: "h2"},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectError(t, stub.Invoke("setMaxBatchSize", "0"), codeInvalidArgument)
+	expectStatus(t, stub.Invoke("setMaxBatchSize", "1"), shim.OK)
+	expectError(t, stub.Invoke("batchIssueIdentities", string(batch)), codeInvalidArgument)
+
+	stub.SetCreator(testOtherMspId)
+	expectError(t, stub.Invoke("setMaxBatchSize", "2"), codeUnauthorized)
+	expectError(t, stub.Invoke("batchIssueIdentities", string(batch)), codeUnauthorized)
+
+	stub.SetCreator(testAuthorityMspId)
+	expectStatus(t, stub.Invoke("setMaxBatchSize", "2"), shim.OK)
+	expectStatus(t, stub.Invoke("batchIssueIdentities", string(batch)), shim.OK)
+}
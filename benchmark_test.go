@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+
+	"github.com/mars-identity-chaincode/teststub"
+)
+
+// The benchmarks run against a colony of benchmarkColonySize users, loaded
+// straight into the state rather than issued, so that building it takes
+// seconds. Colonists are issued over a year, and one in a thousand is a medic.
+const (
+	benchmarkColonySize = 1000000
+	benchmarkMedicEvery = 1000
+)
+
+var benchmarkEpoch = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var (
+	colonyOnce  sync.Once
+	colonyState map[string][]byte
+)
+
+func colonistId(i int) string {
+	return fmt.Sprintf("colonist-%07d", i)
+}
+
+// colonistPublicKey returns a distinct value shaped like a compressed public
+// key. Generating a million real keys would dominate the setup, and the
+// benchmarked functions do not parse user keys.
+func colonistPublicKey(i int) string {
+	return fmt.Sprintf("02%064x", i)
+}
+
+// loadColony returns the colony's state, building it on first use.
+func loadColony(b *testing.B) map[string][]byte {
+	colonyOnce.Do(func() {
+		stub := teststub.New("identity", new(IdentityChaincode))
+		colonyState = make(map[string][]byte, benchmarkColonySize)
+
+		for i := 0; i < benchmarkColonySize; i++ {
+			issuedAt := benchmarkEpoch.Add(time.Duration(i%365) * 24 * time.Hour).Unix()
+			user := User{
+				PublicKey:    colonistPublicKey(i),
+				MetadataHash: fmt.Sprintf("%064x", i),
+				Permissions:  []string{"habitat"},
+				Status:       statusActive,
+				IssuedAt:     issuedAt,
+				ValidUntil:   defaultValidUntil(issuedAt),
+				DocType:      userDocType,
+				Version:      userSchemaVersion,
+			}
+
+			if i%benchmarkMedicEvery == 0 {
+				user.Permissions = append(user.Permissions, "medic")
+			}
+
+			key, err := stub.CreateCompositeKey(userObjectType, []string{colonistId(i)})
+
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			colonyState[key], err = json.Marshal(user)
+
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	return colonyState
+}
+
+// newColonyStub returns a stub holding the colony and a clinic registered by
+// the identity authority, which is the creator of the following transactions.
+func newColonyStub(b *testing.B) *teststub.Stub {
+	colony := loadColony(b)
+	stub := teststub.New("identity", new(IdentityChaincode))
+	stub.SetTime(benchmarkEpoch.AddDate(1, 0, 0))
+	stub.SetCreator(testAuthorityMspId)
+	expectStatus(b, stub.Init(), shim.OK)
+	stub.Load(colony)
+	expectStatus(b, stub.Invoke("addServiceProvider", "clinic", "Clinic", newTestPublicKey(b), "healthcare", `["publicKey","permissions"]`, "", testHealthMspId), shim.OK)
+
+	return stub
+}
+
+// runBenchmark endorses the transaction returned by args for each iteration,
+// which is given the response of the previous one. Besides time and
+// allocations, it reports the average size of the endorsements: the keys
+// read, including those of range reads, the keys written, and the bytes of
+// the written values and of the response.
+func runBenchmark(b *testing.B, stub *teststub.Stub, args func(i int, previous pb.Response) []string) {
+	var reads, writes, writeBytes, responseBytes int
+	var previous pb.Response
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		txArgs := args(i, previous)
+		endorsement := stub.Endorse(txArgs...)
+		previous = endorsement.Response
+
+		if previous.Status != shim.OK {
+			b.Fatalf("%v failed: %s", txArgs, previous.Message)
+		}
+
+		reads += len(endorsement.Reads)
+		writes += len(endorsement.Writes)
+		responseBytes += len(previous.Payload)
+
+		for _, write := range endorsement.Writes {
+			writeBytes += len(write.Key) + len(write.Value)
+		}
+	}
+
+	b.StopTimer()
+	b.ReportMetric(float64(reads)/float64(b.N), "reads/op")
+	b.ReportMetric(float64(writes)/float64(b.N), "writes/op")
+	b.ReportMetric(float64(writeBytes)/float64(b.N), "write-B/op")
+	b.ReportMetric(float64(responseBytes)/float64(b.N), "response-B/op")
+}
+
+// spreadColonist picks colonists far apart, so that successive iterations do
+// not read neighbouring keys.
+func spreadColonist(i int) string {
+	return colonistId(i * 7919 % benchmarkColonySize)
+}
+
+func BenchmarkIssueIdentity(b *testing.B) {
+	stub := newColonyStub(b)
+
+	runBenchmark(b, stub, func(i int, _ pb.Response) []string {
+		return []string{"issueIdentity", fmt.Sprintf("newcomer-%07d", i), colonistPublicKey(benchmarkColonySize + i), "hash"}
+	})
+}
+
+func BenchmarkGetIdentity(b *testing.B) {
+	stub := newColonyStub(b)
+
+	for _, view := range []string{"full", "status"} {
+		b.Run(view, func(b *testing.B) {
+			runBenchmark(b, stub, func(i int, _ pb.Response) []string {
+				return []string{"getIdentity", spreadColonist(i), view}
+			})
+		})
+	}
+}
+
+func BenchmarkLookupIdentity(b *testing.B) {
+	stub := newColonyStub(b)
+	stub.SetCreator(testHealthMspId)
+
+	runBenchmark(b, stub, func(i int, _ pb.Response) []string {
+		return []string{"lookupIdentity", "clinic", spreadColonist(i), `["publicKey","permissions"]`}
+	})
+}
+
+// BenchmarkQueryIdentities pages through the medics with queryIdentities. On
+// a peer the query is served by a CouchDB index, but the stub evaluates the
+// selector against every record, so its time and allocations measure the
+// stub's scan, not the chaincode. Its response size is still meaningful.
+func BenchmarkQueryIdentities(b *testing.B) {
+	stub := newColonyStub(b)
+
+	runBenchmark(b, stub, func(i int, previous pb.Response) []string {
+		return []string{"queryIdentities", `{"recordType":"user","status":"active","permission":"medic"}`, "100", nextBookmark(b, previous)}
+	})
+}
+
+// BenchmarkExportRecords pages through the users with exportRecords,
+// starting over after the last page.
+func BenchmarkExportRecords(b *testing.B) {
+	stub := newColonyStub(b)
+
+	for _, pageSize := range []string{"100", "1000"} {
+		b.Run("pageSize="+pageSize, func(b *testing.B) {
+			runBenchmark(b, stub, func(i int, previous pb.Response) []string {
+				return []string{"exportRecords", "user", pageSize, nextBookmark(b, previous)}
+			})
+		})
+	}
+}
+
+// nextBookmark returns the bookmark of the page in previous, or none for the
+// first iteration. The page is decoded with the timer stopped, since clients
+// pay for it, not the peer.
+func nextBookmark(b *testing.B, previous pb.Response) string {
+	if previous.Payload == nil {
+		return ""
+	}
+
+	b.StopTimer()
+	defer b.StartTimer()
+
+	var page struct {
+		Bookmark string `json:"bookmark"`
+	}
+
+	err := json.Unmarshal(previous.Payload, &page)
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return page.Bookmark
+}
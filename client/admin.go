@@ -0,0 +1,150 @@
+package client
+
+import "strconv"
+
+// Record types of exportRecords and the migration functions. Migrations also
+// cover registration requests and pending recoveries.
+const (
+	RecordUser            = "user"
+	RecordServiceProvider = "sp"
+	RecordRequest         = "sprequest"
+	RecordRecovery        = "recovery"
+)
+
+// PageRequest asks for a page of up to PageSize records of RecordType,
+// starting at the Bookmark of the previous page.
+type PageRequest struct {
+	RecordType string `json:"recordType"`
+	PageSize   int    `json:"pageSize"`
+	Bookmark   string `json:"bookmark"`
+}
+
+// QueryIdentitiesRequest asks for a page of up to PageSize records matching
+// Query, starting at the Bookmark of the previous page.
+type QueryIdentitiesRequest struct {
+	Query    IdentityQuery `json:"query"`
+	PageSize int           `json:"pageSize"`
+	Bookmark string        `json:"bookmark"`
+}
+
+func (r QueryIdentitiesRequest) Call() Call {
+	return Call{Function: "queryIdentities", Args: []string{formatJson(r.Query), strconv.Itoa(r.PageSize), r.Bookmark}, ReadOnly: true}
+}
+
+// GetCreatorIdentity returns the MSP ID of the identity authority.
+func (c *Client) GetCreatorIdentity() (string, error) {
+	payload, err := c.send(Call{Function: "getCreatorIdentity", ReadOnly: true})
+
+	return string(payload), err
+}
+
+// GetMetadata describes every function of the chaincode, its arguments and
+// who may call it.
+func (c *Client) GetMetadata() (*ContractMetadata, error) {
+	var metadata ContractMetadata
+	err := c.Do(Call{Function: "getMetadata", ReadOnly: true}, &metadata)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &metadata, nil
+}
+
+// SetMaxBatchSize changes how many identities BatchIssueIdentities accepts.
+// Only the identity authority may call it.
+func (c *Client) SetMaxBatchSize(size int) error {
+	return c.Do(Call{Function: "setMaxBatchSize", Args: []string{strconv.Itoa(size)}}, nil)
+}
+
+// ExportRecords returns a page of raw user or service provider records.
+// Only the identity authority may call it.
+func (c *Client) ExportRecords(request PageRequest) (*ExportPage, error) {
+	var page ExportPage
+	err := c.Do(Call{Function: "exportRecords", Args: []string{request.RecordType, strconv.Itoa(request.PageSize), request.Bookmark}, ReadOnly: true}, &page)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &page, nil
+}
+
+// ListPendingMigrations returns the IDs of the records below the current
+// schema version among a page of records, to pass to Migrate. Only the
+// identity authority may call it.
+func (c *Client) ListPendingMigrations(request PageRequest) (*PendingMigrationPage, error) {
+	var page PendingMigrationPage
+	err := c.Do(Call{Function: "listPendingMigrations", Args: []string{request.RecordType, strconv.Itoa(request.PageSize), request.Bookmark}, ReadOnly: true}, &page)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &page, nil
+}
+
+// Migrate rewrites the records of recordType with the given IDs in the
+// current schema version. Only the identity authority may call it.
+func (c *Client) Migrate(recordType string, ids []string) (*MigrationPage, error) {
+	var page MigrationPage
+	err := c.Do(Call{Function: "migrate", Args: []string{recordType, formatJson(ids)}}, &page)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &page, nil
+}
+
+// MigrateKeys moves up to pageSize records of recordType from legacy keys to
+// composite keys. Only the identity authority may call it.
+func (c *Client) MigrateKeys(recordType string, pageSize int) (*MigrationPage, error) {
+	var page MigrationPage
+	err := c.Do(Call{Function: "migrateKeys", Args: []string{recordType, strconv.Itoa(pageSize)}}, &page)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &page, nil
+}
+
+// QueryIdentities returns a page of the users or service providers matching
+// a query.
+func (c *Client) QueryIdentities(request QueryIdentitiesRequest) (*QueryPage, error) {
+	var page QueryPage
+	err := c.Do(request.Call(), &page)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &page, nil
+}
+
+// GetRegistryStats returns the registry counters.
+func (c *Client) GetRegistryStats() (*RegistryStats, error) {
+	var stats RegistryStats
+	err := c.Do(Call{Function: "getRegistryStats", ReadOnly: true}, &stats)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+// CompactStats merges the registry counter deltas among up to limit delta
+// keys, starting at the bookmark of the previous call. Only the identity
+// authority may call it.
+func (c *Client) CompactStats(limit int, bookmark string) (*StatsCompaction, error) {
+	var compaction StatsCompaction
+	err := c.Do(Call{Function: "compactStats", Args: []string{strconv.Itoa(limit), bookmark}}, &compaction)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &compaction, nil
+}
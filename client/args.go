@@ -0,0 +1,64 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+
+	"github.com/decred/dcrd/dcrec/secp256k1"
+)
+
+// Positional arguments are strings. Numbers are written in decimal, lists as
+// compact JSON, and timestamps that default to zero as an empty string.
+
+func formatInt(value int64) string {
+	return strconv.FormatInt(value, 10)
+}
+
+func formatTimestamp(value int64) string {
+	if value == 0 {
+		return ""
+	}
+
+	return formatInt(value)
+}
+
+func formatList(list []string) string {
+	if list == nil {
+		list = []string{}
+	}
+
+	return formatJson(list)
+}
+
+func formatJson(value interface{}) string {
+	encoded, _ := json.Marshal(value)
+
+	return string(encoded)
+}
+
+// SignedMessage builds the canonical message a key holder signs to authorize
+// function with the given arguments, as the chaincode does.
+func SignedMessage(function string, args ...string) string {
+	return formatJson(append([]string{function}, args...))
+}
+
+// SignMessage signs message with key the way the chaincode verifies
+// signatures: a hex encoded DER signature over the SHA-256 hash of message.
+func SignMessage(key *secp256k1.PrivateKey, message string) (string, error) {
+	hash := sha256.Sum256([]byte(message))
+	signature, err := key.Sign(hash[:])
+
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(signature.Serialize()), nil
+}
+
+// PublicKey returns the hex encoded compressed public key of key, as users
+// and service providers register it.
+func PublicKey(key *secp256k1.PrivateKey) string {
+	return hex.EncodeToString(key.PubKey().SerializeCompressed())
+}
@@ -0,0 +1,110 @@
+// Package client calls the identity chaincode with typed requests and
+// responses.
+//
+// Each function of the chaincode has a request struct whose Call method
+// builds the positional arguments, and a method on Client that sends it and
+// decodes the result. Calls travel over a Transport, which submits or
+// evaluates a ChaincodeInput. The transports of package clienttest run the
+// chaincode in process on the test stub, so code built on the client can be
+// tested without a Fabric network.
+//
+// Failed calls return an *Error holding the chaincode's error code.
+package client
+
+import (
+	"encoding/json"
+
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Transport delivers calls to the chaincode. Submit endorses a transaction
+// and orders it, returning once it is committed. Evaluate runs a read-only
+// function on a single peer without ordering it. Both return the chaincode's
+// response, and an error only when the call could not be delivered or, for
+// Submit, was not committed.
+type Transport interface {
+	Submit(input *pb.ChaincodeInput, transient map[string][]byte) (pb.Response, error)
+	Evaluate(input *pb.ChaincodeInput, transient map[string][]byte) (pb.Response, error)
+}
+
+// Call is one call of a chaincode function with positional arguments.
+// ReadOnly calls are evaluated rather than submitted.
+type Call struct {
+	Function  string
+	Args      []string
+	ReadOnly  bool
+	Transient map[string][]byte
+}
+
+// ChaincodeInput returns the input of the chaincode invocation spec for call.
+func (call Call) ChaincodeInput() *pb.ChaincodeInput {
+	args := make([][]byte, 0, len(call.Args)+1)
+	args = append(args, []byte(call.Function))
+
+	for _, arg := range call.Args {
+		args = append(args, []byte(arg))
+	}
+
+	return &pb.ChaincodeInput{Args: args}
+}
+
+// Client calls the identity chaincode over a transport.
+type Client struct {
+	transport Transport
+	transient map[string][]byte
+}
+
+// New returns a client that calls the chaincode over transport.
+func New(transport Transport) *Client {
+	return &Client{transport: transport}
+}
+
+// WithTransient returns a client that passes transient with every call
+// that does not carry transient data of its own. Transient data reaches the
+// chaincode but is not recorded on the ledger.
+func (c *Client) WithTransient(transient map[string][]byte) *Client {
+	return &Client{transport: c.transport, transient: transient}
+}
+
+// Do sends call and, if result is not nil, decodes the response payload
+// into it.
+func (c *Client) Do(call Call, result interface{}) error {
+	payload, err := c.send(call)
+
+	if err != nil || result == nil {
+		return err
+	}
+
+	return json.Unmarshal(payload, result)
+}
+
+// send sends call and returns the payload of its response.
+func (c *Client) send(call Call) ([]byte, error) {
+	transient := call.Transient
+
+	if transient == nil {
+		transient = c.transient
+	}
+
+	var response pb.Response
+	var err error
+
+	if call.ReadOnly {
+		response, err = c.transport.Evaluate(call.ChaincodeInput(), transient)
+	} else {
+		response, err = c.transport.Submit(call.ChaincodeInput(), transient)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Status >= errorThreshold {
+		return nil, responseError(response)
+	}
+
+	return response.Payload, nil
+}
+
+// errorThreshold is the lowest status of an error response.
+const errorThreshold = 400
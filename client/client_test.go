@@ -0,0 +1,113 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// recordingTransport records the calls it is given and answers with response.
+type recordingTransport struct {
+	response  pb.Response
+	submitted bool
+	args      []string
+	transient map[string][]byte
+}
+
+func (transport *recordingTransport) Submit(input *pb.ChaincodeInput, transient map[string][]byte) (pb.Response, error) {
+	transport.submitted = true
+
+	return transport.Evaluate(input, transient)
+}
+
+func (transport *recordingTransport) Evaluate(input *pb.ChaincodeInput, transient map[string][]byte) (pb.Response, error) {
+	transport.args = make([]string, len(input.Args))
+	transport.transient = transient
+
+	for i, arg := range input.Args {
+		transport.args[i] = string(arg)
+	}
+
+	return transport.response, nil
+}
+
+func TestCallArguments(t *testing.T) {
+	tests := []struct {
+		call     Call
+		expected []string
+	}{
+		{IssueIdentityRequest{UserId: "alice", PublicKey: "02ab", MetadataHash: "h"}.Call(), []string{"issueIdentity", "alice", "02ab", "h"}},
+		{IssueIdentityRequest{UserId: "bobby", MetadataHash: "h", Guardians: []string{"alice"}, MajorityAt: 4102444800}.Call(), []string{"issueIdentity", "bobby", "", "h", `["alice"]`, "4102444800"}},
+		{AddServiceProviderRequest{SpId: "bank", Name: "Bank", PublicKey: "02ab", Category: "finance", MspId: "BankMSP"}.Call(), []string{"addServiceProvider", "bank", "Bank", "02ab", "finance", "[]", "", "BankMSP"}},
+		{AddProviderKeyRequest{SpId: "bank", KeyId: "k2", PublicKey: "02cd", Purpose: "signing", ValidUntil: 10, SigningKeyId: "primary", Signature: "sig"}.Call(), []string{"addProviderKey", "bank", "k2", "02cd", "signing", "", "10", "primary", "sig"}},
+		{InitiateRecoveryRequest{UserId: "alice", NewPublicKey: "02ef", Approvals: []RecoveryApproval{{"carol", "sig"}}}.Call(), []string{"initiateRecovery", "alice", "02ef", `[{"contactId":"carol","signature":"sig"}]`}},
+		{QueryIdentitiesRequest{Query: IdentityQuery{RecordType: "user", Status: StatusActive}, PageSize: 10}.Call(), []string{"queryIdentities", `{"recordType":"user","status":"active"}`, "10", ""}},
+	}
+
+	for _, test := range tests {
+		transport := &recordingTransport{response: shim.Success(nil)}
+		err := New(transport).Do(test.call, nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(transport.args, test.expected) || transport.submitted == test.call.ReadOnly {
+			t.Fatalf("expected %q, got %q", test.expected, transport.args)
+		}
+	}
+}
+
+func TestSignedMessagesMatchArguments(t *testing.T) {
+	request := AddProviderKeyRequest{SpId: "bank", KeyId: "k2", PublicKey: "02cd", Purpose: "signing", SigningKeyId: "primary"}
+
+	if message := request.SignedMessage(); message != `["addProviderKey","bank","k2","02cd","signing","","","primary"]` {
+		t.Fatalf("unexpected message %s", message)
+	}
+
+	contacts := SetRecoveryContactsRequest{UserId: "alice", Threshold: 0, SignerId: "alice"}
+
+	if message := contacts.SignedMessage(3); message != `["setRecoveryContacts","alice","[]","0","alice","3"]` {
+		t.Fatalf("unexpected message %s", message)
+	}
+}
+
+func TestTransient(t *testing.T) {
+	transport := &recordingTransport{response: shim.Success(nil)}
+	client := New(transport).WithTransient(map[string][]byte{"a": []byte("1")})
+
+	if client.CompleteRecovery("alice") != nil || string(transport.transient["a"]) != "1" {
+		t.Fatalf("expected the client's transient data, got %v", transport.transient)
+	}
+
+	own := map[string][]byte{"b": []byte("2")}
+
+	if client.Do(Call{Function: "completeRecovery", Args: []string{"alice"}, Transient: own}, nil) != nil || transport.transient["a"] != nil {
+		t.Fatalf("expected the call's transient data, got %v", transport.transient)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	payload := []byte(`{"code":"INVALID_ARGUMENT","message":"Invalid arguments","details":[{"field":"userId","error":"is required"}]}`)
+	transport := &recordingTransport{response: pb.Response{Status: 400, Message: string(payload), Payload: payload}}
+	_, err := New(transport).GetIdentity("")
+
+	chaincodeError, ok := err.(*Error)
+
+	if !ok || chaincodeError.Status != 400 || ErrorCode(err) != CodeInvalidArgument {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if fieldErrors := chaincodeError.FieldErrors(); len(fieldErrors) != 1 || fieldErrors[0].Field != "userId" || chaincodeError.BatchErrors() != nil {
+		t.Fatalf("unexpected details %s", chaincodeError.Details)
+	}
+
+	transport.response = shim.Error("chaincode crashed")
+	_, err = New(transport).GetIdentity("alice")
+
+	if ErrorCode(err) != CodeInternal || err.(*Error).Message != "chaincode crashed" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+// Package clienttest provides client transports that run the identity
+// chaincode in process on the test stub, so code built on the client can be
+// tested without a Fabric network.
+package clienttest
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+
+	"github.com/mars-identity-chaincode/teststub"
+)
+
+// StubTransport runs calls on a test stub, as the stub's current creator.
+// Submitted calls are committed at once, and evaluated calls leave no trace.
+type StubTransport struct {
+	Stub *teststub.Stub
+}
+
+func (transport StubTransport) Submit(input *pb.ChaincodeInput, transient map[string][]byte) (pb.Response, error) {
+	transport.Stub.SetTransient(transient)
+
+	return transport.Stub.Invoke(inputArgs(input)...), nil
+}
+
+func (transport StubTransport) Evaluate(input *pb.ChaincodeInput, transient map[string][]byte) (pb.Response, error) {
+	transport.Stub.SetTransient(transient)
+
+	return transport.Stub.Simulate(inputArgs(input)...), nil
+}
+
+// NetworkTransport runs calls on a simulated network as a member MSP. Each
+// submitted call is cut into a block of its own, and a call whose
+// transaction is invalidated returns an error.
+type NetworkTransport struct {
+	Network *teststub.Network
+	MspId   string
+}
+
+func (transport NetworkTransport) Submit(input *pb.ChaincodeInput, transient map[string][]byte) (pb.Response, error) {
+	transport.Network.Stub.SetTransient(transient)
+	tx := transport.Network.Invoke(transport.MspId, inputArgs(input)...)
+
+	if tx.Response().Status < shim.ERRORTHRESHOLD && !tx.Valid() {
+		return tx.Response(), fmt.Errorf("transaction %s was invalidated: %s", tx.TxId, tx.ValidationCode)
+	}
+
+	return tx.Response(), nil
+}
+
+func (transport NetworkTransport) Evaluate(input *pb.ChaincodeInput, transient map[string][]byte) (pb.Response, error) {
+	transport.Network.Stub.SetTransient(transient)
+
+	return transport.Network.Query(transport.MspId, inputArgs(input)...), nil
+}
+
+func inputArgs(input *pb.ChaincodeInput) []string {
+	args := make([]string, len(input.Args))
+
+	for i, arg := range input.Args {
+		args[i] = string(arg)
+	}
+
+	return args
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Error codes of the chaincode. The status of an error response follows its
+// code, as listed by the getMetadata function.
+const (
+	CodeInvalidArgument    = "INVALID_ARGUMENT"
+	CodeUnauthorized       = "UNAUTHORIZED"
+	CodeNotFound           = "NOT_FOUND"
+	CodeAlreadyExists      = "ALREADY_EXISTS"
+	CodeFailedPrecondition = "FAILED_PRECONDITION"
+	CodeInternal           = "INTERNAL"
+)
+
+// Error is an error response of the chaincode. Details hold the raw details
+// of errors that carry more than a message; see FieldErrors and BatchErrors.
+type Error struct {
+	Status  int32           `json:"-"`
+	Code    string          `json:"code"`
+	Message string          `json:"message"`
+	Details json.RawMessage `json:"details,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// FieldError reports why one named argument is invalid.
+type FieldError struct {
+	Field string `json:"field"`
+	Error string `json:"error"`
+}
+
+// BatchEntryError reports why one entry of a rejected batch is invalid.
+type BatchEntryError struct {
+	Index  int    `json:"index"`
+	UserId string `json:"userId"`
+	Error  string `json:"error"`
+}
+
+// FieldErrors returns the invalid arguments of a call made with JSON
+// arguments, or nil for other errors.
+func (e *Error) FieldErrors() []FieldError {
+	var fieldErrors []FieldError
+
+	if !decodeDetails(e.Details, &fieldErrors) {
+		return nil
+	}
+
+	return fieldErrors
+}
+
+// BatchErrors returns the invalid entries of a rejected batch, or nil for
+// other errors.
+func (e *Error) BatchErrors() []BatchEntryError {
+	var batchErrors []BatchEntryError
+
+	if !decodeDetails(e.Details, &batchErrors) {
+		return nil
+	}
+
+	return batchErrors
+}
+
+// decodeDetails decodes details into a slice of entries, failing if the
+// entries have fields the slice's type does not, since the details of
+// different errors are all arrays of objects.
+func decodeDetails(details json.RawMessage, entries interface{}) bool {
+	decoder := json.NewDecoder(bytes.NewReader(details))
+	decoder.DisallowUnknownFields()
+
+	return decoder.Decode(entries) == nil
+}
+
+// ErrorCode returns the chaincode error code of err, or an empty string if
+// err is not an *Error.
+func ErrorCode(err error) string {
+	if chaincodeError, ok := err.(*Error); ok {
+		return chaincodeError.Code
+	}
+
+	return ""
+}
+
+// responseError decodes an error response. Responses that are not in the
+// chaincode's error model, such as those of a peer that failed to run the
+// chaincode, are reported as INTERNAL with the response message.
+func responseError(response pb.Response) error {
+	chaincodeError := &Error{}
+
+	if json.Unmarshal(response.Payload, chaincodeError) != nil || chaincodeError.Code == "" {
+		message := response.Message
+
+		if message == "" {
+			message = "status " + strconv.Itoa(int(response.Status))
+		}
+
+		chaincodeError = &Error{Code: CodeInternal, Message: message}
+	}
+
+	chaincodeError.Status = response.Status
+
+	return chaincodeError
+}
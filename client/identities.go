@@ -0,0 +1,172 @@
+package client
+
+import "strconv"
+
+// IssueIdentityRequest issues an identity. Dependents are issued with their
+// guardians and the Unix time at which they come of age, and may be issued
+// without a public key.
+type IssueIdentityRequest struct {
+	UserId       string   `json:"userId"`
+	PublicKey    string   `json:"publicKey"`
+	MetadataHash string   `json:"metadataHash"`
+	Guardians    []string `json:"guardians"`
+	MajorityAt   int64    `json:"majorityAt"`
+}
+
+func (r IssueIdentityRequest) Call() Call {
+	args := []string{r.UserId, r.PublicKey, r.MetadataHash}
+
+	if len(r.Guardians) > 0 || r.MajorityAt != 0 {
+		args = append(args, formatList(r.Guardians), formatTimestamp(r.MajorityAt))
+	}
+
+	return Call{Function: "issueIdentity", Args: args}
+}
+
+// RotateUserKeyRequest replaces a user's public key. It is signed by the
+// user or, for a dependent, by a guardian named as SignerId.
+type RotateUserKeyRequest struct {
+	UserId    string `json:"userId"`
+	PublicKey string `json:"publicKey"`
+	SignerId  string `json:"signerId"`
+	Signature string `json:"signature"`
+}
+
+// SignedMessage returns the message to sign, given the user's current nonce.
+func (r RotateUserKeyRequest) SignedMessage(nonce int) string {
+	return SignedMessage("rotateUserKey", r.UserId, r.PublicKey, r.SignerId, strconv.Itoa(nonce))
+}
+
+func (r RotateUserKeyRequest) Call() Call {
+	return Call{Function: "rotateUserKey", Args: []string{r.UserId, r.PublicKey, r.SignerId, r.Signature}}
+}
+
+// SetUserMetadataHashRequest replaces the hash of a user's off-chain
+// metadata. It is signed like RotateUserKeyRequest.
+type SetUserMetadataHashRequest struct {
+	UserId       string `json:"userId"`
+	MetadataHash string `json:"metadataHash"`
+	SignerId     string `json:"signerId"`
+	Signature    string `json:"signature"`
+}
+
+// SignedMessage returns the message to sign, given the user's current nonce.
+func (r SetUserMetadataHashRequest) SignedMessage(nonce int) string {
+	return SignedMessage("setUserMetadataHash", r.UserId, r.MetadataHash, r.SignerId, strconv.Itoa(nonce))
+}
+
+func (r SetUserMetadataHashRequest) Call() Call {
+	return Call{Function: "setUserMetadataHash", Args: []string{r.UserId, r.MetadataHash, r.SignerId, r.Signature}}
+}
+
+// PromoteDependentRequest hands a dependent who has come of age control of
+// their own key. It is signed with the new key, proving the person holds it.
+type PromoteDependentRequest struct {
+	UserId    string `json:"userId"`
+	PublicKey string `json:"publicKey"`
+	Signature string `json:"signature"`
+}
+
+// SignedMessage returns the message to sign, given the dependent's current
+// nonce.
+func (r PromoteDependentRequest) SignedMessage(nonce int) string {
+	return SignedMessage("promoteDependent", r.UserId, r.PublicKey, strconv.Itoa(nonce))
+}
+
+func (r PromoteDependentRequest) Call() Call {
+	return Call{Function: "promoteDependent", Args: []string{r.UserId, r.PublicKey, r.Signature}}
+}
+
+// IssueIdentity issues an identity. Only the identity authority may call it.
+func (c *Client) IssueIdentity(request IssueIdentityRequest) error {
+	return c.Do(request.Call(), nil)
+}
+
+// BatchIssueIdentities issues every identity of entries, or none of them.
+// The BatchErrors of a rejected batch give the error of each invalid entry.
+func (c *Client) BatchIssueIdentities(entries []BatchIdentity) error {
+	if entries == nil {
+		entries = []BatchIdentity{}
+	}
+
+	return c.Do(Call{Function: "batchIssueIdentities", Args: []string{formatJson(entries)}}, nil)
+}
+
+// GetIdentity returns a user. Only the identity authority may read it.
+func (c *Client) GetIdentity(userId string) (*User, error) {
+	var user User
+	err := c.Do(Call{Function: "getIdentity", Args: []string{userId, "full"}, ReadOnly: true}, &user)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// GetIdentityStatus returns the status view of a user.
+func (c *Client) GetIdentityStatus(userId string) (*IdentityStatus, error) {
+	var status IdentityStatus
+	err := c.Do(Call{Function: "getIdentity", Args: []string{userId, "status"}, ReadOnly: true}, &status)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+// IdentityExists reports whether a user was issued.
+func (c *Client) IdentityExists(userId string) (bool, error) {
+	var exists bool
+	err := c.Do(Call{Function: "identityExists", Args: []string{userId}, ReadOnly: true}, &exists)
+
+	return exists, err
+}
+
+// RenewIdentity ends a user's validity at validUntil, a Unix time, or five
+// years from now if it is zero.
+func (c *Client) RenewIdentity(userId string, validUntil int64) error {
+	args := []string{userId}
+
+	if validUntil != 0 {
+		args = append(args, formatInt(validUntil))
+	}
+
+	return c.Do(Call{Function: "renewIdentity", Args: args}, nil)
+}
+
+// VerifyIdentity checks a message signed by a user. The signature is only
+// valid while the identity is active.
+func (c *Client) VerifyIdentity(userId string, message string, signature string) (*IdentityVerification, error) {
+	var verification IdentityVerification
+	err := c.Do(Call{Function: "verifyIdentity", Args: []string{userId, message, signature}, ReadOnly: true}, &verification)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &verification, nil
+}
+
+// RotateUserKey replaces a user's public key.
+func (c *Client) RotateUserKey(request RotateUserKeyRequest) error {
+	return c.Do(request.Call(), nil)
+}
+
+// SetUserMetadataHash replaces the hash of a user's off-chain metadata.
+func (c *Client) SetUserMetadataHash(request SetUserMetadataHashRequest) error {
+	return c.Do(request.Call(), nil)
+}
+
+// UpdateUserMetadataHash replaces the hash of a user's off-chain metadata
+// without the user's signature. Only the identity authority may call it.
+func (c *Client) UpdateUserMetadataHash(userId string, metadataHash string) error {
+	return c.Do(Call{Function: "updateUserMetadataHash", Args: []string{userId, metadataHash}}, nil)
+}
+
+// PromoteDependent hands a dependent who has come of age control of their
+// own key. Only the identity authority may call it.
+func (c *Client) PromoteDependent(request PromoteDependentRequest) error {
+	return c.Do(request.Call(), nil)
+}
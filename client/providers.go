@@ -0,0 +1,202 @@
+package client
+
+import "strconv"
+
+// AddServiceProviderRequest registers a service provider directly. The
+// allowed scopes must be permitted for the category, and MspId is the MSP
+// whose members may look identities up for the provider. Without a category
+// or an MSP, the provider is registered as before categories existed.
+type AddServiceProviderRequest struct {
+	SpId            string   `json:"spId"`
+	Name            string   `json:"name"`
+	PublicKey       string   `json:"publicKey"`
+	Category        string   `json:"category"`
+	AllowedScopes   []string `json:"allowedScopes"`
+	ContactEndpoint string   `json:"contactEndpoint"`
+	MspId           string   `json:"mspId"`
+}
+
+func (r AddServiceProviderRequest) Call() Call {
+	return Call{Function: "addServiceProvider", Args: []string{r.SpId, r.Name, r.PublicKey, r.Category, formatList(r.AllowedScopes), r.ContactEndpoint, r.MspId}}
+}
+
+// ServiceProviderRegistrationRequest asks the identity authority to register
+// a service provider owned by the caller's MSP.
+type ServiceProviderRegistrationRequest struct {
+	SpId            string   `json:"spId"`
+	Name            string   `json:"name"`
+	PublicKey       string   `json:"publicKey"`
+	Category        string   `json:"category"`
+	Scopes          []string `json:"scopes"`
+	ContactEndpoint string   `json:"contactEndpoint"`
+}
+
+func (r ServiceProviderRegistrationRequest) Call() Call {
+	return Call{Function: "requestServiceProviderRegistration", Args: []string{r.SpId, r.Name, r.PublicKey, r.Category, formatList(r.Scopes), r.ContactEndpoint}}
+}
+
+// ListServiceProviderRequestsRequest asks for a page of up to PageSize
+// registration requests with Status, or with any status if it is empty,
+// starting at the Bookmark of the previous page. A zero PageSize uses the
+// chaincode's default.
+type ListServiceProviderRequestsRequest struct {
+	Status   string `json:"status"`
+	PageSize int    `json:"pageSize"`
+	Bookmark string `json:"bookmark"`
+}
+
+func (r ListServiceProviderRequestsRequest) Call() Call {
+	return Call{Function: "listServiceProviderRequests", Args: []string{r.Status, strconv.Itoa(r.PageSize), r.Bookmark}, ReadOnly: true}
+}
+
+// LookupIdentityRequest reads the status of a user and the attributes of
+// the given scopes on behalf of a service provider. It must be sent by a
+// member of the provider's MSP.
+type LookupIdentityRequest struct {
+	SpId   string   `json:"spId"`
+	UserId string   `json:"userId"`
+	Scopes []string `json:"scopes"`
+}
+
+func (r LookupIdentityRequest) Call() Call {
+	return Call{Function: "lookupIdentity", Args: []string{r.SpId, r.UserId, formatList(r.Scopes)}, ReadOnly: true}
+}
+
+// AddProviderKeyRequest adds a key to a service provider's key set. It is
+// signed with one of the provider's active signing keys, SigningKeyId.
+// ValidFrom and ValidUntil are Unix times; zero leaves them open.
+type AddProviderKeyRequest struct {
+	SpId         string `json:"spId"`
+	KeyId        string `json:"keyId"`
+	PublicKey    string `json:"publicKey"`
+	Purpose      string `json:"purpose"`
+	ValidFrom    int64  `json:"validFrom"`
+	ValidUntil   int64  `json:"validUntil"`
+	SigningKeyId string `json:"signingKeyId"`
+	Signature    string `json:"signature"`
+}
+
+func (r AddProviderKeyRequest) params() []string {
+	return []string{r.SpId, r.KeyId, r.PublicKey, r.Purpose, formatTimestamp(r.ValidFrom), formatTimestamp(r.ValidUntil), r.SigningKeyId}
+}
+
+// SignedMessage returns the message to sign with the signing key.
+func (r AddProviderKeyRequest) SignedMessage() string {
+	return SignedMessage("addProviderKey", r.params()...)
+}
+
+func (r AddProviderKeyRequest) Call() Call {
+	return Call{Function: "addProviderKey", Args: append(r.params(), r.Signature)}
+}
+
+// RetireProviderKeyRequest retires a key of a service provider. It is signed
+// like AddProviderKeyRequest.
+type RetireProviderKeyRequest struct {
+	SpId         string `json:"spId"`
+	KeyId        string `json:"keyId"`
+	SigningKeyId string `json:"signingKeyId"`
+	Signature    string `json:"signature"`
+}
+
+// SignedMessage returns the message to sign with the signing key.
+func (r RetireProviderKeyRequest) SignedMessage() string {
+	return SignedMessage("retireProviderKey", r.SpId, r.KeyId, r.SigningKeyId)
+}
+
+func (r RetireProviderKeyRequest) Call() Call {
+	return Call{Function: "retireProviderKey", Args: []string{r.SpId, r.KeyId, r.SigningKeyId, r.Signature}}
+}
+
+// AddServiceProvider registers a service provider. Only the identity
+// authority may call it.
+func (c *Client) AddServiceProvider(request AddServiceProviderRequest) error {
+	return c.Do(request.Call(), nil)
+}
+
+// GetServiceProvider returns a service provider.
+func (c *Client) GetServiceProvider(spId string) (*ServiceProvider, error) {
+	var sp ServiceProvider
+	err := c.Do(Call{Function: "getServiceProvider", Args: []string{spId}, ReadOnly: true}, &sp)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &sp, nil
+}
+
+// RequestServiceProviderRegistration asks the identity authority to register
+// a service provider.
+func (c *Client) RequestServiceProviderRegistration(request ServiceProviderRegistrationRequest) error {
+	return c.Do(request.Call(), nil)
+}
+
+// ApproveServiceProvider approves a pending registration request. Only the
+// identity authority may call it.
+func (c *Client) ApproveServiceProvider(spId string) error {
+	return c.Do(Call{Function: "approveServiceProvider", Args: []string{spId}}, nil)
+}
+
+// RejectServiceProvider rejects a pending registration request. Only the
+// identity authority may call it.
+func (c *Client) RejectServiceProvider(spId string, reason string) error {
+	return c.Do(Call{Function: "rejectServiceProvider", Args: []string{spId, reason}}, nil)
+}
+
+// GetServiceProviderRegistration returns a registration request.
+func (c *Client) GetServiceProviderRegistration(spId string) (*ServiceProviderRequest, error) {
+	var request ServiceProviderRequest
+	err := c.Do(Call{Function: "getServiceProviderRegistration", Args: []string{spId}, ReadOnly: true}, &request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &request, nil
+}
+
+// ListServiceProviderRequests returns a page of registration requests. Each
+// page reads up to PageSize stored requests and holds those with Status, so
+// a filtered page may hold fewer.
+func (c *Client) ListServiceProviderRequests(request ListServiceProviderRequestsRequest) (*ServiceProviderRequestPage, error) {
+	var page ServiceProviderRequestPage
+	err := c.Do(request.Call(), &page)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &page, nil
+}
+
+// LookupIdentity returns the status of a user and the attributes the
+// request's scopes allow.
+func (c *Client) LookupIdentity(request LookupIdentityRequest) (*IdentityAttributes, error) {
+	var attributes IdentityAttributes
+	err := c.Do(request.Call(), &attributes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &attributes, nil
+}
+
+// AddProviderKey adds a key to a service provider.
+func (c *Client) AddProviderKey(request AddProviderKeyRequest) error {
+	return c.Do(request.Call(), nil)
+}
+
+// RetireProviderKey retires a key of a service provider.
+func (c *Client) RetireProviderKey(request RetireProviderKeyRequest) error {
+	return c.Do(request.Call(), nil)
+}
+
+// VerifyProviderMessage reports whether message was signed with the key
+// keyId of a service provider, and the key was active.
+func (c *Client) VerifyProviderMessage(spId string, keyId string, message string, signature string) (bool, error) {
+	var valid bool
+	err := c.Do(Call{Function: "verifyProviderMessage", Args: []string{spId, keyId, message, signature}, ReadOnly: true}, &valid)
+
+	return valid, err
+}
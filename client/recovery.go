@@ -0,0 +1,98 @@
+package client
+
+import "strconv"
+
+// SetRecoveryContactsRequest sets the users who can jointly recover a user's
+// key and how many of them must approve. An empty list with a threshold of
+// zero removes them. It is signed like RotateUserKeyRequest.
+type SetRecoveryContactsRequest struct {
+	UserId    string   `json:"userId"`
+	Contacts  []string `json:"contacts"`
+	Threshold int      `json:"threshold"`
+	SignerId  string   `json:"signerId"`
+	Signature string   `json:"signature"`
+}
+
+// SignedMessage returns the message to sign, given the user's current nonce.
+func (r SetRecoveryContactsRequest) SignedMessage(nonce int) string {
+	return SignedMessage("setRecoveryContacts", r.UserId, formatList(r.Contacts), strconv.Itoa(r.Threshold), r.SignerId, strconv.Itoa(nonce))
+}
+
+func (r SetRecoveryContactsRequest) Call() Call {
+	return Call{Function: "setRecoveryContacts", Args: []string{r.UserId, formatList(r.Contacts), strconv.Itoa(r.Threshold), r.SignerId, r.Signature}}
+}
+
+// InitiateRecoveryRequest starts replacing a user's key with NewPublicKey,
+// approved by at least the user's threshold of recovery contacts.
+type InitiateRecoveryRequest struct {
+	UserId       string             `json:"userId"`
+	NewPublicKey string             `json:"newPublicKey"`
+	Approvals    []RecoveryApproval `json:"approvals"`
+}
+
+// ApprovalMessage returns the message each recovery contact signs, given the
+// user's current nonce.
+func (r InitiateRecoveryRequest) ApprovalMessage(nonce int) string {
+	return SignedMessage("approveRecovery", r.UserId, r.NewPublicKey, strconv.Itoa(nonce))
+}
+
+func (r InitiateRecoveryRequest) Call() Call {
+	approvals := r.Approvals
+
+	if approvals == nil {
+		approvals = []RecoveryApproval{}
+	}
+
+	return Call{Function: "initiateRecovery", Args: []string{r.UserId, r.NewPublicKey, formatJson(approvals)}}
+}
+
+// CancelRecoveryRequest discards a pending recovery. It is signed with the
+// user's current key, or by a guardian for a dependent.
+type CancelRecoveryRequest struct {
+	UserId    string `json:"userId"`
+	SignerId  string `json:"signerId"`
+	Signature string `json:"signature"`
+}
+
+// SignedMessage returns the message to sign, given the user's current nonce.
+func (r CancelRecoveryRequest) SignedMessage(nonce int) string {
+	return SignedMessage("cancelRecovery", r.UserId, r.SignerId, strconv.Itoa(nonce))
+}
+
+func (r CancelRecoveryRequest) Call() Call {
+	return Call{Function: "cancelRecovery", Args: []string{r.UserId, r.SignerId, r.Signature}}
+}
+
+// SetRecoveryContacts sets a user's recovery contacts.
+func (c *Client) SetRecoveryContacts(request SetRecoveryContactsRequest) error {
+	return c.Do(request.Call(), nil)
+}
+
+// InitiateRecovery starts a key recovery, which can be completed once its
+// time lock has passed.
+func (c *Client) InitiateRecovery(request InitiateRecoveryRequest) error {
+	return c.Do(request.Call(), nil)
+}
+
+// CancelRecovery discards a pending recovery.
+func (c *Client) CancelRecovery(request CancelRecoveryRequest) error {
+	return c.Do(request.Call(), nil)
+}
+
+// CompleteRecovery installs the recovered key of a user once the time lock
+// has passed. Anyone may call it.
+func (c *Client) CompleteRecovery(userId string) error {
+	return c.Do(Call{Function: "completeRecovery", Args: []string{userId}}, nil)
+}
+
+// GetRecovery returns a user's pending recovery.
+func (c *Client) GetRecovery(userId string) (*PendingRecovery, error) {
+	var recovery PendingRecovery
+	err := c.Do(Call{Function: "getRecovery", Args: []string{userId}, ReadOnly: true}, &recovery)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &recovery, nil
+}
@@ -0,0 +1,275 @@
+package client
+
+import "encoding/json"
+
+// Identity statuses, as reported by getIdentity, lookupIdentity and
+// verifyIdentity.
+const (
+	StatusActive  = "active"
+	StatusExpired = "expired"
+)
+
+// Registration request statuses.
+const (
+	RequestPending  = "pending"
+	RequestApproved = "approved"
+	RequestRejected = "rejected"
+)
+
+// Scopes name the user attributes a service provider may read.
+const (
+	ScopePublicKey    = "publicKey"
+	ScopeMetadataHash = "metadataHash"
+	ScopePermissions  = "permissions"
+)
+
+// User is an identity as returned by getIdentity. Status is worked out at
+// the time of the call. Dependents have Guardians and a MajorityAt time, and
+// may have no public key.
+type User struct {
+	PublicKey         string   `json:"publicKey"`
+	MetadataHash      string   `json:"metadataHash"`
+	Permissions       []string `json:"permissions"`
+	Status            string   `json:"status"`
+	IssuedAt          int64    `json:"issuedAt,omitempty"`
+	ValidUntil        int64    `json:"validUntil,omitempty"`
+	Guardians         []string `json:"guardians,omitempty"`
+	MajorityAt        int64    `json:"majorityAt,omitempty"`
+	Nonce             int      `json:"nonce"`
+	RecoveryContacts  []string `json:"recoveryContacts,omitempty"`
+	RecoveryThreshold int      `json:"recoveryThreshold,omitempty"`
+	Version           int      `json:"version"`
+}
+
+// IdentityStatus is the status view of getIdentity, which is all that
+// verifiers of user signatures need. Nonce is signed into user actions.
+type IdentityStatus struct {
+	Status     string `json:"status"`
+	PublicKey  string `json:"publicKey"`
+	ValidUntil int64  `json:"validUntil,omitempty"`
+	Nonce      int    `json:"nonce"`
+}
+
+// IdentityVerification is the result of verifyIdentity.
+type IdentityVerification struct {
+	Valid  bool   `json:"valid"`
+	Status string `json:"status"`
+}
+
+// IdentityAttributes is the result of lookupIdentity: the user's status and
+// the attributes of the requested scopes.
+type IdentityAttributes struct {
+	Status       string   `json:"status"`
+	PublicKey    string   `json:"publicKey,omitempty"`
+	MetadataHash string   `json:"metadataHash,omitempty"`
+	Permissions  []string `json:"permissions,omitempty"`
+}
+
+// ServiceProvider is a registered service provider.
+type ServiceProvider struct {
+	Name            string        `json:"name"`
+	PublicKey       string        `json:"publicKey"`
+	Category        string        `json:"category"`
+	AllowedScopes   []string      `json:"allowedScopes"`
+	ContactEndpoint string        `json:"contactEndpoint"`
+	MspId           string        `json:"mspId"`
+	Keys            []ProviderKey `json:"keys"`
+	Version         int           `json:"version"`
+}
+
+// ProviderKey is one key of a service provider's key set.
+type ProviderKey struct {
+	KeyId      string `json:"keyId"`
+	PublicKey  string `json:"publicKey"`
+	Purpose    string `json:"purpose"`
+	ValidFrom  int64  `json:"validFrom"`
+	ValidUntil int64  `json:"validUntil,omitempty"`
+	RetiredAt  int64  `json:"retiredAt,omitempty"`
+}
+
+// ServiceProviderRequest is a request to register a service provider.
+type ServiceProviderRequest struct {
+	Id              string   `json:"id"`
+	Name            string   `json:"name"`
+	PublicKey       string   `json:"publicKey"`
+	Category        string   `json:"category"`
+	Scopes          []string `json:"scopes"`
+	ContactEndpoint string   `json:"contactEndpoint"`
+	MspId           string   `json:"mspId"`
+	Status          string   `json:"status"`
+	Reason          string   `json:"reason,omitempty"`
+	Version         int      `json:"version"`
+}
+
+// ServiceProviderRequestPage is one page of listServiceProviderRequests.
+// Bookmark is passed to the next call and is empty once every request has
+// been read.
+type ServiceProviderRequestPage struct {
+	Requests []ServiceProviderRequest `json:"requests"`
+	Bookmark string                   `json:"bookmark"`
+}
+
+// PendingRecovery is a key recovery waiting for its time lock to pass.
+type PendingRecovery struct {
+	NewPublicKey string   `json:"newPublicKey"`
+	Approvers    []string `json:"approvers"`
+	Nonce        int      `json:"nonce"`
+	InitiatedAt  int64    `json:"initiatedAt"`
+	ExecutableAt int64    `json:"executableAt"`
+	Version      int      `json:"version"`
+}
+
+// RecoveryApproval is a recovery contact's signature over the message
+// returned by InitiateRecoveryRequest.ApprovalMessage.
+type RecoveryApproval struct {
+	ContactId string `json:"contactId"`
+	Signature string `json:"signature"`
+}
+
+// BatchIdentity is one entry of batchIssueIdentities.
+type BatchIdentity struct {
+	UserId       string   `json:"userId"`
+	PublicKey    string   `json:"publicKey"`
+	MetadataHash string   `json:"metadataHash"`
+	Guardians    []string `json:"guardians,omitempty"`
+	MajorityAt   int64    `json:"majorityAt,omitempty"`
+}
+
+// IdentityQuery is the selector of queryIdentities. Zero fields are not
+// filtered on.
+type IdentityQuery struct {
+	RecordType string `json:"recordType"`
+	Status     string `json:"status,omitempty"`
+	IssuedFrom int64  `json:"issuedFrom,omitempty"`
+	IssuedTo   int64  `json:"issuedTo,omitempty"`
+	Permission string `json:"permission,omitempty"`
+	Category   string `json:"category,omitempty"`
+}
+
+// QueryResult is one record matched by queryIdentities: a User or a
+// ServiceProvider, depending on the record type of the query.
+type QueryResult struct {
+	Id     string          `json:"id"`
+	Record json.RawMessage `json:"record"`
+}
+
+// User decodes the record of a user query, as returned to the identity
+// authority.
+func (result QueryResult) User() (*User, error) {
+	var user User
+	err := json.Unmarshal(result.Record, &user)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// IdentityStatus decodes the record of a user query, as returned to members
+// other than the identity authority.
+func (result QueryResult) IdentityStatus() (*IdentityStatus, error) {
+	var status IdentityStatus
+	err := json.Unmarshal(result.Record, &status)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+// ServiceProvider decodes the record of a service provider query.
+func (result QueryResult) ServiceProvider() (*ServiceProvider, error) {
+	var sp ServiceProvider
+	err := json.Unmarshal(result.Record, &sp)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &sp, nil
+}
+
+// QueryPage is one page of queryIdentities. Bookmark is passed to the next
+// call and is empty once every match has been returned.
+type QueryPage struct {
+	Records  []QueryResult `json:"records"`
+	Bookmark string        `json:"bookmark"`
+}
+
+// ExportedRecord is a raw ledger entry returned by exportRecords.
+type ExportedRecord struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ExportPage is one page of exportRecords. Bookmark is passed to the next
+// call and is empty once every record has been returned.
+type ExportPage struct {
+	Records  []ExportedRecord `json:"records"`
+	Bookmark string           `json:"bookmark"`
+}
+
+// MigrationPage is the result of one migrate or migrateKeys call. Bookmark is
+// only set by migrateKeys.
+type MigrationPage struct {
+	Scanned  int    `json:"scanned"`
+	Migrated int    `json:"migrated"`
+	Bookmark string `json:"bookmark"`
+}
+
+// PendingMigrationPage is one page of listPendingMigrations. Bookmark is
+// passed to the next call and is empty once every record has been read.
+type PendingMigrationPage struct {
+	Ids      []string `json:"ids"`
+	Bookmark string   `json:"bookmark"`
+}
+
+// RegistryStats is the result of getRegistryStats.
+type RegistryStats struct {
+	Identities          int            `json:"identities"`
+	IdentitiesByStatus  map[string]int `json:"identitiesByStatus"`
+	IssuedPerDay        map[string]int `json:"issuedPerDay"`
+	ProvidersByCategory map[string]int `json:"providersByCategory"`
+}
+
+// StatsCompaction is the result of compactStats. Bookmark is passed to the
+// next call and is empty once every counter has been visited.
+type StatsCompaction struct {
+	Compacted int    `json:"compacted"`
+	Bookmark  string `json:"bookmark"`
+}
+
+// ContractMetadata is the result of getMetadata.
+type ContractMetadata struct {
+	Functions  []FunctionMetadata `json:"functions"`
+	Policies   []PolicyMetadata   `json:"policies"`
+	ErrorCodes map[string]int32   `json:"errorCodes"`
+}
+
+// FunctionMetadata describes a chaincode function. Access names one of the
+// policies.
+type FunctionMetadata struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Access      string        `json:"access"`
+	ReadOnly    bool          `json:"readOnly"`
+	Args        []ArgMetadata `json:"args"`
+}
+
+// ArgMetadata describes an argument, or a field or element of one.
+type ArgMetadata struct {
+	Name     string        `json:"name,omitempty"`
+	Type     string        `json:"type"`
+	Required bool          `json:"required,omitempty"`
+	Optional bool          `json:"optional,omitempty"`
+	Items    *ArgMetadata  `json:"items,omitempty"`
+	Fields   []ArgMetadata `json:"fields,omitempty"`
+}
+
+// PolicyMetadata describes an access policy.
+type PolicyMetadata struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
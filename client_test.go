@@ -0,0 +1,159 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mars-identity-chaincode/client"
+	"github.com/mars-identity-chaincode/client/clienttest"
+)
+
+func TestClient(t *testing.T) {
+	stub := newTestStub(t)
+	identities := client.New(clienttest.StubTransport{Stub: stub})
+	aliceKey, newKey, bankKey := newTestKey(t), newTestKey(t), newTestKey(t)
+
+	err := identities.IssueIdentity(client.IssueIdentityRequest{UserId: "alice", PublicKey: client.PublicKey(aliceKey), MetadataHash: "hash1"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = identities.IssueIdentity(client.IssueIdentityRequest{UserId: "alice", PublicKey: client.PublicKey(aliceKey), MetadataHash: "hash1"})
+
+	if client.ErrorCode(err) != client.CodeAlreadyExists || err.(*client.Error).Status != 409 {
+		t.Fatalf("expected ALREADY_EXISTS, got %v", err)
+	}
+
+	// Alice rotates her key, signing over her current nonce.
+	status, err := identities.GetIdentityStatus("alice")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotation := client.RotateUserKeyRequest{UserId: "alice", PublicKey: client.PublicKey(newKey), SignerId: "alice"}
+	rotation.Signature, err = client.SignMessage(aliceKey, rotation.SignedMessage(status.Nonce))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = identities.RotateUserKey(rotation)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	historyLength := len(stub.History)
+	alice, err := identities.GetIdentity("alice")
+
+	if err != nil || alice.PublicKey != client.PublicKey(newKey) || alice.Nonce != 1 || alice.Status != client.StatusActive {
+		t.Fatalf("unexpected identity %+v: %v", alice, err)
+	}
+
+	signature, _ := client.SignMessage(newKey, "hello")
+	verification, err := identities.VerifyIdentity("alice", "hello", signature)
+
+	if err != nil || !verification.Valid || len(stub.History) != historyLength {
+		t.Fatalf("unexpected verification %+v: %v", verification, err)
+	}
+
+	// The bank's MSP looks Alice up.
+	err = identities.AddServiceProvider(client.AddServiceProviderRequest{SpId: "bank", Name: "Bank", PublicKey: client.PublicKey(bankKey), Category: "finance", AllowedScopes: []string{client.ScopePublicKey}, MspId: "BankMSP"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stub.SetCreator("BankMSP")
+	attributes, err := identities.LookupIdentity(client.LookupIdentityRequest{SpId: "bank", UserId: "alice", Scopes: []string{client.ScopePublicKey}})
+
+	if err != nil || attributes.PublicKey != client.PublicKey(newKey) || attributes.Status != client.StatusActive {
+		t.Fatalf("unexpected attributes %+v: %v", attributes, err)
+	}
+
+	_, err = identities.ExportRecords(client.PageRequest{RecordType: client.RecordUser, PageSize: 10})
+
+	if client.ErrorCode(err) != client.CodeUnauthorized {
+		t.Fatalf("expected UNAUTHORIZED, got %v", err)
+	}
+}
+
+func TestClientOnNetwork(t *testing.T) {
+	network := newTestNetwork(t)
+	authority := client.New(clienttest.NetworkTransport{Network: network, MspId: testAuthorityMspId})
+	health := client.New(clienttest.NetworkTransport{Network: network, MspId: testHealthMspId})
+	aliceKey, clinicKey := newTestKey(t), newTestKey(t)
+
+	err := authority.IssueIdentity(client.IssueIdentityRequest{UserId: "alice", PublicKey: client.PublicKey(aliceKey), MetadataHash: "hash1"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = health.RequestServiceProviderRegistration(client.ServiceProviderRegistrationRequest{SpId: "clinic", Name: "Clinic", PublicKey: client.PublicKey(clinicKey), Category: "healthcare", Scopes: []string{client.ScopePublicKey}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = authority.ApproveServiceProvider("clinic")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attributes, err := health.LookupIdentity(client.LookupIdentityRequest{SpId: "clinic", UserId: "alice", Scopes: []string{client.ScopePublicKey}})
+
+	if err != nil || attributes.PublicKey != client.PublicKey(aliceKey) {
+		t.Fatalf("unexpected attributes %+v: %v", attributes, err)
+	}
+
+	_, err = client.New(clienttest.NetworkTransport{Network: network, MspId: testTransportMspId}).LookupIdentity(client.LookupIdentityRequest{SpId: "clinic", UserId: "alice", Scopes: []string{client.ScopePublicKey}})
+
+	if client.ErrorCode(err) != client.CodeUnauthorized {
+		t.Fatalf("expected UNAUTHORIZED, got %v", err)
+	}
+}
+
+// TestClientCallsMatchMetadata checks the calls the client builds against the
+// function registry: each names a function, passes no more arguments than it
+// takes, and is evaluated only if the function is read-only.
+func TestClientCallsMatchMetadata(t *testing.T) {
+	stub := newTestStub(t)
+	metadata, err := client.New(clienttest.StubTransport{Stub: stub}).GetMetadata()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	functions := map[string]client.FunctionMetadata{}
+
+	for _, function := range metadata.Functions {
+		functions[function.Name] = function
+	}
+
+	calls := []client.Call{
+		client.IssueIdentityRequest{Guardians: []string{"alice"}}.Call(),
+		client.RotateUserKeyRequest{}.Call(),
+		client.SetUserMetadataHashRequest{}.Call(),
+		client.PromoteDependentRequest{}.Call(),
+		client.AddServiceProviderRequest{}.Call(),
+		client.ServiceProviderRegistrationRequest{}.Call(),
+		client.LookupIdentityRequest{}.Call(),
+		client.AddProviderKeyRequest{}.Call(),
+		client.RetireProviderKeyRequest{}.Call(),
+		client.SetRecoveryContactsRequest{}.Call(),
+		client.InitiateRecoveryRequest{}.Call(),
+		client.CancelRecoveryRequest{}.Call(),
+		client.QueryIdentitiesRequest{}.Call(),
+	}
+
+	for _, call := range calls {
+		function, ok := functions[call.Function]
+
+		if !ok || len(call.Args) > len(function.Args) || call.ReadOnly != function.ReadOnly {
+			t.Fatalf("call %s %q does not match %+v", call.Function, call.Args, function)
+		}
+	}
+}
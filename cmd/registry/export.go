@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// record is a raw ledger entry as returned by the exportRecords query.
+type record struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// exportPage is one page returned by the exportRecords query.
+type exportPage struct {
+	Records []record `json:"records"`
+}
+
+// objectTypes are the composite key object types of each record type, and
+// legacyPrefixes the key prefixes used by releases before composite keys.
+var objectTypes = map[string]string{
+	"user": "identity~user",
+	"sp":   "identity~sp",
+}
+
+var legacyPrefixes = map[string]string{
+	"user": "user_",
+	"sp":   "sp_",
+}
+
+// recordId returns the ID in the ledger key of a record and whether the key
+// belongs to recordType. Composite keys are a null byte followed by the
+// object type and each attribute, all terminated by a null byte.
+func recordId(key string, recordType string) (string, bool) {
+	if strings.HasPrefix(key, "\x00") {
+		parts := strings.Split(strings.TrimSuffix(key[1:], "\x00"), "\x00")
+
+		if len(parts) != 2 || parts[0] != objectTypes[recordType] {
+			return "", false
+		}
+
+		return parts[1], true
+	}
+
+	if !strings.HasPrefix(key, legacyPrefixes[recordType]) {
+		return "", false
+	}
+
+	return strings.TrimPrefix(key, legacyPrefixes[recordType]), true
+}
+
+// csvColumns lists the record fields written to CSV for each record type,
+// after the ID column. List values are joined with semicolons.
+var csvColumns = map[string][]string{
+	"user": {"publicKey", "metadataHash", "status", "issuedAt", "validUntil", "guardians", "majorityAt", "permissions"},
+	"sp":   {"name", "category", "allowedScopes", "contactEndpoint", "mspId", "publicKey"},
+}
+
+var idColumns = map[string]string{
+	"user": "userId",
+	"sp":   "spId",
+}
+
+type multiFlag []string
+
+func (f *multiFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *multiFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func runExport(args []string) error {
+	var in multiFlag
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.Var(&in, "in", "exportRecords page, or JSON array of records; may be repeated")
+	out := flags.String("out", "", "file to write")
+	recordType := flags.String("type", "user", "record type, user or sp")
+	format := flags.String("format", "", "output format, csv or json (default: from the file extension)")
+
+	err := flags.Parse(args)
+
+	if err != nil {
+		return err
+	}
+
+	if len(in) == 0 || *out == "" {
+		return errors.New("export needs -in and -out")
+	}
+
+	if _, ok := objectTypes[*recordType]; !ok {
+		return errors.New("unknown record type: " + *recordType)
+	}
+
+	outputFormat := inputFormat(*format, *out)
+
+	if outputFormat != "json" && outputFormat != "csv" {
+		return errors.New("unknown output format: " + outputFormat)
+	}
+
+	// Pages exported before and after migrateKeys can hold a record under
+	// both key layouts. The composite copy is the current one.
+	rows := []map[string]interface{}{}
+	rowIndex := map[string]int{}
+	composite := map[string]bool{}
+
+	for _, path := range in {
+		records, err := readRecords(path)
+
+		if err != nil {
+			return err
+		}
+
+		for _, r := range records {
+			id, ok := recordId(r.Key, *recordType)
+
+			if !ok {
+				continue
+			}
+
+			row := map[string]interface{}{}
+			err = json.Unmarshal(r.Value, &row)
+
+			if err != nil {
+				return fmt.Errorf("%s: record %s: %v", path, r.Key, err)
+			}
+
+			row[idColumns[*recordType]] = id
+			isComposite := strings.HasPrefix(r.Key, "\x00")
+			i, seen := rowIndex[id]
+
+			switch {
+			case !seen:
+				rowIndex[id] = len(rows)
+				rows = append(rows, row)
+			case isComposite && !composite[id]:
+				rows[i] = row
+			default:
+				continue
+			}
+
+			composite[id] = isComposite
+		}
+	}
+
+	idColumn := idColumns[*recordType]
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i][idColumn].(string) < rows[j][idColumn].(string)
+	})
+
+	file, err := os.Create(*out)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	if outputFormat == "json" {
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(rows)
+	} else {
+		err = writeCSV(file, *recordType, rows)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("wrote %d records to %s\n", len(rows), *out)
+
+	return nil
+}
+
+// readRecords accepts either an exportRecords page or a bare array of records.
+func readRecords(path string) ([]record, error) {
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var records []record
+
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+		err = json.Unmarshal(data, &records)
+	} else {
+		var page exportPage
+		err = json.Unmarshal(data, &page)
+		records = page.Records
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return records, nil
+}
+
+func writeCSV(file *os.File, recordType string, rows []map[string]interface{}) error {
+	writer := csv.NewWriter(file)
+	columns := append([]string{idColumns[recordType]}, csvColumns[recordType]...)
+
+	err := writer.Write(columns)
+
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		line := make([]string, len(columns))
+
+		for i, column := range columns {
+			line[i] = csvValue(row[column])
+		}
+
+		err = writer.Write(line)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
+
+func csvValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		parts := make([]string, len(v))
+
+		for i, item := range v {
+			parts[i] = csvValue(item)
+		}
+
+		return strings.Join(parts, ";")
+	default:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+}
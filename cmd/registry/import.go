@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// colonist mirrors the chaincode's BatchIdentity.
+type colonist struct {
+	UserId       string   `json:"userId"`
+	PublicKey    string   `json:"publicKey"`
+	MetadataHash string   `json:"metadataHash"`
+	Guardians    []string `json:"guardians,omitempty"`
+	MajorityAt   int64    `json:"majorityAt,omitempty"`
+}
+
+// chaincodeInput is the form `peer chaincode invoke -c` expects.
+type chaincodeInput struct {
+	Args []string `json:"Args"`
+}
+
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	in := flags.String("in", "", "CSV or JSON file of colonists")
+	out := flags.String("out", "", "directory to write payloads to")
+	format := flags.String("format", "", "input format, csv or json (default: from the file extension)")
+	batchSize := flags.Int("batch", 100, "identities per payload, at most the chaincode's maxBatchSize")
+	channel := flags.String("channel", "identity", "channel of signed proposals")
+	chaincode := flags.String("chaincode", "identity", "chaincode name of signed proposals")
+	mspId := flags.String("msp-id", "", "MSP ID of the identity authority")
+	cert := flags.String("cert", "", "PEM certificate of the signing identity; enables signed proposals")
+	key := flags.String("key", "", "PEM private key of the signing identity")
+
+	err := flags.Parse(args)
+
+	if err != nil {
+		return err
+	}
+
+	if *in == "" || *out == "" {
+		return errors.New("import needs -in and -out")
+	}
+
+	if *batchSize < 1 {
+		return errors.New("-batch must be positive")
+	}
+
+	var signer *proposalSigner
+
+	if *cert != "" || *key != "" {
+		signer, err = newProposalSigner(*mspId, *cert, *key)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	colonists, err := readColonists(*in, inputFormat(*format, *in))
+
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(*out, 0755)
+
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i*(*batchSize) < len(colonists); i++ {
+		end := (i + 1) * (*batchSize)
+
+		if end > len(colonists) {
+			end = len(colonists)
+		}
+
+		entries, err := json.Marshal(colonists[i*(*batchSize) : end])
+
+		if err != nil {
+			return err
+		}
+
+		name := filepath.Join(*out, fmt.Sprintf("batch-%04d", i+1))
+
+		if signer == nil {
+			payload, err := json.Marshal(chaincodeInput{Args: []string{"batchIssueIdentities", string(entries)}})
+
+			if err != nil {
+				return err
+			}
+
+			err = ioutil.WriteFile(name+".json", payload, 0644)
+
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		input := &pb.ChaincodeInput{Args: [][]byte{[]byte("batchIssueIdentities"), entries}}
+		signedProposal, err := signer.sign(*channel, *chaincode, input)
+
+		if err != nil {
+			return err
+		}
+
+		payload, err := proto.Marshal(signedProposal)
+
+		if err != nil {
+			return err
+		}
+
+		err = ioutil.WriteFile(name+".pb", payload, 0644)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("wrote %d colonists to %s\n", len(colonists), *out)
+
+	return nil
+}
+
+func inputFormat(format string, path string) string {
+	if format != "" {
+		return format
+	}
+
+	return strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+}
+
+// readColonists reads and checks the input file. Dependents are moved after
+// everyone else so that their guardians are always issued first.
+func readColonists(path string, format string) ([]colonist, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	var colonists []colonist
+
+	switch format {
+	case "csv":
+		colonists, err = readColonistsCSV(file)
+	case "json":
+		err = json.NewDecoder(file).Decode(&colonists)
+	default:
+		return nil, errors.New("unknown input format: " + format)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+
+	for i, c := range colonists {
+		if c.UserId == "" {
+			return nil, fmt.Errorf("entry %d: missing userId", i+1)
+		}
+
+		if seen[c.UserId] {
+			return nil, fmt.Errorf("entry %d: duplicate userId %s", i+1, c.UserId)
+		}
+
+		seen[c.UserId] = true
+	}
+
+	sort.SliceStable(colonists, func(i, j int) bool {
+		return len(colonists[i].Guardians) == 0 && len(colonists[j].Guardians) > 0
+	})
+
+	return colonists, nil
+}
+
+// readColonistsCSV reads a CSV file with a header row naming the columns
+// userId, publicKey, metadataHash and optionally guardians, separated by
+// semicolons, and majorityAt.
+func readColonistsCSV(r io.Reader) ([]colonist, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+
+	if _, ok := columns["userId"]; !ok {
+		return nil, errors.New("CSV header has no userId column")
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+
+		return ""
+	}
+
+	colonists := []colonist{}
+
+	for {
+		record, err := reader.Read()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		var c colonist
+		c.UserId = field(record, "userId")
+		c.PublicKey = field(record, "publicKey")
+		c.MetadataHash = field(record, "metadataHash")
+
+		if guardians := field(record, "guardians"); guardians != "" {
+			c.Guardians = strings.Split(guardians, ";")
+		}
+
+		if majorityAt := field(record, "majorityAt"); majorityAt != "" {
+			c.MajorityAt, err = strconv.ParseInt(majorityAt, 10, 64)
+
+			if err != nil {
+				return nil, fmt.Errorf("user %s: invalid majorityAt %q", c.UserId, majorityAt)
+			}
+		}
+
+		colonists = append(colonists, c)
+	}
+
+	return colonists, nil
+}
@@ -0,0 +1,46 @@
+// Command registry moves colonist records in and out of the identity chaincode
+// without one peer invocation per person.
+//
+// The import subcommand reads a CSV or JSON file of colonists and writes
+// batchIssueIdentities payloads, either as ChaincodeInput JSON for
+// `peer chaincode invoke -c` or as SignedProposal files signed with the
+// identity authority's MSP certificate and key.
+//
+// The export subcommand reads pages returned by the exportRecords query and
+// writes the user_ or sp_ records they contain as CSV or JSON.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `Usage:
+  registry import -in colonists.csv -out payloads [-format csv|json] [-batch 100]
+                  [-channel identity -chaincode identity -msp-id ID -cert cert.pem -key key.pem]
+  registry export -in page.json [-in page2.json ...] -out records.csv [-type user|sp] [-format csv|json]
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+
+	switch os.Args[1] {
+	case "import":
+		err = runImport(os.Args[2:])
+	case "export":
+		err = runExport(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "registry:", err)
+		os.Exit(1)
+	}
+}
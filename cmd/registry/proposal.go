@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/protos/common"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/hyperledger/fabric/protos/utils"
+)
+
+// proposalSigner signs chaincode proposals the way a Fabric client does, with
+// an X.509 certificate and ECDSA key taken from an MSP directory.
+type proposalSigner struct {
+	creator []byte
+	key     *ecdsa.PrivateKey
+}
+
+func newProposalSigner(mspId string, certPath string, keyPath string) (*proposalSigner, error) {
+	if mspId == "" || certPath == "" || keyPath == "" {
+		return nil, errors.New("signed proposals need -msp-id, -cert and -key")
+	}
+
+	certPEM, err := ioutil.ReadFile(certPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	keyPEM, err := ioutil.ReadFile(keyPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(keyPEM)
+
+	if block == nil {
+		return nil, errors.New("no PEM block in " + keyPath)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+
+	if err != nil {
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	key, ok := parsed.(*ecdsa.PrivateKey)
+
+	if !ok {
+		return nil, errors.New("signing key is not an ECDSA key")
+	}
+
+	creator, err := proto.Marshal(&msp.SerializedIdentity{Mspid: mspId, IdBytes: certPEM})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &proposalSigner{creator: creator, key: key}, nil
+}
+
+// sign builds an endorser proposal invoking chaincode on channel with input
+// and signs it.
+func (s *proposalSigner) sign(channel string, chaincode string, input *pb.ChaincodeInput) (*pb.SignedProposal, error) {
+	spec := &pb.ChaincodeInvocationSpec{
+		ChaincodeSpec: &pb.ChaincodeSpec{
+			Type:        pb.ChaincodeSpec_GOLANG,
+			ChaincodeId: &pb.ChaincodeID{Name: chaincode},
+			Input:       input,
+		},
+	}
+
+	proposal, _, err := utils.CreateChaincodeProposal(common.HeaderType_ENDORSER_TRANSACTION, channel, spec, s.creator)
+
+	if err != nil {
+		return nil, err
+	}
+
+	proposalBytes, err := proto.Marshal(proposal)
+
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := s.signBytes(proposalBytes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.SignedProposal{ProposalBytes: proposalBytes, Signature: signature}, nil
+}
+
+// signBytes returns a DER ECDSA signature over the SHA-256 hash of message
+// with S in the lower half of the curve order, as Fabric requires.
+func (s *proposalSigner) signBytes(message []byte) ([]byte, error) {
+	hash := sha256.Sum256(message)
+	r, sigS, err := ecdsa.Sign(rand.Reader, s.key, hash[:])
+
+	if err != nil {
+		return nil, err
+	}
+
+	sigS = lowS(s.key.Curve, sigS)
+
+	return asn1.Marshal(struct{ R, S *big.Int }{r, sigS})
+}
+
+func lowS(curve elliptic.Curve, sigS *big.Int) *big.Int {
+	order := curve.Params().N
+	halfOrder := new(big.Int).Rsh(order, 1)
+
+	if sigS.Cmp(halfOrder) > 0 {
+		return new(big.Int).Sub(order, sigS)
+	}
+
+	return sigS
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	err := ioutil.WriteFile(path, []byte(content), 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestReadColonistsRejectsMalformedInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		content string
+		err     string
+	}{
+		{"no header", "csv", "", "EOF"},
+		{"no userId column", "csv", "publicKey,metadataHash\nk,h\n", "CSV header has no userId column"},
+		{"short row", "csv", "userId,publicKey,metadataHash\nalice,k\n", "wrong number of fields"},
+		{"long row", "csv", "userId,publicKey\nalice,k,extra\n", "wrong number of fields"},
+		{"unterminated quote", "csv", "userId,publicKey\n\"alice,k\n", "extraneous or missing \" in quoted-field"},
+		{"invalid majorityAt", "csv", "userId,guardians,majorityAt\nbob,alice,soon\n", `user bob: invalid majorityAt "soon"`},
+		{"missing userId", "csv", "userId,publicKey\nalice,k\n ,k\n", "entry 2: missing userId"},
+		{"duplicate userId", "csv", "userId,publicKey\nalice,k\nbob,k\nalice,k\n", "entry 3: duplicate userId alice"},
+		{"not an array", "json", `{"userId":"alice"}`, "cannot unmarshal object"},
+		{"duplicate JSON userId", "json", `[{"userId":"alice"},{"userId":"alice"}]`, "entry 2: duplicate userId alice"},
+		{"unknown format", "xml", "<colonists/>", "unknown input format: xml"},
+	}
+
+	for _, test := range tests {
+		path := writeTestFile(t, "colonists."+test.format, test.content)
+		_, err := readColonists(path, test.format)
+
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error %q, got %v", test.name, test.err, err)
+		}
+	}
+}
+
+func TestReadColonistsOrdersDependentsAfterGuardians(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		order   []string
+	}{
+		{"guardians first", "userId,guardians,majorityAt\nalice,,\nbob,,\ncarl,alice;bob,4102444800\n", []string{"alice", "bob", "carl"}},
+		{"dependents first", "userId,guardians,majorityAt\ncarl,alice;bob,4102444800\ndana,bob,4102444800\nalice,,\nbob,,\n", []string{"alice", "bob", "carl", "dana"}},
+		{"interleaved", "userId,guardians,majorityAt\nalice,,\ndana,alice,4102444800\nbob,,\ncarl,bob,4102444800\nerin,,\n", []string{"alice", "bob", "erin", "dana", "carl"}},
+		{"columns reordered", "majorityAt,guardians,userId\n4102444800,alice,bob\n,,alice\n", []string{"alice", "bob"}},
+	}
+
+	for _, test := range tests {
+		path := writeTestFile(t, "colonists.csv", test.content)
+		colonists, err := readColonists(path, "csv")
+
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		order := []string{}
+
+		for _, c := range colonists {
+			order = append(order, c.UserId)
+		}
+
+		if !reflect.DeepEqual(order, test.order) {
+			t.Errorf("%s: expected order %v, got %v", test.name, test.order, order)
+		}
+	}
+}
+
+// TestImportExportRoundTrip imports a CSV file, stores the payload's entries
+// as the chaincode stores users, and exports them back to a CSV file that
+// imports to the same colonists.
+func TestImportExportRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	in := writeTestFile(t, "colonists.csv", "userId,publicKey,metadataHash,guardians,majorityAt\n"+
+		"carl,,h3,alice;bob,4102444800\n"+
+		"alice,key-a,h1,,\n"+
+		"bob,key-b,\"h,2\",,\n")
+
+	err := runImport([]string{"-in", in, "-out", dir, "-batch", "2"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var page exportPage
+
+	for _, name := range []string{"batch-0001.json", "batch-0002.json"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var input chaincodeInput
+		var entries []map[string]interface{}
+		err = json.Unmarshal(data, &input)
+
+		if err == nil {
+			err = json.Unmarshal([]byte(input.Args[1]), &entries)
+		}
+
+		if err != nil || input.Args[0] != "batchIssueIdentities" {
+			t.Fatalf("%s: unexpected payload %s: %v", name, data, err)
+		}
+
+		for _, entry := range entries {
+			userId := entry["userId"].(string)
+			delete(entry, "userId")
+			entry["status"] = "active"
+			value, _ := json.Marshal(entry)
+			page.Records = append(page.Records, record{Key: "\x00identity~user\x00" + userId + "\x00", Value: value})
+		}
+	}
+
+	// Records of other types in the same page are skipped.
+	page.Records = append(page.Records, record{Key: "\x00identity~sp\x00bank\x00", Value: json.RawMessage(`{"name":"Bank"}`)})
+	pageData, _ := json.Marshal(page)
+	pagePath := writeTestFile(t, "page.json", string(pageData))
+	out := filepath.Join(dir, "users.csv")
+
+	err = runExport([]string{"-in", pagePath, "-out", out})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original, err := readColonists(in, "csv")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exported, err := readColonists(out, "csv")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(exported, original) {
+		t.Fatalf("round trip changed the colonists:\n%+v\n%+v", original, exported)
+	}
+}
+
+func TestExportPrefersCompositeCopies(t *testing.T) {
+	dir := t.TempDir()
+	// The legacy copy of alice comes first in one page, and after the
+	// composite copy of bob in another.
+	legacyPage := writeTestFile(t, "legacy.json", `[{"key":"user_alice","value":{"metadataHash":"old-a"}},{"key":"user_carl","value":{"metadataHash":"h3"}}]`)
+	page := writeTestFile(t, "page.json", `{"records":[{"key":"\u0000identity~user\u0000alice\u0000","value":{"metadataHash":"h1"}},{"key":"\u0000identity~user\u0000bob\u0000","value":{"metadataHash":"h2"}}]}`)
+	laterLegacyPage := writeTestFile(t, "later.json", `[{"key":"user_bob","value":{"metadataHash":"old-b"}}]`)
+	out := filepath.Join(dir, "users.json")
+
+	err := runExport([]string{"-in", legacyPage, "-in", page, "-in", laterLegacyPage, "-out", out})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(out)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rows []map[string]interface{}
+	err = json.Unmarshal(data, &rows)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hashes := map[string]interface{}{}
+
+	for _, row := range rows {
+		hashes[row["userId"].(string)] = row["metadataHash"]
+	}
+
+	expected := map[string]interface{}{"alice": "h1", "bob": "h2", "carl": "h3"}
+
+	if len(rows) != 3 || !reflect.DeepEqual(hashes, expected) {
+		t.Fatalf("expected one current row per user, got %s", data)
+	}
+}
+
+func TestExportChecksFormatBeforeWriting(t *testing.T) {
+	dir := t.TempDir()
+	in := writeTestFile(t, "page.json", `{"records":[]}`)
+	out := filepath.Join(dir, "users.xml")
+
+	err := runExport([]string{"-in", in, "-out", out})
+
+	if err == nil || err.Error() != "unknown output format: xml" {
+		t.Fatalf("expected an unknown format error, got %v", err)
+	}
+
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Fatalf("expected no output file, got %v", err)
+	}
+}
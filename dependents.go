@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// validateGuardianship checks the guardians and majority time of a new
+// dependent. Guardians must be existing users, or users issued earlier in the
+// same batch, who are not dependents themselves.
+func validateGuardianship(stub shim.ChaincodeStubInterface, userId string, guardians []string, majorityAt int64, now int64, batch map[string]*User) error {
+	for i, guardianId := range guardians {
+		if guardianId == userId || containsString(guardians[:i], guardianId) {
+			return newError(codeInvalidArgument, "Invalid guardian: "+guardianId)
+		}
+
+		guardian, ok := batch[guardianId]
+
+		if !ok {
+			var err error
+			guardian, err = loadUser(stub, guardianId)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if guardian == nil {
+			return newError(codeNotFound, "Guardian not found: "+guardianId)
+		}
+
+		if len(guardian.Guardians) > 0 {
+			return newError(codeInvalidArgument, "Guardian is a dependent: "+guardianId)
+		}
+	}
+
+	if majorityAt <= now {
+		return newError(codeInvalidArgument, "Majority time must be in the future")
+	}
+
+	return nil
+}
+
+// promoteDependent hands a dependent who has come of age control of their own
+// key. It is called by the identity authority with the person's new public key
+// and a signature made with that key, proving they hold it.
+func (t *IdentityChaincode) promoteDependent(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return incorrectArgumentCount()
+	}
+
+	user, err := loadUser(stub, args[0])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if user == nil {
+		return notFound("User not found")
+	}
+
+	if len(user.Guardians) == 0 {
+		return failedPrecondition("User is not a dependent")
+	}
+
+	now, err := txTime(stub)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if now < user.MajorityAt {
+		return failedPrecondition("Dependent has not come of age")
+	}
+
+	err = verifySignature(args[1], signedMessage("promoteDependent", args[0], args[1], strconv.Itoa(user.Nonce)), args[2])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	user.PublicKey = args[1]
+	user.Guardians = nil
+	user.MajorityAt = 0
+	user.Nonce++
+
+	err = storeUser(stub, args[0], user)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(nil)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+
+	"github.com/mars-identity-chaincode/teststub"
+)
+
+// issueTestDependent issues Alice and Bob, and Kim as their dependent who
+// comes of age in a day. It returns the keys of Alice and Bob.
+func issueTestDependent(t *testing.T, stub *teststub.Stub) map[string]*secp256k1.PrivateKey {
+	keys := map[string]*secp256k1.PrivateKey{}
+
+	for _, userId := range []string{"alice", "bob"} {
+		keys[userId] = newTestKey(t)
+		expectStatus(t, stub.Invoke("issueIdentity", userId, testPublicKey(keys[userId]), "hash-"+userId), shim.OK)
+	}
+
+	majorityAt := strconv.FormatInt(stub.Now().Add(24*time.Hour).Unix(), 10)
+	expectStatus(t, stub.Invoke("issueIdentity", "kim", "", "hash-kim", `["alice","bob"]`, majorityAt), shim.OK)
+
+	return keys
+}
+
+// setTestMetadataHash sets the metadata hash of userId, signed by signerId
+// with key at the user's nonce.
+func setTestMetadataHash(t *testing.T, stub *teststub.Stub, userId string, hash string, signerId string, key *secp256k1.PrivateKey, nonce int) pb.Response {
+	args := []string{userId, hash, signerId}
+	signature := signTestMessage(t, key, "setUserMetadataHash", append(args, strconv.Itoa(nonce))...)
+
+	return stub.Invoke(append(append([]string{"setUserMetadataHash"}, args...), signature)...)
+}
+
+func getTestUser(t *testing.T, stub *teststub.Stub, userId string) User {
+	t.Helper()
+	response := stub.Invoke("getIdentity", userId)
+	expectStatus(t, response, shim.OK)
+
+	var user User
+	err := json.Unmarshal(response.Payload, &user)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
+
+func TestGuardianSignsForDependentUntilMajority(t *testing.T) {
+	stub := newTestStub(t)
+	keys := issueTestDependent(t, stub)
+	kimKey := newTestKey(t)
+
+	expectStatus(t, setTestMetadataHash(t, stub, "kim", "hash2", "alice", keys["alice"], 0), shim.OK)
+	expectStatus(t, setTestMetadataHash(t, stub, "kim", "hash3", "bob", keys["bob"], 1), shim.OK)
+
+	if user := getTestUser(t, stub, "kim"); user.MetadataHash != "hash3" || user.Nonce != 2 {
+		t.Fatalf("unexpected dependent %+v", user)
+	}
+
+	// Only a guardian signs for a dependent, and with their own key.
+	expectError(t, setTestMetadataHash(t, stub, "kim", "hash4", "kim", kimKey, 2), codeUnauthorized)
+	expectError(t, setTestMetadataHash(t, stub, "kim", "hash4", "alice", keys["bob"], 2), codeUnauthorized)
+
+	// A guardian's signature no longer counts once the dependent comes of age.
+	stub.Advance(24 * time.Hour)
+	expectError(t, setTestMetadataHash(t, stub, "kim", "hash4", "alice", keys["alice"], 2), codeFailedPrecondition)
+
+	if user := getTestUser(t, stub, "kim"); user.MetadataHash != "hash3" {
+		t.Fatalf("a guardian acted after majority: %+v", user)
+	}
+}
+
+func TestPromoteDependent(t *testing.T) {
+	stub := newTestStub(t)
+	keys := issueTestDependent(t, stub)
+	kimKey, otherKey := newTestKey(t), newTestKey(t)
+	promotion := []string{"kim", testPublicKey(kimKey)}
+	signature := signTestMessage(t, kimKey, "promoteDependent", append(promotion, "0")...)
+
+	// Promotion waits for the dependent to come of age.
+	expectError(t, stub.Invoke(append(append([]string{"promoteDependent"}, promotion...), signature)...), codeFailedPrecondition)
+
+	stub.Advance(24 * time.Hour)
+
+	// The signature must be made with the new key.
+	wrongSignature := signTestMessage(t, otherKey, "promoteDependent", append(promotion, "0")...)
+	expectError(t, stub.Invoke(append(append([]string{"promoteDependent"}, promotion...), wrongSignature)...), codeUnauthorized)
+
+	stub.SetCreator(testOtherMspId)
+	expectError(t, stub.Invoke(append(append([]string{"promoteDependent"}, promotion...), signature)...), codeUnauthorized)
+	stub.SetCreator(testAuthorityMspId)
+
+	expectStatus(t, stub.Invoke(append(append([]string{"promoteDependent"}, promotion...), signature)...), shim.OK)
+
+	if user := getTestUser(t, stub, "kim"); user.PublicKey != testPublicKey(kimKey) || len(user.Guardians) != 0 || user.MajorityAt != 0 || user.Nonce != 1 {
+		t.Fatalf("unexpected promoted user %+v", user)
+	}
+
+	// Kim now signs with their own key, and their former guardians cannot.
+	expectStatus(t, setTestMetadataHash(t, stub, "kim", "hash2", "kim", kimKey, 1), shim.OK)
+	expectError(t, setTestMetadataHash(t, stub, "kim", "hash3", "alice", keys["alice"], 2), codeUnauthorized)
+
+	// An adult cannot be promoted.
+	expectError(t, stub.Invoke(append(append([]string{"promoteDependent"}, promotion...), signature)...), codeFailedPrecondition)
+}
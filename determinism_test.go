@@ -0,0 +1,172 @@
+package main
+
+import (
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+
+	"github.com/mars-identity-chaincode/teststub"
+)
+
+// determinismRuns is how many times each transaction is checked, since
+// differences from map iteration order only show on some runs.
+const determinismRuns = 5
+
+type determinismKeys struct {
+	alice, carol, dave, bank, newKey *secp256k1.PrivateKey
+}
+
+// newDeterminismFixture returns a function that builds a stub holding users,
+// a dependent, a service provider, a pending registration request and
+// recovery contacts, identically every time.
+func newDeterminismFixture(t *testing.T, keys determinismKeys) func() *teststub.Stub {
+	return func() *teststub.Stub {
+		stub := teststub.New("identity", new(IdentityChaincode))
+		stub.SetTime(time.Unix(1700000000, 0))
+		stub.SetCreator(testAuthorityMspId)
+		expectStatus(t, stub.Init(), shim.OK)
+
+		expectStatus(t, stub.Invoke("issueIdentity", "alice", testPublicKey(keys.alice), "hash-alice"), shim.OK)
+		expectStatus(t, stub.Invoke("issueIdentity", "carol", testPublicKey(keys.carol), "hash-carol"), shim.OK)
+		expectStatus(t, stub.Invoke("issueIdentity", "dave", testPublicKey(keys.dave), "hash-dave"), shim.OK)
+
+		expectStatus(t, stub.Invoke("issueIdentity", "bobby", "", "hash-bobby", `["alice"]`, "4102444800"), shim.OK)
+		expectStatus(t, stub.Invoke("addServiceProvider", "bank", "Bank", testPublicKey(keys.bank), "finance", `["publicKey"]`, "", "BankMSP"), shim.OK)
+
+		stub.SetCreator(testOtherMspId)
+		expectStatus(t, stub.Invoke("requestServiceProviderRegistration", "clinic", "Clinic", testPublicKey(keys.dave), "healthcare", `["publicKey"]`, ""), shim.OK)
+
+		contacts := []string{"alice", `["carol","dave"]`, "2", "alice"}
+		expectStatus(t, stub.Invoke(append(append([]string{"setRecoveryContacts"}, contacts...), signTestMessage(t, keys.alice, "setRecoveryContacts", append(contacts, "0")...))...), shim.OK)
+		stub.SetCreator(testAuthorityMspId)
+		stub.Advance(time.Hour)
+
+		return stub
+	}
+}
+
+func TestEndorsementsAreDeterministic(t *testing.T) {
+	keys := determinismKeys{newTestKey(t), newTestKey(t), newTestKey(t), newTestKey(t), newTestKey(t)}
+	newStub := newDeterminismFixture(t, keys)
+	newPublicKey := testPublicKey(keys.newKey)
+
+	recoveryMessage := []string{"alice", newPublicKey, "1"}
+	approvals := `[{"contactId":"carol","signature":"` + signTestMessage(t, keys.carol, "approveRecovery", recoveryMessage...) +
+		`"},{"contactId":"dave","signature":"` + signTestMessage(t, keys.dave, "approveRecovery", recoveryMessage...) + `"}]`
+	providerKey := []string{"bank", "secondary", newPublicKey, "signing", "", "", "primary"}
+
+	tests := [][]string{
+		{"issueIdentity", "erin", newPublicKey, "hash-erin"},
+		{"batchIssueIdentities", `[{"userId":"erin","publicKey":"` + newPublicKey + `","metadataHash":"h1"},{"userId":"fay","metadataHash":"h2","guardians":["erin","alice"],"majorityAt":4102444800},{"userId":"gus","publicKey":"` + newPublicKey + `","metadataHash":"h3"}]`},
+		{"batchIssueIdentities", `[{"userId":"alice"},{"userId":"erin","guardians":["nobody"]},{"userId":"erin"}]`},
+		{"issueIdentity", `{"userId":"erin","zeta":1,"alpha":2,"mu":3}`},
+		{"addServiceProvider", "shop", "Shop", newPublicKey, "habitat", `["publicKey"]`, "", "ShopMSP"},
+		{"approveServiceProvider", "clinic"},
+		{"rejectServiceProvider", "clinic", "Incomplete"},
+		{"renewIdentity", "alice"},
+		{"rotateUserKey", "alice", newPublicKey, "alice", signTestMessage(t, keys.alice, "rotateUserKey", "alice", newPublicKey, "alice", "1")},
+		{"setUserMetadataHash", "bobby", "hash-new", "alice", signTestMessage(t, keys.alice, "setUserMetadataHash", "bobby", "hash-new", "alice", "0")},
+		{"updateUserMetadataHash", "bobby", "hash-fixed"},
+		{"initiateRecovery", "alice", newPublicKey, approvals},
+		{"addProviderKey", "bank", "secondary", newPublicKey, "signing", "", "", "primary", signTestMessage(t, keys.bank, "addProviderKey", providerKey...)},
+		{"getIdentity", "bobby"},
+		{"getRecovery", "alice"},
+		{"listServiceProviderRequests"},
+		{"getRegistryStats"},
+		{"queryIdentities", `{"status":"active"}`, "2", ""},
+		{"exportRecords", "user", "3", ""},
+		{"listPendingMigrations", "user", "10", ""},
+		{"migrate", "user", `["alice","bobby"]`},
+		{"migrateKeys", "user", "10"},
+		{"compactStats", "100", ""},
+		{"getMetadata"},
+	}
+
+	for _, args := range tests {
+		t.Run(args[0], func(t *testing.T) {
+			for i := 0; i < determinismRuns; i++ {
+				err := teststub.CheckDeterminism(newStub, args...)
+
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// nondeterministicCalls lists functions whose results differ between peers
+// or between runs, by import path.
+var nondeterministicCalls = map[string]map[string]bool{
+	"time": {"Now": true, "Since": true, "Until": true, "After": true, "Tick": true, "NewTimer": true, "NewTicker": true},
+	"os":   {"Getenv": true, "LookupEnv": true, "Environ": true, "Hostname": true, "Getpid": true, "ReadFile": true, "Open": true},
+}
+
+// nondeterministicPackages may not be used by the chaincode at all.
+var nondeterministicPackages = map[string]bool{
+	"math/rand":   true,
+	"crypto/rand": true,
+	"net":         true,
+	"net/http":    true,
+}
+
+// TestChaincodeAvoidsNondeterministicCalls flags what CheckDeterminism cannot
+// catch when both endorsements run in the same second on the same machine:
+// the wall clock, randomness, the environment and concurrency. Transaction
+// time comes from GetTxTimestamp. Files excluded from the chaincode build,
+// such as the gateway's main, are not inspected.
+func TestChaincodeAvoidsNondeterministicCalls(t *testing.T) {
+	fileSet := token.NewFileSet()
+	packages, err := parser.ParseDir(fileSet, ".", func(info os.FileInfo) bool {
+		match, _ := build.Default.MatchFile(".", info.Name())
+
+		return match && !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range packages["main"].Files {
+		imports := map[string]string{}
+
+		for _, spec := range file.Imports {
+			path, _ := strconv.Unquote(spec.Path.Value)
+			name := path[strings.LastIndex(path, "/")+1:]
+
+			if spec.Name != nil {
+				name = spec.Name.Name
+			}
+
+			if nondeterministicPackages[path] {
+				t.Errorf("%s: imports %s", fileSet.Position(spec.Pos()), path)
+			}
+
+			imports[name] = path
+		}
+
+		ast.Inspect(file, func(node ast.Node) bool {
+			switch node := node.(type) {
+			case *ast.GoStmt:
+				t.Errorf("%s: starts a goroutine", fileSet.Position(node.Pos()))
+			case *ast.SelectStmt:
+				t.Errorf("%s: selects on channels", fileSet.Position(node.Pos()))
+			case *ast.SelectorExpr:
+				if ident, ok := node.X.(*ast.Ident); ok && nondeterministicCalls[imports[ident.Name]][node.Sel.Name] {
+					t.Errorf("%s: calls %s.%s", fileSet.Position(node.Pos()), imports[ident.Name], node.Sel.Name)
+				}
+			}
+
+			return true
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Error codes returned in the code field of a ChaincodeError. They are stable
+// so that clients and gateways can branch on them.
+const (
+	codeInvalidArgument    = "INVALID_ARGUMENT"
+	codeUnauthorized       = "UNAUTHORIZED"
+	codeNotFound           = "NOT_FOUND"
+	codeAlreadyExists      = "ALREADY_EXISTS"
+	codeFailedPrecondition = "FAILED_PRECONDITION"
+	codeInternal           = "INTERNAL"
+)
+
+// codeStatus maps each error code to the response status, which follows the
+// HTTP status codes so that gateways can pass it straight through.
+var codeStatus = map[string]int32{
+	codeInvalidArgument:    400,
+	codeUnauthorized:       403,
+	codeNotFound:           404,
+	codeAlreadyExists:      409,
+	codeFailedPrecondition: 412,
+	codeInternal:           shim.ERROR,
+}
+
+// ChaincodeError is the error model of the chaincode. It is serialized as
+// JSON into both the message and the payload of an error response.
+type ChaincodeError struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+func (e *ChaincodeError) Error() string {
+	return e.Message
+}
+
+func newError(code string, message string) *ChaincodeError {
+	return &ChaincodeError{Code: code, Message: message}
+}
+
+// errorResponse builds the response for err. Errors that are not a
+// ChaincodeError, such as those from the ledger, are reported as INTERNAL.
+func errorResponse(err error) pb.Response {
+	chaincodeError, ok := err.(*ChaincodeError)
+
+	if !ok {
+		chaincodeError = newError(codeInternal, err.Error())
+	}
+
+	errorJson, marshalErr := json.Marshal(chaincodeError)
+
+	if marshalErr != nil {
+		return shim.Error(err.Error())
+	}
+
+	return pb.Response{Status: codeStatus[chaincodeError.Code], Message: string(errorJson), Payload: errorJson}
+}
+
+// withContext prefixes the message of err, keeping its code.
+func withContext(prefix string, err error) error {
+	if chaincodeError, ok := err.(*ChaincodeError); ok {
+		return &ChaincodeError{Code: chaincodeError.Code, Message: prefix + chaincodeError.Message, Details: chaincodeError.Details}
+	}
+
+	return newError(codeInternal, prefix+err.Error())
+}
+
+func invalidArgument(message string) pb.Response {
+	return errorResponse(newError(codeInvalidArgument, message))
+}
+
+func unauthorized() pb.Response {
+	return errorResponse(newError(codeUnauthorized, "You are not authorized"))
+}
+
+func notFound(message string) pb.Response {
+	return errorResponse(newError(codeNotFound, message))
+}
+
+func alreadyExists(message string) pb.Response {
+	return errorResponse(newError(codeAlreadyExists, message))
+}
+
+func failedPrecondition(message string) pb.Response {
+	return errorResponse(newError(codeFailedPrecondition, message))
+}
+
+func incorrectArgumentCount() pb.Response {
+	return invalidArgument("Incorrect number of arguments.")
+}
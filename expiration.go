@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	statusActive  = "active"
+	statusExpired = "expired"
+
+	// identityValidityYears is how long an identity stays valid after it is
+	// issued or renewed. Colony rules require re-verification every five years.
+	identityValidityYears = 5
+)
+
+// defaultValidUntil returns the end of validity of an identity issued or
+// renewed at now.
+func defaultValidUntil(now int64) int64 {
+	return time.Unix(now, 0).UTC().AddDate(identityValidityYears, 0, 0).Unix()
+}
+
+// identityStatus returns the status of user at now. Expiry is derived from
+// ValidUntil rather than stored, so it never needs a transaction to take effect.
+func identityStatus(user *User, now int64) string {
+	if user.ValidUntil != 0 && now >= user.ValidUntil {
+		return statusExpired
+	}
+
+	if user.Status == "" {
+		return statusActive
+	}
+
+	return user.Status
+}
+
+// checkIdentityActive returns an error unless user is active at the
+// transaction time.
+func checkIdentityActive(stub shim.ChaincodeStubInterface, user *User) error {
+	now, err := txTime(stub)
+
+	if err != nil {
+		return err
+	}
+
+	status := identityStatus(user, now)
+
+	if status != statusActive {
+		return newError(codeFailedPrecondition, "Identity is "+status)
+	}
+
+	return nil
+}
+
+// renewIdentity extends a user's validity. It takes the user ID and an
+// optional Unix time, defaulting to five years from now.
+func (t *IdentityChaincode) renewIdentity(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 && len(args) != 2 {
+		return incorrectArgumentCount()
+	}
+
+	user, err := loadUser(stub, args[0])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if user == nil {
+		return notFound("User not found")
+	}
+
+	now, err := txTime(stub)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	validUntil := defaultValidUntil(now)
+
+	if len(args) == 2 {
+		validUntil, err = parseTimestampArg(args[1])
+
+		if err != nil {
+			return errorResponse(err)
+		}
+
+		if validUntil <= now {
+			return invalidArgument("Validity must end in the future")
+		}
+	}
+
+	deltas := statDeltas{}
+	deltas.moveExpiry(user.ValidUntil, validUntil)
+	user.ValidUntil = validUntil
+	err = storeUser(stub, args[0], user)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	err = deltas.write(stub)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(nil)
+}
+
+// IdentityVerification is the result of verifyIdentity.
+type IdentityVerification struct {
+	Valid  bool   `json:"valid"`
+	Status string `json:"status"`
+}
+
+// verifyIdentity checks a message signed by a user. The signature is only
+// valid while the identity is active.
+func (t *IdentityChaincode) verifyIdentity(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return incorrectArgumentCount()
+	}
+
+	user, err := loadUser(stub, args[0])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if user == nil {
+		return notFound("User not found")
+	}
+
+	now, err := txTime(stub)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	var verification IdentityVerification
+	verification.Status = identityStatus(user, now)
+	verification.Valid = verification.Status == statusActive && verifySignature(user.PublicKey, args[1], args[2]) == nil
+
+	verificationJson, err := json.Marshal(verification)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(verificationJson)
+}
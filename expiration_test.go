@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestRenewIdentity(t *testing.T) {
+	stub := newTestStub(t)
+	expectStatus(t, stub.Invoke("issueIdentity", "alice", newTestPublicKey(t), "hash1"), shim.OK)
+	stub.Advance(365 * 24 * time.Hour)
+
+	// Without a validity end, the identity is renewed for five years.
+	expectStatus(t, stub.Invoke("renewIdentity", "alice"), shim.OK)
+
+	if user := getTestUser(t, stub, "alice"); user.ValidUntil != defaultValidUntil(stub.Now().Unix()) {
+		t.Fatalf("expected validity to end five years from now, got %d", user.ValidUntil)
+	}
+
+	validUntil := stub.Now().Add(30 * 24 * time.Hour).Unix()
+	expectStatus(t, stub.Invoke("renewIdentity", "alice", strconv.FormatInt(validUntil, 10)), shim.OK)
+
+	if user := getTestUser(t, stub, "alice"); user.ValidUntil != validUntil {
+		t.Fatalf("expected validity to end at %d, got %d", validUntil, user.ValidUntil)
+	}
+
+	// The JSON form may leave the validity end out too.
+	expectStatus(t, stub.Invoke("renewIdentity", `{"userId":"alice"}`), shim.OK)
+
+	if user := getTestUser(t, stub, "alice"); user.ValidUntil != defaultValidUntil(stub.Now().Unix()) {
+		t.Fatalf("expected validity to end five years from now, got %d", user.ValidUntil)
+	}
+
+	expectError(t, stub.Invoke("renewIdentity", "alice", strconv.FormatInt(stub.Now().Unix(), 10)), codeInvalidArgument)
+	expectError(t, stub.Invoke("renewIdentity", "alice", "soon"), codeInvalidArgument)
+	expectError(t, stub.Invoke("renewIdentity", "bob"), codeNotFound)
+
+	stub.SetCreator(testOtherMspId)
+	expectError(t, stub.Invoke("renewIdentity", "alice"), codeUnauthorized)
+	expectError(t, stub.Invoke("renewIdentity", "alice", strconv.FormatInt(validUntil, 10)), codeUnauthorized)
+}
+
+func TestExpiredIdentity(t *testing.T) {
+	stub := newTestStub(t)
+	key := newTestKey(t)
+	expectStatus(t, stub.Invoke("issueIdentity", "alice", testPublicKey(key), "hash1"), shim.OK)
+
+	verify := func() IdentityVerification {
+		response := stub.Invoke("verifyIdentity", "alice", signedMessage("hello"), signTestMessage(t, key, "hello"))
+		expectStatus(t, response, shim.OK)
+
+		var verification IdentityVerification
+		err := json.Unmarshal(response.Payload, &verification)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return verification
+	}
+
+	if verification := verify(); !verification.Valid || verification.Status != statusActive {
+		t.Fatalf("unexpected verification %+v", verification)
+	}
+
+	stub.SetTime(time.Unix(getTestUser(t, stub, "alice").ValidUntil, 0))
+
+	if user := getTestUser(t, stub, "alice"); user.Status != statusExpired {
+		t.Fatalf("expected alice to be expired, got %s", user.Status)
+	}
+
+	if verification := verify(); verification.Valid || verification.Status != statusExpired {
+		t.Fatalf("expected an expired identity to fail verification, got %+v", verification)
+	}
+
+	expectError(t, setTestMetadataHash(t, stub, "alice", "hash2", "alice", key, 0), codeFailedPrecondition)
+
+	expectStatus(t, stub.Invoke("renewIdentity", "alice"), shim.OK)
+
+	if verification := verify(); !verification.Valid || verification.Status != statusActive {
+		t.Fatalf("expected a renewed identity to verify, got %+v", verification)
+	}
+
+	expectStatus(t, setTestMetadataHash(t, stub, "alice", "hash2", "alice", key, 0), shim.OK)
+}
+
+func TestUsersWithoutValidityEndExpireFiveYearsAfterIssuance(t *testing.T) {
+	stub := newTestStub(t)
+	now := stub.Now()
+
+	// Both users were stored before validity was, one issued six years ago and
+	// one a year ago.
+	issuedAt := map[string]int64{
+		"alice": now.AddDate(-6, 0, 0).Unix(),
+		"bob":   now.AddDate(-1, 0, 0).Unix(),
+	}
+
+	for userId, issued := range issuedAt {
+		key, err := stub.CreateCompositeKey(userObjectType, []string{userId})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stub.Seed(key, []byte(`{"docType":"user","version":2,"status":"active","publicKey":"`+newTestPublicKey(t)+`","issuedAt":`+strconv.FormatInt(issued, 10)+`}`))
+	}
+
+	if user := getTestUser(t, stub, "alice"); user.Status != statusExpired || user.ValidUntil != defaultValidUntil(issuedAt["alice"]) {
+		t.Fatalf("expected alice to be expired, got %+v", user)
+	}
+
+	if user := getTestUser(t, stub, "bob"); user.Status != statusActive || user.ValidUntil != defaultValidUntil(issuedAt["bob"]) {
+		t.Fatalf("expected bob to be active, got %+v", user)
+	}
+
+	// The migration stores the validity end.
+	expectStatus(t, stub.Invoke("migrate", "user", `["alice","bob"]`), shim.OK)
+
+	for userId, issued := range issuedAt {
+		var user User
+		err := json.Unmarshal(storedRecord(t, stub, userObjectType, userId), &user)
+
+		if err != nil || user.ValidUntil != defaultValidUntil(issued) {
+			t.Fatalf("%s was stored without its validity end: %+v %v", userId, user, err)
+		}
+	}
+}
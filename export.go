@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// maxExportPageSize bounds the number of records exportRecords returns per page.
+const maxExportPageSize = 1000
+
+// ExportedRecord is a raw ledger entry returned by exportRecords.
+type ExportedRecord struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ExportPage is one page of exportRecords. Bookmark is passed to the next
+// call and is empty once every record has been returned.
+type ExportPage struct {
+	Records  []ExportedRecord `json:"records"`
+	Bookmark string           `json:"bookmark"`
+}
+
+var exportObjectTypes = map[string]string{
+	"user": userObjectType,
+	"sp":   spObjectType,
+}
+
+// exportRecords dumps the raw user or service provider records, a page at a
+// time, for offline tooling. It takes the record type, user or sp, the page
+// size and the bookmark of the previous page. Only records under composite
+// keys are exported, so records still under legacy keys must be moved with
+// migrateKeys first.
+func (t *IdentityChaincode) exportRecords(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return incorrectArgumentCount()
+	}
+
+	objectType, ok := exportObjectTypes[args[0]]
+
+	if !ok {
+		return invalidArgument("Unknown record type: " + args[0])
+	}
+
+	pageSize, err := strconv.Atoi(args[1])
+
+	if err != nil || pageSize < 1 || pageSize > maxExportPageSize {
+		return invalidArgument("Page size must be between 1 and " + strconv.Itoa(maxExportPageSize))
+	}
+
+	iterator, metadata, err := stub.GetStateByPartialCompositeKeyWithPagination(objectType, []string{}, int32(pageSize), args[2])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	defer iterator.Close()
+
+	page := ExportPage{Records: []ExportedRecord{}}
+
+	for iterator.HasNext() {
+		kv, err := iterator.Next()
+
+		if err != nil {
+			return errorResponse(err)
+		}
+
+		page.Records = append(page.Records, ExportedRecord{kv.Key, kv.Value})
+	}
+
+	if len(page.Records) == pageSize {
+		page.Bookmark = metadata.Bookmark
+	}
+
+	pageJson, err := json.Marshal(page)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(pageJson)
+}
@@ -0,0 +1,28 @@
+package gateway
+
+import "errors"
+
+// FabricConfig says how FabricInvoker reaches the chaincode on a Fabric
+// network.
+type FabricConfig struct {
+	// ConfigFile is the path of the SDK's connection profile, which lists
+	// the peers, orderers and certificate authorities of the network and
+	// where the member's credentials are stored.
+	ConfigFile string
+
+	// Org and User name the member identity the gateway calls as. The
+	// chaincode sees the MSP of Org as the caller of every request.
+	Org  string
+	User string
+
+	ChannelId   string
+	ChaincodeId string
+}
+
+func (config FabricConfig) validate() error {
+	if config.ConfigFile == "" || config.Org == "" || config.User == "" || config.ChannelId == "" || config.ChaincodeId == "" {
+		return errors.New("the connection profile, organization, user, channel and chaincode are all required")
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+//go:build !fabricsdk
+// +build !fabricsdk
+
+package gateway
+
+import (
+	"errors"
+
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// errNoFabricSdk is returned in builds without the fabricsdk tag, which
+// leave the Fabric SDK out.
+var errNoFabricSdk = errors.New("the gateway was built without the Fabric SDK; build it with -tags fabricsdk")
+
+// FabricInvoker sends calls to the chaincode on a Fabric network through the
+// Fabric SDK, in builds with the fabricsdk tag.
+type FabricInvoker struct {
+}
+
+// NewFabricInvoker fails, since this build leaves the Fabric SDK out.
+func NewFabricInvoker(config FabricConfig) (*FabricInvoker, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	return nil, errNoFabricSdk
+}
+
+// Close releases the SDK's connections.
+func (invoker *FabricInvoker) Close() {
+}
+
+func (invoker *FabricInvoker) Submit(input *pb.ChaincodeInput, transient map[string][]byte) (pb.Response, error) {
+	return pb.Response{}, errNoFabricSdk
+}
+
+func (invoker *FabricInvoker) Evaluate(input *pb.ChaincodeInput, transient map[string][]byte) (pb.Response, error) {
+	return pb.Response{}, errNoFabricSdk
+}
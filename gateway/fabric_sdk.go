@@ -0,0 +1,81 @@
+//go:build fabricsdk
+// +build fabricsdk
+
+package gateway
+
+import (
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+	sdkconfig "github.com/hyperledger/fabric-sdk-go/pkg/core/config"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// FabricInvoker sends calls to the chaincode on a Fabric network through the
+// Fabric SDK, as one member identity. Submitted calls are endorsed, ordered
+// and waited for until they commit, and evaluated calls are queried on a
+// peer. It cannot impersonate other members.
+type FabricInvoker struct {
+	sdk         *fabsdk.FabricSDK
+	channel     *channel.Client
+	chaincodeId string
+}
+
+// NewFabricInvoker connects to the network described by config.
+func NewFabricInvoker(config FabricConfig) (*FabricInvoker, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	sdk, err := fabsdk.New(sdkconfig.FromFile(config.ConfigFile))
+
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := channel.New(sdk.ChannelContext(config.ChannelId, fabsdk.WithOrg(config.Org), fabsdk.WithUser(config.User)))
+
+	if err != nil {
+		sdk.Close()
+		return nil, err
+	}
+
+	return &FabricInvoker{sdk: sdk, channel: client, chaincodeId: config.ChaincodeId}, nil
+}
+
+// Close releases the SDK's connections.
+func (invoker *FabricInvoker) Close() {
+	invoker.sdk.Close()
+}
+
+func (invoker *FabricInvoker) Submit(input *pb.ChaincodeInput, transient map[string][]byte) (pb.Response, error) {
+	return invoker.send(invoker.channel.Execute, input, transient)
+}
+
+func (invoker *FabricInvoker) Evaluate(input *pb.ChaincodeInput, transient map[string][]byte) (pb.Response, error) {
+	return invoker.send(invoker.channel.Query, input, transient)
+}
+
+func (invoker *FabricInvoker) send(call func(channel.Request, ...channel.RequestOption) (channel.Response, error), input *pb.ChaincodeInput, transient map[string][]byte) (pb.Response, error) {
+	request := channel.Request{ChaincodeID: invoker.chaincodeId, TransientMap: transient}
+
+	if len(input.Args) > 0 {
+		request.Fcn = string(input.Args[0])
+		request.Args = input.Args[1:]
+	}
+
+	response, err := call(request)
+
+	if err != nil {
+		// Error responses of the chaincode fail endorsement, and the SDK
+		// reports them with the chaincode's status and message, which
+		// holds the chaincode's error as JSON.
+		if chaincodeStatus, ok := status.FromError(err); ok && chaincodeStatus.Group == status.ChaincodeStatus {
+			return pb.Response{Status: chaincodeStatus.Code, Message: chaincodeStatus.Message, Payload: []byte(chaincodeStatus.Message)}, nil
+		}
+
+		return pb.Response{}, err
+	}
+
+	return pb.Response{Status: response.ChaincodeStatus, Payload: response.Payload}, nil
+}
@@ -0,0 +1,179 @@
+// Package gateway serves the identity chaincode as an HTTP/JSON API, for
+// applications that cannot speak the Fabric gRPC protocols.
+//
+// Identities, service providers, consented lookups and signature
+// verification are exposed as REST resources, listed in routes.go and
+// described by the OpenAPI document that OpenAPI returns. Each request is
+// turned into one chaincode call through the client package and sent by an
+// Invoker: FabricInvoker sends it to a Fabric network through the Fabric SDK,
+// and StubInvoker runs the chaincode in process for local development and
+// tests.
+//
+// Errors use the chaincode's error model, {"code":"...","message":"..."},
+// with the chaincode's status.
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/mars-identity-chaincode/client"
+)
+
+// Invoker sends the gateway's calls to the chaincode as the member that runs
+// the gateway. It has the methods of client.Transport.
+type Invoker interface {
+	client.Transport
+}
+
+// Impersonator is implemented by invokers that can call the chaincode as any
+// member MSP, such as StubInvoker. A server with Impersonation set then calls
+// as the MSP named in the X-Msp-Id header, so that one local gateway can act
+// for the identity authority and for service providers.
+type Impersonator interface {
+	As(mspId string) Invoker
+}
+
+// mspIdHeader names the MSP an Impersonator calls as.
+const mspIdHeader = "X-Msp-Id"
+
+// Server is an http.Handler that serves the API of the chaincode.
+type Server struct {
+	invoker Invoker
+
+	// Impersonation lets each request name the MSP to call as in its
+	// X-Msp-Id header, if the invoker is an Impersonator. Any HTTP caller can
+	// then act as any member, including the identity authority, so it is
+	// only for local development.
+	Impersonation bool
+}
+
+// NewServer returns a server that calls the chaincode through invoker, as
+// the member the invoker calls as.
+func NewServer(invoker Invoker) *Server {
+	return &Server{invoker: invoker}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == openAPIPath {
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, []string{http.MethodGet})
+			return
+		}
+
+		writeJson(w, http.StatusOK, OpenAPI())
+		return
+	}
+
+	var allowed []string
+
+	for _, route := range routes {
+		params, ok := route.match(r.URL.Path)
+
+		if !ok {
+			continue
+		}
+
+		if route.method != r.Method {
+			allowed = append(allowed, route.method)
+			continue
+		}
+
+		result, err := route.handle(s.client(r), &request{http: r, params: params})
+
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		if result == nil {
+			w.WriteHeader(route.status)
+			return
+		}
+
+		writeJson(w, route.status, result)
+		return
+	}
+
+	if allowed != nil {
+		writeMethodNotAllowed(w, allowed)
+		return
+	}
+
+	writeError(w, &client.Error{Status: http.StatusNotFound, Code: client.CodeNotFound, Message: "No resource at " + r.URL.Path})
+}
+
+// client returns the client for r, calling as the MSP in its X-Msp-Id header
+// if impersonation is enabled and the invoker can impersonate members.
+func (s *Server) client(r *http.Request) *client.Client {
+	invoker := s.invoker
+
+	if impersonator, ok := invoker.(Impersonator); ok && s.Impersonation && r.Header.Get(mspIdHeader) != "" {
+		invoker = impersonator.As(r.Header.Get(mspIdHeader))
+	}
+
+	return client.New(invoker)
+}
+
+// request is an HTTP request matched to a route, with its path parameters.
+type request struct {
+	http   *http.Request
+	params map[string]string
+}
+
+// param returns the path parameter name.
+func (r *request) param(name string) string {
+	return r.params[name]
+}
+
+// query returns the query parameter name.
+func (r *request) query(name string) string {
+	return r.http.URL.Query().Get(name)
+}
+
+// decode decodes the JSON body of the request into body. Unknown fields are
+// rejected, as the chaincode rejects them in JSON arguments.
+func (r *request) decode(body interface{}) error {
+	decoder := json.NewDecoder(r.http.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(body)
+
+	if err != nil {
+		return invalidBody(err.Error())
+	}
+
+	return nil
+}
+
+func invalidBody(message string) error {
+	return &client.Error{Status: http.StatusBadRequest, Code: client.CodeInvalidArgument, Message: "Invalid request body: " + message}
+}
+
+func invalidQuery(message string) error {
+	return &client.Error{Status: http.StatusBadRequest, Code: client.CodeInvalidArgument, Message: "Invalid query: " + message}
+}
+
+func writeJson(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeError writes a chaincode error with its status. Other errors mean the
+// invoker could not reach the chaincode or the transaction was not
+// committed, and are reported as INTERNAL with status 502.
+func writeError(w http.ResponseWriter, err error) {
+	chaincodeError, ok := err.(*client.Error)
+
+	if !ok {
+		chaincodeError = &client.Error{Status: http.StatusBadGateway, Code: client.CodeInternal, Message: err.Error()}
+	}
+
+	writeJson(w, int(chaincodeError.Status), chaincodeError)
+}
+
+func writeMethodNotAllowed(w http.ResponseWriter, allowed []string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeJson(w, http.StatusMethodNotAllowed, &client.Error{Code: client.CodeInvalidArgument, Message: "Method not allowed"})
+}
@@ -0,0 +1,155 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// recordingInvoker records the call it is given and answers with response.
+type recordingInvoker struct {
+	response  pb.Response
+	submitted bool
+	args      []string
+}
+
+func (invoker *recordingInvoker) Submit(input *pb.ChaincodeInput, transient map[string][]byte) (pb.Response, error) {
+	invoker.submitted = true
+
+	return invoker.Evaluate(input, transient)
+}
+
+func (invoker *recordingInvoker) Evaluate(input *pb.ChaincodeInput, transient map[string][]byte) (pb.Response, error) {
+	invoker.args = nil
+
+	for _, arg := range input.Args {
+		invoker.args = append(invoker.args, string(arg))
+	}
+
+	return invoker.response, nil
+}
+
+func serve(invoker Invoker, method string, path string, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	NewServer(invoker).ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+
+	return recorder
+}
+
+func TestRoutes(t *testing.T) {
+	tests := []struct {
+		method   string
+		path     string
+		body     string
+		status   int
+		expected []string
+	}{
+		{"POST", "/identities", `{"userId":"alice","publicKey":"02ab","metadataHash":"h"}`, 201, []string{"issueIdentity", "alice", "02ab", "h"}},
+		{"GET", "/identities/alice/status", "", 200, []string{"getIdentity", "alice", "status"}},
+		{"PUT", "/identities/alice/key", `{"userId":"mallory","publicKey":"02cd","signerId":"alice","signature":"sig"}`, 204, []string{"rotateUserKey", "alice", "02cd", "alice", "sig"}},
+		{"PUT", "/identities/alice/validity", `{}`, 204, []string{"renewIdentity", "alice"}},
+		{"POST", "/providers/bank/keys/k1/retirement", `{"signingKeyId":"primary","signature":"sig"}`, 204, []string{"retireProviderKey", "bank", "k1", "primary", "sig"}},
+		{"GET", "/providers/bank/identities/alice?scopes=publicKey,metadataHash", "", 200, []string{"lookupIdentity", "bank", "alice", `["publicKey","metadataHash"]`}},
+		{"GET", "/providers/bank/identities/alice", "", 200, []string{"lookupIdentity", "bank", "alice", "[]"}},
+		{"GET", "/provider-registrations?status=pending&pageSize=10", "", 200, []string{"listServiceProviderRequests", "pending", "10", ""}},
+		{"POST", "/provider-registrations/bank/approval", "", 204, []string{"approveServiceProvider", "bank"}},
+	}
+
+	for _, test := range tests {
+		invoker := &recordingInvoker{response: shim.Success([]byte("{}"))}
+		recorder := serve(invoker, test.method, test.path, test.body)
+
+		if recorder.Code != test.status || !reflect.DeepEqual(invoker.args, test.expected) || invoker.submitted != (test.method != "GET") {
+			t.Fatalf("%s %s: expected %d %q, got %d %q", test.method, test.path, test.status, test.expected, recorder.Code, invoker.args)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	payload := `{"code":"NOT_FOUND","message":"User not found"}`
+	invoker := &recordingInvoker{response: pb.Response{Status: 404, Message: payload, Payload: []byte(payload)}}
+	recorder := serve(invoker, "GET", "/identities/alice", "")
+
+	if recorder.Code != 404 || strings.TrimSpace(recorder.Body.String()) != payload {
+		t.Fatalf("expected the chaincode error, got %d %s", recorder.Code, recorder.Body)
+	}
+
+	recorder = serve(invoker, "POST", "/identities", `{"userId":"alice","unknown":true}`)
+
+	if recorder.Code != 400 || !strings.Contains(recorder.Body.String(), "INVALID_ARGUMENT") || invoker.args[0] != "getIdentity" {
+		t.Fatalf("expected an invalid body, got %d %s", recorder.Code, recorder.Body)
+	}
+
+	if recorder = serve(invoker, "GET", "/colonies", ""); recorder.Code != 404 {
+		t.Fatalf("expected 404, got %d", recorder.Code)
+	}
+
+	if recorder = serve(invoker, "DELETE", "/identities/alice", ""); recorder.Code != 405 || recorder.Header().Get("Allow") != "GET" {
+		t.Fatalf("expected 405, got %d %q", recorder.Code, recorder.Header().Get("Allow"))
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	recorder := serve(&recordingInvoker{}, "GET", "/openapi.json", "")
+	var document struct {
+		Paths      map[string]map[string]json.RawMessage
+		Components struct{ Schemas map[string]json.RawMessage }
+	}
+
+	if err := json.Unmarshal(recorder.Body.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+
+	operationIds := map[string]bool{}
+
+	for _, route := range routes {
+		var operation struct {
+			OperationId string
+			Parameters  []struct{ Name, In string }
+		}
+
+		if err := json.Unmarshal(document.Paths[route.path][strings.ToLower(route.method)], &operation); err != nil {
+			t.Fatalf("%s %s: %v", route.method, route.path, err)
+		}
+
+		if operation.OperationId == "" || operationIds[operation.OperationId] {
+			t.Fatalf("%s %s: operationId %q is missing or repeated", route.method, route.path, operation.OperationId)
+		}
+
+		operationIds[operation.OperationId] = true
+
+		for _, param := range operation.Parameters {
+			if param.In == "path" && !strings.Contains(route.path, "{"+param.Name+"}") {
+				t.Fatalf("%s %s: unknown path parameter %s", route.method, route.path, param.Name)
+			}
+		}
+	}
+
+	// Every schema reference resolves.
+	for _, ref := range strings.Split(recorder.Body.String(), `"$ref":"#/components/schemas/`)[1:] {
+		name := ref[:strings.Index(ref, `"`)]
+
+		if document.Components.Schemas[name] == nil {
+			t.Fatalf("unresolved schema %s", name)
+		}
+	}
+}
+
+func TestFabricConfig(t *testing.T) {
+	config := FabricConfig{ConfigFile: "connection.yaml", Org: "AuthorityOrg", User: "gateway", ChannelId: "colony"}
+
+	if _, err := NewFabricInvoker(config); err == nil {
+		t.Fatal("expected the chaincode to be required")
+	}
+
+	config.ChaincodeId = "identity"
+
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,158 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/mars-identity-chaincode/client"
+)
+
+// openAPIPath is where the server serves its OpenAPI document.
+const openAPIPath = "/openapi.json"
+
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+// OpenAPI returns the OpenAPI 3.0 document of the API, built from the routes
+// and the Go types of their bodies. Each operation names the chaincode
+// function it calls in x-chaincode-function. Its operationId is the function
+// name, followed by the last path segment when the function serves more than
+// one route.
+func OpenAPI() map[string]interface{} {
+	schemas := openAPISchemas{}
+	paths := map[string]map[string]interface{}{}
+	functions := map[string]bool{}
+
+	for _, route := range routes {
+		operationId := route.function
+
+		if functions[route.function] {
+			segments := strings.Split(route.path, "/")
+			last := segments[len(segments)-1]
+			operationId += strings.ToUpper(last[:1]) + last[1:]
+		}
+
+		functions[route.function] = true
+
+		var parameters []interface{}
+
+		for _, segment := range strings.Split(route.path, "/") {
+			if name, ok := pathParam(segment); ok {
+				parameters = append(parameters, map[string]interface{}{"name": name, "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"}})
+			}
+		}
+
+		for _, param := range route.query {
+			parameters = append(parameters, map[string]interface{}{"name": param.name, "in": "query", "description": param.description, "schema": map[string]interface{}{"type": "string"}})
+		}
+
+		response := map[string]interface{}{"description": http.StatusText(route.status)}
+
+		if route.result != nil {
+			response["content"] = jsonContent(schemas.schema(reflect.TypeOf(route.result)))
+		}
+
+		operation := map[string]interface{}{
+			"operationId":          operationId,
+			"summary":              route.summary,
+			"tags":                 []string{route.tag},
+			"x-chaincode-function": route.function,
+			"responses": map[string]interface{}{
+				strconv.Itoa(route.status): response,
+				"default":                  map[string]interface{}{"description": "Chaincode or gateway error", "content": jsonContent(schemas.schema(reflect.TypeOf(client.Error{})))},
+			},
+		}
+
+		if parameters != nil {
+			operation["parameters"] = parameters
+		}
+
+		if route.body != nil {
+			operation["requestBody"] = map[string]interface{}{"required": true, "content": jsonContent(schemas.schema(reflect.TypeOf(route.body)))}
+		}
+
+		if paths[route.path] == nil {
+			paths[route.path] = map[string]interface{}{}
+		}
+
+		paths[route.path][strings.ToLower(route.method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Mars identity gateway",
+			"version": "1.0.0",
+			"description": "REST resources of the Mars identity chaincode. Errors carry the chaincode's error code and status. " +
+				"When the gateway runs the chaincode in process, the X-Msp-Id header names the member MSP to call as.",
+		},
+		"tags": []interface{}{
+			map[string]interface{}{"name": tagIdentities, "description": "Issuing, reading and updating identities."},
+			map[string]interface{}{"name": tagProviders, "description": "Service providers and their keys."},
+			map[string]interface{}{"name": tagConsent, "description": "The scopes granted to service providers, and lookups within them."},
+			map[string]interface{}{"name": tagVerification, "description": "Verifying messages signed by users and service providers."},
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas},
+	}
+}
+
+func jsonContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+// openAPISchemas collects the component schemas of named struct types.
+type openAPISchemas map[string]interface{}
+
+// schema returns the schema of t, referring to struct types by name.
+func (schemas openAPISchemas) schema(t reflect.Type) map[string]interface{} {
+	if t == rawMessageType {
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemas.schema(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": schemas.schema(t.Elem())}
+	case reflect.Struct:
+		if _, ok := schemas[t.Name()]; !ok {
+			schemas[t.Name()] = schemas.object(t)
+		}
+
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+
+	return map[string]interface{}{}
+}
+
+func (schemas openAPISchemas) object(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+
+		if field.PkgPath != "" || name == "-" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = schemas.schema(field.Type)
+	}
+
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
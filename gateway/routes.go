@@ -0,0 +1,318 @@
+package gateway
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mars-identity-chaincode/client"
+)
+
+// Validity is the body of a renewal. A zero ValidUntil renews the identity
+// for the chaincode's default period.
+type Validity struct {
+	ValidUntil int64 `json:"validUntil"`
+}
+
+// SignedMessage is a message and its signature, to be verified.
+type SignedMessage struct {
+	Message   string `json:"message"`
+	Signature string `json:"signature"`
+}
+
+// ProviderVerification is the result of verifying a message signed with a
+// service provider's key.
+type ProviderVerification struct {
+	Valid bool `json:"valid"`
+}
+
+// Rejection is the body of a rejected registration request.
+type Rejection struct {
+	Reason string `json:"reason"`
+}
+
+// Batch is a list of identities issued together, all or none.
+type Batch struct {
+	Identities []client.BatchIdentity `json:"identities"`
+}
+
+// route maps an HTTP method and path to one chaincode function. Path
+// parameters are written {name}. body and result are zero values of the
+// request and response bodies, or nil, and are described in the OpenAPI
+// document. IDs in the path take precedence over IDs in the body.
+type route struct {
+	method   string
+	path     string
+	tag      string
+	function string
+	summary  string
+	query    []queryParam
+	body     interface{}
+	result   interface{}
+	status   int
+	handle   func(c *client.Client, r *request) (interface{}, error)
+}
+
+// queryParam is an optional query parameter of a route.
+type queryParam struct {
+	name        string
+	description string
+}
+
+// Tags group the routes of the OpenAPI document.
+const (
+	tagIdentities   = "identities"
+	tagProviders    = "providers"
+	tagConsent      = "consent"
+	tagVerification = "verification"
+)
+
+var routes = []route{
+	{http.MethodPost, "/identities", tagIdentities, "issueIdentity", "Issues an identity, or a dependent's identity held by guardians.",
+		nil, client.IssueIdentityRequest{}, nil, http.StatusCreated,
+		func(c *client.Client, r *request) (interface{}, error) {
+			var body client.IssueIdentityRequest
+
+			if err := r.decode(&body); err != nil {
+				return nil, err
+			}
+
+			return nil, c.IssueIdentity(body)
+		}},
+	{http.MethodPost, "/identities/batch", tagIdentities, "batchIssueIdentities", "Issues every identity of a batch, or none of them.",
+		nil, Batch{}, nil, http.StatusCreated,
+		func(c *client.Client, r *request) (interface{}, error) {
+			var body Batch
+
+			if err := r.decode(&body); err != nil {
+				return nil, err
+			}
+
+			return nil, c.BatchIssueIdentities(body.Identities)
+		}},
+	{http.MethodGet, "/identities/{userId}", tagIdentities, "getIdentity", "Returns a user. Only the identity authority may read it.",
+		nil, nil, client.User{}, http.StatusOK,
+		func(c *client.Client, r *request) (interface{}, error) {
+			return c.GetIdentity(r.param("userId"))
+		}},
+	{http.MethodGet, "/identities/{userId}/status", tagIdentities, "getIdentity", "Returns the status view of a user, with the nonce to sign into user actions.",
+		nil, nil, client.IdentityStatus{}, http.StatusOK,
+		func(c *client.Client, r *request) (interface{}, error) {
+			return c.GetIdentityStatus(r.param("userId"))
+		}},
+	{http.MethodPut, "/identities/{userId}/validity", tagIdentities, "renewIdentity", "Sets the end of a user's validity.",
+		nil, Validity{}, nil, http.StatusNoContent,
+		func(c *client.Client, r *request) (interface{}, error) {
+			var body Validity
+
+			if err := r.decode(&body); err != nil {
+				return nil, err
+			}
+
+			return nil, c.RenewIdentity(r.param("userId"), body.ValidUntil)
+		}},
+	{http.MethodPut, "/identities/{userId}/key", tagIdentities, "rotateUserKey", "Replaces a user's public key, signed by the user or a guardian.",
+		nil, client.RotateUserKeyRequest{}, nil, http.StatusNoContent,
+		func(c *client.Client, r *request) (interface{}, error) {
+			var body client.RotateUserKeyRequest
+
+			if err := r.decode(&body); err != nil {
+				return nil, err
+			}
+
+			body.UserId = r.param("userId")
+
+			return nil, c.RotateUserKey(body)
+		}},
+	{http.MethodPut, "/identities/{userId}/metadata-hash", tagIdentities, "setUserMetadataHash", "Replaces the hash of a user's off-chain metadata, signed by the user or a guardian.",
+		nil, client.SetUserMetadataHashRequest{}, nil, http.StatusNoContent,
+		func(c *client.Client, r *request) (interface{}, error) {
+			var body client.SetUserMetadataHashRequest
+
+			if err := r.decode(&body); err != nil {
+				return nil, err
+			}
+
+			body.UserId = r.param("userId")
+
+			return nil, c.SetUserMetadataHash(body)
+		}},
+	{http.MethodPost, "/identities/{userId}/promotion", tagIdentities, "promoteDependent", "Hands a dependent who has come of age control of their own key.",
+		nil, client.PromoteDependentRequest{}, nil, http.StatusNoContent,
+		func(c *client.Client, r *request) (interface{}, error) {
+			var body client.PromoteDependentRequest
+
+			if err := r.decode(&body); err != nil {
+				return nil, err
+			}
+
+			body.UserId = r.param("userId")
+
+			return nil, c.PromoteDependent(body)
+		}},
+	{http.MethodPost, "/identities/{userId}/verifications", tagVerification, "verifyIdentity", "Verifies a message signed by a user and reports the user's status.",
+		nil, SignedMessage{}, client.IdentityVerification{}, http.StatusOK,
+		func(c *client.Client, r *request) (interface{}, error) {
+			var body SignedMessage
+
+			if err := r.decode(&body); err != nil {
+				return nil, err
+			}
+
+			return c.VerifyIdentity(r.param("userId"), body.Message, body.Signature)
+		}},
+	{http.MethodPost, "/providers", tagProviders, "addServiceProvider", "Registers a service provider directly.",
+		nil, client.AddServiceProviderRequest{}, nil, http.StatusCreated,
+		func(c *client.Client, r *request) (interface{}, error) {
+			var body client.AddServiceProviderRequest
+
+			if err := r.decode(&body); err != nil {
+				return nil, err
+			}
+
+			return nil, c.AddServiceProvider(body)
+		}},
+	{http.MethodGet, "/providers/{spId}", tagProviders, "getServiceProvider", "Returns a service provider.",
+		nil, nil, client.ServiceProvider{}, http.StatusOK,
+		func(c *client.Client, r *request) (interface{}, error) {
+			return c.GetServiceProvider(r.param("spId"))
+		}},
+	{http.MethodPost, "/providers/{spId}/keys", tagProviders, "addProviderKey", "Adds a key to a service provider, signed with one of its signing keys.",
+		nil, client.AddProviderKeyRequest{}, nil, http.StatusCreated,
+		func(c *client.Client, r *request) (interface{}, error) {
+			var body client.AddProviderKeyRequest
+
+			if err := r.decode(&body); err != nil {
+				return nil, err
+			}
+
+			body.SpId = r.param("spId")
+
+			return nil, c.AddProviderKey(body)
+		}},
+	{http.MethodPost, "/providers/{spId}/keys/{keyId}/retirement", tagProviders, "retireProviderKey", "Retires a key of a service provider, signed with one of its signing keys.",
+		nil, client.RetireProviderKeyRequest{}, nil, http.StatusNoContent,
+		func(c *client.Client, r *request) (interface{}, error) {
+			var body client.RetireProviderKeyRequest
+
+			if err := r.decode(&body); err != nil {
+				return nil, err
+			}
+
+			body.SpId, body.KeyId = r.param("spId"), r.param("keyId")
+
+			return nil, c.RetireProviderKey(body)
+		}},
+	{http.MethodPost, "/providers/{spId}/keys/{keyId}/verifications", tagVerification, "verifyProviderMessage", "Verifies a message signed with a service provider's key.",
+		nil, SignedMessage{}, ProviderVerification{}, http.StatusOK,
+		func(c *client.Client, r *request) (interface{}, error) {
+			var body SignedMessage
+
+			if err := r.decode(&body); err != nil {
+				return nil, err
+			}
+
+			valid, err := c.VerifyProviderMessage(r.param("spId"), r.param("keyId"), body.Message, body.Signature)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return ProviderVerification{Valid: valid}, nil
+		}},
+	{http.MethodGet, "/providers/{spId}/identities/{userId}", tagConsent, "lookupIdentity", "Returns the status of a user and the attributes of the requested scopes, which the provider must have been granted. Only members of the provider's MSP may call it.",
+		[]queryParam{{"scopes", "Comma-separated scopes to read: publicKey, metadataHash, permissions."}}, nil, client.IdentityAttributes{}, http.StatusOK,
+		func(c *client.Client, r *request) (interface{}, error) {
+			scopes := []string{}
+
+			if r.query("scopes") != "" {
+				scopes = strings.Split(r.query("scopes"), ",")
+			}
+
+			return c.LookupIdentity(client.LookupIdentityRequest{SpId: r.param("spId"), UserId: r.param("userId"), Scopes: scopes})
+		}},
+	{http.MethodPost, "/provider-registrations", tagConsent, "requestServiceProviderRegistration", "Asks the identity authority to register a service provider hosted by the caller's MSP, with the scopes it asks to be granted.",
+		nil, client.ServiceProviderRegistrationRequest{}, nil, http.StatusCreated,
+		func(c *client.Client, r *request) (interface{}, error) {
+			var body client.ServiceProviderRegistrationRequest
+
+			if err := r.decode(&body); err != nil {
+				return nil, err
+			}
+
+			return nil, c.RequestServiceProviderRegistration(body)
+		}},
+	{http.MethodGet, "/provider-registrations", tagConsent, "listServiceProviderRequests", "Lists a page of registration requests. A page filtered by status may hold fewer than pageSize requests; the listing is complete once the bookmark is empty.",
+		[]queryParam{
+			{"status", "Only list requests with this status: pending, approved or rejected."},
+			{"pageSize", "How many stored requests to read, at most 1000."},
+			{"bookmark", "The bookmark of the previous page."},
+		}, nil, client.ServiceProviderRequestPage{}, http.StatusOK,
+		func(c *client.Client, r *request) (interface{}, error) {
+			pageSize := 0
+
+			if r.query("pageSize") != "" {
+				var err error
+				pageSize, err = strconv.Atoi(r.query("pageSize"))
+
+				if err != nil {
+					return nil, invalidQuery("pageSize must be a number")
+				}
+			}
+
+			return c.ListServiceProviderRequests(client.ListServiceProviderRequestsRequest{Status: r.query("status"), PageSize: pageSize, Bookmark: r.query("bookmark")})
+		}},
+	{http.MethodGet, "/provider-registrations/{spId}", tagConsent, "getServiceProviderRegistration", "Returns a registration request.",
+		nil, nil, client.ServiceProviderRequest{}, http.StatusOK,
+		func(c *client.Client, r *request) (interface{}, error) {
+			return c.GetServiceProviderRegistration(r.param("spId"))
+		}},
+	{http.MethodPost, "/provider-registrations/{spId}/approval", tagConsent, "approveServiceProvider", "Approves a pending registration request and registers the service provider with the requested scopes.",
+		nil, nil, nil, http.StatusNoContent,
+		func(c *client.Client, r *request) (interface{}, error) {
+			return nil, c.ApproveServiceProvider(r.param("spId"))
+		}},
+	{http.MethodPost, "/provider-registrations/{spId}/rejection", tagConsent, "rejectServiceProvider", "Rejects a pending registration request.",
+		nil, Rejection{}, nil, http.StatusNoContent,
+		func(c *client.Client, r *request) (interface{}, error) {
+			var body Rejection
+
+			if err := r.decode(&body); err != nil {
+				return nil, err
+			}
+
+			return nil, c.RejectServiceProvider(r.param("spId"), body.Reason)
+		}},
+}
+
+// match reports whether path matches the route and returns its path
+// parameters.
+func (route *route) match(path string) (map[string]string, bool) {
+	patternSegments := strings.Split(route.path, "/")
+	pathSegments := strings.Split(path, "/")
+
+	if len(patternSegments) != len(pathSegments) {
+		return nil, false
+	}
+
+	params := map[string]string{}
+
+	for i, segment := range patternSegments {
+		if name, ok := pathParam(segment); ok && pathSegments[i] != "" {
+			params[name] = pathSegments[i]
+		} else if segment != pathSegments[i] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+// pathParam returns the name of a {name} path segment.
+func pathParam(segment string) (string, bool) {
+	if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		return segment[1 : len(segment)-1], true
+	}
+
+	return "", false
+}
@@ -0,0 +1,72 @@
+package gateway
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+
+	"github.com/mars-identity-chaincode/client/clienttest"
+	"github.com/mars-identity-chaincode/teststub"
+)
+
+// StubInvoker runs the chaincode in process on a test stub, for local
+// development and tests without a Fabric network. State lives in memory and
+// is lost when the process exits. Transactions are stamped with the current
+// time and run one at a time, as the MSP the invoker was created with unless
+// As names another.
+type StubInvoker struct {
+	stub  *teststub.Stub
+	mutex *sync.Mutex
+	mspId string
+}
+
+// NewStubInvoker instantiates chaincode on a new stub as authorityMspId,
+// which becomes the identity authority, and returns an invoker that calls it
+// as mspId.
+func NewStubInvoker(chaincode shim.Chaincode, authorityMspId string, mspId string) (*StubInvoker, error) {
+	if mspId == "" {
+		return nil, errors.New("the MSP to call the chaincode as is required")
+	}
+
+	stub := teststub.New("identity", chaincode)
+	stub.SetCreator(authorityMspId)
+	response := stub.Init()
+
+	if response.Status != shim.OK {
+		return nil, errors.New("instantiating the chaincode failed: " + response.Message)
+	}
+
+	return &StubInvoker{stub: stub, mutex: &sync.Mutex{}, mspId: mspId}, nil
+}
+
+// Stub returns the stub the chaincode runs on, to seed or inspect its state.
+// It must not be used while the invoker serves requests.
+func (invoker *StubInvoker) Stub() *teststub.Stub {
+	return invoker.stub
+}
+
+// As returns an invoker that shares the stub but calls as mspId.
+func (invoker *StubInvoker) As(mspId string) Invoker {
+	return &StubInvoker{stub: invoker.stub, mutex: invoker.mutex, mspId: mspId}
+}
+
+func (invoker *StubInvoker) Submit(input *pb.ChaincodeInput, transient map[string][]byte) (pb.Response, error) {
+	return invoker.run(input, transient, clienttest.StubTransport.Submit)
+}
+
+func (invoker *StubInvoker) Evaluate(input *pb.ChaincodeInput, transient map[string][]byte) (pb.Response, error) {
+	return invoker.run(input, transient, clienttest.StubTransport.Evaluate)
+}
+
+func (invoker *StubInvoker) run(input *pb.ChaincodeInput, transient map[string][]byte, send func(clienttest.StubTransport, *pb.ChaincodeInput, map[string][]byte) (pb.Response, error)) (pb.Response, error) {
+	invoker.mutex.Lock()
+	defer invoker.mutex.Unlock()
+
+	invoker.stub.SetCreator(invoker.mspId)
+	invoker.stub.SetTime(time.Now().UTC().Truncate(time.Second))
+
+	return send(clienttest.StubTransport{Stub: invoker.stub}, input, transient)
+}
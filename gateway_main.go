@@ -0,0 +1,95 @@
+//go:build gateway
+// +build gateway
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/mars-identity-chaincode/gateway"
+)
+
+// main serves the chaincode behind the REST gateway when built with -tags
+// gateway. With -fabric-config it calls the chaincode on a Fabric network
+// through the Fabric SDK, which needs the fabricsdk tag too. With -stub it
+// runs the chaincode in process instead, so that applications can be
+// developed without a Fabric network.
+func main() {
+	listen := flag.String("listen", "localhost:8080", "address to serve the gateway on")
+	openAPI := flag.Bool("openapi", false, "write the OpenAPI document to standard output and exit")
+	fabricConfig := flag.String("fabric-config", "", "connection profile of the Fabric network to call the chaincode on")
+	org := flag.String("org", "", "organization of the member the gateway calls as")
+	user := flag.String("user", "", "user of the member the gateway calls as")
+	channel := flag.String("channel", "", "channel the chaincode is instantiated on")
+	chaincode := flag.String("chaincode", "identity", "name of the chaincode")
+	stub := flag.Bool("stub", false, "run the chaincode in process with its state in memory, for development")
+	authorityMspId := flag.String("authority-msp", "", "with -stub, MSP ID of the identity authority, which instantiates the chaincode")
+	mspId := flag.String("msp", "", "with -stub, MSP ID the gateway calls as")
+	impersonate := flag.Bool("dev-impersonate", false, "with -stub, call as the MSP named in each request's X-Msp-Id header; lets any HTTP caller act as any member")
+	flag.Parse()
+
+	if *openAPI {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+
+		if err := encoder.Encode(gateway.OpenAPI()); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	var invoker gateway.Invoker
+
+	switch {
+	case *stub && *fabricConfig != "":
+		log.Fatal("-stub and -fabric-config cannot be used together")
+	case *stub:
+		if *authorityMspId == "" || *mspId == "" {
+			log.Fatal("-stub needs -authority-msp and -msp")
+		}
+
+		stubInvoker, err := gateway.NewStubInvoker(new(IdentityChaincode), *authorityMspId, *mspId)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		invoker = stubInvoker
+		log.Printf("serving the identity chaincode in process on http://%s as %s", *listen, *mspId)
+	case *fabricConfig != "":
+		if *impersonate {
+			log.Fatal("-dev-impersonate can only be used with -stub")
+		}
+
+		fabricInvoker, err := gateway.NewFabricInvoker(gateway.FabricConfig{
+			ConfigFile:  *fabricConfig,
+			Org:         *org,
+			User:        *user,
+			ChannelId:   *channel,
+			ChaincodeId: *chaincode,
+		})
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		invoker = fabricInvoker
+		log.Printf("serving chaincode %s on channel %s on http://%s as %s of %s", *chaincode, *channel, *listen, *user, *org)
+	default:
+		log.Fatal("either -fabric-config or -stub is required")
+	}
+
+	server := gateway.NewServer(invoker)
+	server.Impersonation = *impersonate
+
+	if *impersonate {
+		log.Printf("calling as the MSP in each request's X-Msp-Id header; do not expose this gateway")
+	}
+
+	log.Fatal(http.ListenAndServe(*listen, server))
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mars-identity-chaincode/client"
+	"github.com/mars-identity-chaincode/gateway"
+)
+
+// gatewayRequest sends a request to server as mspId, or as the invoker's own
+// MSP if mspId is empty, and decodes the response body into result.
+func gatewayRequest(t *testing.T, server http.Handler, mspId string, method string, path string, body string, result interface{}) int {
+	t.Helper()
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+
+	if mspId != "" {
+		request.Header.Set("X-Msp-Id", mspId)
+	}
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+
+	if result != nil {
+		if err := json.Unmarshal(recorder.Body.Bytes(), result); err != nil {
+			t.Fatalf("%s %s: %v: %s", method, path, err, recorder.Body)
+		}
+	}
+
+	return recorder.Code
+}
+
+func TestGateway(t *testing.T) {
+	invoker, err := gateway.NewStubInvoker(new(IdentityChaincode), testAuthorityMspId, testAuthorityMspId)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := gateway.NewServer(invoker)
+	server.Impersonation = true
+	aliceKey, clinicKey := newTestKey(t), newTestKey(t)
+
+	status := gatewayRequest(t, server, "", "POST", "/identities", `{"userId":"alice","publicKey":"`+testPublicKey(aliceKey)+`","metadataHash":"hash1"}`, nil)
+
+	if status != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", status)
+	}
+
+	var alice client.User
+
+	if status = gatewayRequest(t, server, "", "GET", "/identities/alice", "", &alice); status != http.StatusOK || alice.PublicKey != testPublicKey(aliceKey) {
+		t.Fatalf("unexpected identity %d %+v", status, alice)
+	}
+
+	var chaincodeError client.Error
+
+	if status = gatewayRequest(t, server, "", "GET", "/identities/bob", "", &chaincodeError); status != http.StatusNotFound || chaincodeError.Code != client.CodeNotFound {
+		t.Fatalf("expected NOT_FOUND, got %d %+v", status, chaincodeError)
+	}
+
+	// The health authority registers its clinic, asking for the public key scope.
+	status = gatewayRequest(t, server, testHealthMspId, "POST", "/provider-registrations", `{"spId":"clinic","name":"Clinic","publicKey":"`+testPublicKey(clinicKey)+`","category":"healthcare","scopes":["publicKey"]}`, nil)
+
+	if status != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", status)
+	}
+
+	if status = gatewayRequest(t, server, testHealthMspId, "POST", "/provider-registrations/clinic/approval", "", &chaincodeError); status != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", status)
+	}
+
+	if status = gatewayRequest(t, server, "", "POST", "/provider-registrations/clinic/approval", "", nil); status != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", status)
+	}
+
+	var attributes client.IdentityAttributes
+
+	if status = gatewayRequest(t, server, testHealthMspId, "GET", "/providers/clinic/identities/alice?scopes=publicKey", "", &attributes); status != http.StatusOK || attributes.PublicKey != testPublicKey(aliceKey) {
+		t.Fatalf("unexpected attributes %d %+v", status, attributes)
+	}
+
+	if status = gatewayRequest(t, server, testHealthMspId, "GET", "/providers/clinic/identities/alice?scopes=metadataHash", "", &chaincodeError); status != http.StatusForbidden {
+		t.Fatalf("expected a scope outside the grant to be refused, got %d", status)
+	}
+
+	if status = gatewayRequest(t, server, testTransportMspId, "GET", "/providers/clinic/identities/alice?scopes=publicKey", "", &chaincodeError); status != http.StatusForbidden {
+		t.Fatalf("expected another MSP to be refused, got %d", status)
+	}
+
+	var verification client.IdentityVerification
+	signature, _ := client.SignMessage(aliceKey, "hello")
+
+	if status = gatewayRequest(t, server, testTransportMspId, "POST", "/identities/alice/verifications", `{"message":"hello","signature":"`+signature+`"}`, &verification); status != http.StatusOK || !verification.Valid {
+		t.Fatalf("unexpected verification %d %+v", status, verification)
+	}
+}
+
+func TestGatewayImpersonationIsOptIn(t *testing.T) {
+	if _, err := gateway.NewStubInvoker(new(IdentityChaincode), testAuthorityMspId, ""); err == nil {
+		t.Fatal("expected the MSP to call as to be required")
+	}
+
+	invoker, err := gateway.NewStubInvoker(new(IdentityChaincode), testAuthorityMspId, testHealthMspId)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := gateway.NewServer(invoker)
+	body := `{"userId":"alice","publicKey":"` + newTestPublicKey(t) + `","metadataHash":"hash1"}`
+	var chaincodeError client.Error
+
+	// The header is ignored, and the gateway calls as its own MSP.
+	if status := gatewayRequest(t, server, testAuthorityMspId, "POST", "/identities", body, &chaincodeError); status != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", status)
+	}
+
+	server.Impersonation = true
+
+	if status := gatewayRequest(t, server, testAuthorityMspId, "POST", "/identities", body, nil); status != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", status)
+	}
+}
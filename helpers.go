@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/msp"
+)
+
+// getCreatorMspId returns the MSP ID of the identity that submitted the transaction.
+func getCreatorMspId(stub shim.ChaincodeStubInterface) (string, error) {
+	identity, err := stub.GetCreator()
+
+	if err != nil {
+		return "", err
+	}
+
+	sId := &msp.SerializedIdentity{}
+	err = proto.Unmarshal(identity, sId)
+
+	if err != nil {
+		return "", err
+	}
+
+	return sId.Mspid, nil
+}
+
+// isIdentityAuthority reports whether the transaction creator belongs to the
+// MSP that instantiated the chaincode.
+func isIdentityAuthority(stub shim.ChaincodeStubInterface) (bool, error) {
+	identityAuthority, err := stub.GetState("identityAuthority")
+
+	if err != nil {
+		return false, err
+	}
+
+	nodeId, err := getCreatorMspId(stub)
+
+	if err != nil {
+		return false, err
+	}
+
+	return len(identityAuthority) > 0 && string(identityAuthority) == nodeId, nil
+}
+
+// parseStringList decodes a JSON array of non-empty strings passed as a single argument.
+func parseStringList(arg string) ([]string, error) {
+	var list []string
+	err := json.Unmarshal([]byte(arg), &list)
+
+	if err != nil {
+		return nil, newError(codeInvalidArgument, "Expected a JSON array of strings")
+	}
+
+	for _, item := range list {
+		if item == "" {
+			return nil, newError(codeInvalidArgument, "List entries cannot be empty")
+		}
+	}
+
+	return list, nil
+}
+
+// prefixRange returns the start and end keys of a range query covering every
+// key that begins with prefix.
+func prefixRange(prefix string) (string, string) {
+	return prefix, prefix + string(utf8.MaxRune)
+}
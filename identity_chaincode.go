@@ -1,7 +1,6 @@
 package main
 
 import (
-	"fmt"
 	"encoding/json"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
@@ -13,11 +12,28 @@ type User struct {
 	PublicKey	string `json:"publicKey"`
 	MetadataHash string `json:"metadataHash"`
 	Permissions []string `json:"permissions"`
+	Status string `json:"status"`
+	IssuedAt int64 `json:"issuedAt,omitempty"`
+	ValidUntil int64 `json:"validUntil,omitempty"`
+	Guardians []string `json:"guardians,omitempty"`
+	MajorityAt int64 `json:"majorityAt,omitempty"`
+	Nonce int `json:"nonce"`
+	RecoveryContacts []string `json:"recoveryContacts,omitempty"`
+	RecoveryThreshold int `json:"recoveryThreshold,omitempty"`
+	DocType string `json:"docType"`
+	Version int `json:"version"`
 }
 
 type ServiceProvider struct {
 	Name	string `json:"name"`
 	PublicKey string `json:"publicKey"`
+	Category string `json:"category"`
+	AllowedScopes []string `json:"allowedScopes"`
+	ContactEndpoint string `json:"contactEndpoint"`
+	MspId string `json:"mspId"`
+	Keys []ProviderKey `json:"keys"`
+	DocType string `json:"docType"`
+	Version int `json:"version"`
 }
 
 type IdentityChaincode struct {
@@ -30,228 +46,360 @@ func (t *IdentityChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 	identity, err = stub.GetCreator()
 	
 	if err != nil {
-		return shim.Error("An error occured")
+		return errorResponse(err)
 	}
 
 	sId := &msp.SerializedIdentity{}
 	err = proto.Unmarshal(identity, sId)
 	
 	if err != nil {
-			return shim.Error("An error occured")
+			return errorResponse(err)
 	}
 
 	nodeId := sId.Mspid
 	err = stub.PutState("identityAuthority", []byte(nodeId))
 
 	if err != nil {
-		return shim.Error("An error occured")
+		return errorResponse(err)
 	}
 
 	return shim.Success(nil)
 }
 
+// Invoke dispatches to the function named by the first argument, from the
+// registry in router.go, once its arguments are normalized and its access
+// policy is met.
 func (t *IdentityChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 	function, args := stub.GetFunctionAndParameters()
-	if function == "getCreatorIdentity" {
-		return t.getCreatorIdentity(stub, args)
-	} else if function == "issueIdentity" {
-		return t.issueIdentity(stub, args)
-	} else if function == "getIdentity" {
-		return t.getIdentity(stub, args)
-	} else if function == "addServiceProvider" {
-		return t.addServiceProvider(stub, args)
-	} else if function == "getServiceProvider" {
-		return t.getServiceProvider(stub, args)
-	}
-
-	return shim.Error("Invalid function name: " + function)
+	contractFunction, ok := contractFunctions[function]
+
+	if !ok {
+		return invalidArgument("Invalid function name: " + function)
+	}
+
+	// Callers the policy excludes learn nothing about the arguments.
+	if contractFunction.policy.check != nil {
+		err := contractFunction.policy.check(stub)
+
+		if err != nil {
+			return errorResponse(err)
+		}
+	}
+
+	args, err := normalizeArgs(contractFunction.args, args)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return contractFunction.handler(t, stub, args)
 }
 
 func (t *IdentityChaincode) getCreatorIdentity(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	identity, err := stub.GetState("identityAuthority")
 
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
 	if identity == nil {
-		return shim.Error("Identity not yet stored")
+		return notFound("Identity not yet stored")
 	}
 
 	return shim.Success(identity)
 }
 
+// issueIdentity registers a user. Dependents are issued with two extra
+// arguments: a JSON array of guardian user IDs and the Unix time at which
+// they come of age. A dependent may be issued without a public key.
 func (t *IdentityChaincode) issueIdentity(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	if len(args) != 3 {
-		return shim.Error("Incorrect number of arguments.")
+	if len(args) != 3 && len(args) != 5 {
+		return incorrectArgumentCount()
 	}
 
+	var guardians []string
+	var majorityAt int64
 	var err error
 
-	identityAuthority, err := stub.GetState("identityAuthority")
+	if len(args) == 5 {
+		guardians, err = parseStringList(args[3])
+
+		if err != nil {
+			return errorResponse(err)
+		}
+
+		majorityAt, err = parseTimestampArg(args[4])
+
+		if err != nil {
+			return errorResponse(err)
+		}
+	}
+
+	newUser, err := newUserRecord(stub, args[0], args[1], args[2], guardians, majorityAt, nil)
 
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	identity, err := stub.GetCreator()
+	err = storeUser(stub, args[0], newUser)
 
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	sId := &msp.SerializedIdentity{}
-	err = proto.Unmarshal(identity, sId)
-	
+	deltas := statDeltas{}
+	deltas.addIdentity(newUser)
+	err = deltas.write(stub)
+
 	if err != nil {
-			return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	nodeId := sId.Mspid
+	return shim.Success(nil)
+}
 
-	if string(identityAuthority) != nodeId {
-		return shim.Error("You are not authorized")
+// newUserRecord validates a user about to be issued and builds its record.
+// batch holds users issued earlier in the same transaction, which may be
+// named as guardians; it is nil outside of batch issuance.
+func newUserRecord(stub shim.ChaincodeStubInterface, userId string, publicKey string, metadataHash string, guardians []string, majorityAt int64, batch map[string]*User) (*User, error) {
+	if userId == "" {
+		return nil, newError(codeInvalidArgument, "User ID is required")
 	}
 
-	userExists, err := stub.GetState("user_" + args[0])
+	userExists, err := getRecord(stub, userObjectType, userId)
 
-	if userExists != nil  {
-		return shim.Error("User already exists")
+	if err != nil {
+		return nil, err
 	}
 
-	var newUser User
-	newUser.PublicKey = args[1]
-	newUser.MetadataHash = args[2]
+	if userExists != nil {
+		return nil, newError(codeAlreadyExists, "User already exists")
+	}
 
-	newUserJson, err := json.Marshal(newUser)
+	now, err := txTime(stub)
 
 	if err != nil {
-			return shim.Error(err.Error())
+		return nil, err
 	}
 
-	err = stub.PutState("user_" + args[0], newUserJson)
+	if len(guardians) > 0 {
+		err = validateGuardianship(stub, userId, guardians, majorityAt, now, batch)
 
-	if err != nil {
-		return shim.Error(err.Error())
+		if err != nil {
+			return nil, err
+		}
+	} else if publicKey == "" {
+		return nil, newError(codeInvalidArgument, "Public key is required")
 	}
 
-	return shim.Success(nil)
+	var newUser User
+	newUser.PublicKey = publicKey
+	newUser.MetadataHash = metadataHash
+	newUser.Status = statusActive
+	newUser.IssuedAt = now
+	newUser.ValidUntil = defaultValidUntil(now)
+	newUser.Guardians = guardians
+	newUser.MajorityAt = majorityAt
+
+	return &newUser, nil
 }
 
+// IdentityStatusView is the status projection of getIdentity, which is all
+// that verifiers of user signatures need.
+type IdentityStatusView struct {
+	Status string `json:"status"`
+	PublicKey string `json:"publicKey"`
+	ValidUntil int64 `json:"validUntil,omitempty"`
+	Nonce int `json:"nonce"`
+}
+
+func statusView(user *User) IdentityStatusView {
+	return IdentityStatusView{user.Status, user.PublicKey, user.ValidUntil, user.Nonce}
+}
+
+// getIdentity returns a user. It takes the user ID and an optional view,
+// full or status. Only the identity authority may read the full view, which
+// is its default; other members get the status view.
 func (t *IdentityChaincode) getIdentity(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments.")
+	if len(args) != 1 && len(args) != 2 {
+		return incorrectArgumentCount()
 	}
 
-	user, err := stub.GetState("user_" + args[0])
+	authority, err := isIdentityAuthority(stub)
 
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	return shim.Success(user)
-}
+	view := "status"
 
-func (t *IdentityChaincode) updateUserMetadataHash(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	if len(args) != 2 {
-		return shim.Error("Incorrect number of arguments.")
+	if authority {
+		view = "full"
 	}
 
-	var err error
+	if len(args) == 2 && args[1] != "" {
+		view = args[1]
+	}
+
+	if view != "full" && view != "status" {
+		return invalidArgument("Unknown view: " + view)
+	}
 
-	identityAuthority, err := stub.GetState("identityAuthority")
+	if view == "full" && !authority {
+		return unauthorized()
+	}
+
+	user, err := loadUser(stub, args[0])
 
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
+	}
+
+	if user == nil {
+		return notFound("User not found")
 	}
 
-	identity, err := stub.GetCreator()
+	now, err := txTime(stub)
 
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
+	}
+
+	user.Status = identityStatus(user, now)
+
+	var userJson []byte
+
+	if view == "status" {
+		userJson, err = json.Marshal(statusView(user))
+	} else {
+		userJson, err = json.Marshal(user)
 	}
 
-	sId := &msp.SerializedIdentity{}
-	err = proto.Unmarshal(identity, sId)
-	
 	if err != nil {
-			return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	nodeId := sId.Mspid
+	return shim.Success(userJson)
+}
+
+// identityExists returns true or false depending on whether a user was issued.
+func (t *IdentityChaincode) identityExists(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return incorrectArgumentCount()
+	}
+
+	userJson, err := getRecord(stub, userObjectType, args[0])
+
+	if err != nil {
+		return errorResponse(err)
+	}
 
-	if string(identityAuthority) != nodeId {
-		return shim.Error("You are not authorized")
+	if userJson == nil {
+		return shim.Success([]byte("false"))
 	}
 
-	user, err := stub.GetState("user_" + args[0])
+	return shim.Success([]byte("true"))
+}
+
+// updateUserMetadataHash replaces a user's metadata hash without the user's
+// signature, for corrections made by the identity authority. It takes the
+// user ID and the new hash.
+func (t *IdentityChaincode) updateUserMetadataHash(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return incorrectArgumentCount()
+	}
 
-	var userStruct User
-	err = json.Unmarshal(user, &userStruct)
+	user, err := loadUser(stub, args[0])
 
 	if err != nil {
-			return shim.Error(err.Error())
+			return errorResponse(err)
 	}
 
-	userStruct.MetadataHash = args[1]
+	if user == nil {
+		return notFound("User not found")
+	}
 
-	userJson, err := json.Marshal(userStruct)
+	user.MetadataHash = args[1]
 
-	err = stub.PutState("user_" + args[0], userJson)
+	err = storeUser(stub, args[0], user)
 
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
 	return shim.Success(nil)
 }
 
+// addServiceProvider registers a service provider. It takes the provider
+// ID, name and public key, optionally followed by the category, allowed
+// scopes, contact endpoint and owning MSP. Providers registered with only the
+// first three, as before categories existed, have no scopes and no MSP that
+// may look identities up for them.
 func (t *IdentityChaincode) addServiceProvider(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	if len(args) != 3 {
-		return shim.Error("Incorrect number of arguments.")
+	if len(args) < 3 || len(args) > 7 {
+		return incorrectArgumentCount()
 	}
 
-	var err error
+	args = append(args, make([]string, 7-len(args))...)
+	allowedScopes := []string{}
 
-	identityAuthority, err := stub.GetState("identityAuthority")
+	if args[4] != "" {
+		scopes, err := parseStringList(args[4])
 
-	if err != nil {
-		return shim.Error(err.Error())
+		if err != nil {
+			return errorResponse(err)
+		}
+
+		allowedScopes = append(allowedScopes, scopes...)
 	}
 
-	identity, err := stub.GetCreator()
+	if args[3] != "" || len(allowedScopes) > 0 {
+		err := validateCategoryScopes(args[3], allowedScopes)
 
-	if err != nil {
-		return shim.Error(err.Error())
+		if err != nil {
+			return errorResponse(err)
+		}
 	}
 
-	sId := &msp.SerializedIdentity{}
-	err = proto.Unmarshal(identity, sId)
-	
+	spExists, err := getRecord(stub, spObjectType, args[0])
+
 	if err != nil {
-			return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	nodeId := sId.Mspid
+	if spExists != nil {
+		return alreadyExists("Service provider already exists")
+	}
+
+	primaryKey, err := primaryProviderKey(stub, args[2])
 
-	if string(identityAuthority) != nodeId {
-		return shim.Error("You are not authorized")
+	if err != nil {
+		return errorResponse(err)
 	}
 
 	var newSP ServiceProvider
 	newSP.Name = args[1]
 	newSP.PublicKey = args[2]
+	newSP.Category = args[3]
+	newSP.AllowedScopes = allowedScopes
+	newSP.ContactEndpoint = args[5]
+	newSP.MspId = args[6]
+	newSP.Keys = []ProviderKey{primaryKey}
 
-	newSPJson, err := json.Marshal(newSP)
+	err = storeServiceProvider(stub, args[0], &newSP)
 
 	if err != nil {
-			return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	err = stub.PutState("sp_" + args[0], newSPJson)
+	if newSP.Category != "" {
+		deltas := statDeltas{}
+		deltas.add(statCategory, newSP.Category, 1)
+		err = deltas.write(stub)
 
-	if err != nil {
-		return shim.Error(err.Error())
+		if err != nil {
+			return errorResponse(err)
+		}
 	}
 
 	return shim.Success(nil)
@@ -259,21 +407,100 @@ func (t *IdentityChaincode) addServiceProvider(stub shim.ChaincodeStubInterface,
 
 func (t *IdentityChaincode) getServiceProvider(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments.")
+		return incorrectArgumentCount()
 	}
 
-	sp, err := stub.GetState("sp_" + args[0])
+	sp, err := loadServiceProvider(stub, args[0])
 
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
+	}
+
+	if sp == nil {
+		return notFound("Service provider not found")
 	}
 
-	return shim.Success(sp)
+	spJson, err := json.Marshal(sp)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(spJson)
 }
 
-func main() {
-	err := shim.Start(new(IdentityChaincode))
+func loadUser(stub shim.ChaincodeStubInterface, userId string) (*User, error) {
+	userJson, err := getRecord(stub, userObjectType, userId)
+
+	if err != nil || userJson == nil {
+		return nil, err
+	}
+
+	var user User
+	err = json.Unmarshal(userJson, &user)
+
 	if err != nil {
-		fmt.Printf("Error starting chaincode: %s", err)
+		return nil, err
+	}
+
+	upgradeUser(&user)
+
+	return &user, nil
+}
+
+// storeUser writes user under userId at the current schema version. Every
+// stored user has a validity end, so that queries on validUntil match it.
+// Users stored before issuance was recorded expire five years after they are
+// next written.
+func storeUser(stub shim.ChaincodeStubInterface, userId string, user *User) error {
+	if user.ValidUntil == 0 {
+		now, err := txTime(stub)
+
+		if err != nil {
+			return err
+		}
+
+		user.ValidUntil = defaultValidUntil(now)
 	}
+
+	user.DocType = userDocType
+	user.Version = userSchemaVersion
+	userJson, err := json.Marshal(user)
+
+	if err != nil {
+		return err
+	}
+
+	return putRecord(stub, userObjectType, userId, userJson)
+}
+
+func loadServiceProvider(stub shim.ChaincodeStubInterface, spId string) (*ServiceProvider, error) {
+	spJson, err := getRecord(stub, spObjectType, spId)
+
+	if err != nil || spJson == nil {
+		return nil, err
+	}
+
+	var sp ServiceProvider
+	err = json.Unmarshal(spJson, &sp)
+
+	if err != nil {
+		return nil, err
+	}
+
+	upgradeServiceProvider(&sp)
+
+	return &sp, nil
+}
+
+func storeServiceProvider(stub shim.ChaincodeStubInterface, spId string, sp *ServiceProvider) error {
+	sp.DocType = spDocType
+	sp.Version = serviceProviderSchemaVersion
+	spJson, err := json.Marshal(sp)
+
+	if err != nil {
+		return err
+	}
+
+	return putRecord(stub, spObjectType, spId, spJson)
 }
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestInitStoresAuthority(t *testing.T) {
+	stub := newTestStub(t)
+
+	authority := stub.State["identityAuthority"]
+
+	if string(authority) != testAuthorityMspId {
+		t.Fatalf("expected authority %s, got %q", testAuthorityMspId, authority)
+	}
+
+	response := stub.Invoke("getCreatorIdentity")
+	expectStatus(t, response, shim.OK)
+
+	if string(response.Payload) != testAuthorityMspId {
+		t.Fatalf("expected creator identity %s, got %q", testAuthorityMspId, response.Payload)
+	}
+}
+
+func TestInvokeUnknownFunction(t *testing.T) {
+	stub := newTestStub(t)
+
+	expectError(t, stub.Invoke("noSuchFunction"), codeInvalidArgument)
+	expectError(t, stub.Invoke(), codeInvalidArgument)
+}
+
+func TestInvokeDispatchesEveryFunction(t *testing.T) {
+	stub := newTestStub(t)
+
+	for function := range contractFunctions {
+		response := stub.Invoke(function, "{}")
+
+		if response.Status == shim.OK {
+			continue
+		}
+
+		var chaincodeError ChaincodeError
+		err := json.Unmarshal(response.Payload, &chaincodeError)
+
+		if err != nil {
+			t.Fatalf("%s: error payload is not JSON: %s", function, response.Payload)
+		}
+
+		if chaincodeError.Message == "Invalid function name: "+function {
+			t.Fatalf("%s is not dispatched", function)
+		}
+	}
+}
+
+func TestIssueIdentity(t *testing.T) {
+	stub := newTestStub(t)
+	publicKey := newTestPublicKey(t)
+
+	expectStatus(t, stub.Invoke("issueIdentity", "alice", publicKey, "hash1"), shim.OK)
+
+	var user User
+	err := json.Unmarshal(storedRecord(t, stub, userObjectType, "alice"), &user)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.PublicKey != publicKey || user.MetadataHash != "hash1" || user.Status != statusActive {
+		t.Fatalf("unexpected user record %+v", user)
+	}
+
+	if user.IssuedAt == 0 || user.ValidUntil != defaultValidUntil(user.IssuedAt) {
+		t.Fatalf("unexpected validity %d to %d", user.IssuedAt, user.ValidUntil)
+	}
+
+	if user.DocType != userDocType || user.Version != userSchemaVersion {
+		t.Fatalf("unexpected docType %q and version %d", user.DocType, user.Version)
+	}
+}
+
+func TestIssueIdentityDuplicate(t *testing.T) {
+	stub := newTestStub(t)
+	publicKey := newTestPublicKey(t)
+
+	expectStatus(t, stub.Invoke("issueIdentity", "alice", publicKey, "hash1"), shim.OK)
+	expectError(t, stub.Invoke("issueIdentity", "alice", newTestPublicKey(t), "hash2"), codeAlreadyExists)
+
+	var user User
+	err := json.Unmarshal(storedRecord(t, stub, userObjectType, "alice"), &user)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.PublicKey != publicKey || user.MetadataHash != "hash1" {
+		t.Fatal("duplicate issuance overwrote the user")
+	}
+}
+
+func TestIssueIdentityUnauthorized(t *testing.T) {
+	stub := newTestStub(t)
+	stub.SetCreator(testOtherMspId)
+
+	expectError(t, stub.Invoke("issueIdentity", "alice", newTestPublicKey(t), "hash1"), codeUnauthorized)
+
+	if storedRecord(t, stub, userObjectType, "alice") != nil {
+		t.Fatal("unauthorized issuance stored a user")
+	}
+}
+
+func TestIssueIdentityInvalidArguments(t *testing.T) {
+	stub := newTestStub(t)
+	publicKey := newTestPublicKey(t)
+
+	tests := []struct {
+		name string
+		args []string
+		code string
+	}{
+		{"no arguments", []string{}, codeInvalidArgument},
+		{"two arguments", []string{"alice", publicKey}, codeInvalidArgument},
+		{"four arguments", []string{"alice", publicKey, "hash1", "[]"}, codeInvalidArgument},
+		{"six arguments", []string{"alice", publicKey, "hash1", "[]", "0", "x"}, codeInvalidArgument},
+		{"empty user ID", []string{"", publicKey, "hash1"}, codeInvalidArgument},
+		{"missing public key", []string{"alice", "", "hash1"}, codeInvalidArgument},
+		{"unknown guardian", []string{"alice", "", "hash1", `["nobody"]`, "4102444800"}, codeNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expectError(t, stub.Invoke(append([]string{"issueIdentity"}, test.args...)...), test.code)
+		})
+	}
+
+	if storedRecord(t, stub, userObjectType, "alice") != nil {
+		t.Fatal("invalid issuance stored a user")
+	}
+}
+
+func TestGetIdentity(t *testing.T) {
+	stub := newTestStub(t)
+	publicKey := newTestPublicKey(t)
+	expectStatus(t, stub.Invoke("issueIdentity", "alice", publicKey, "hash1"), shim.OK)
+
+	response := stub.Invoke("getIdentity", "alice")
+	expectStatus(t, response, shim.OK)
+
+	var user User
+	err := json.Unmarshal(response.Payload, &user)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.PublicKey != publicKey || user.MetadataHash != "hash1" || user.Status != statusActive {
+		t.Fatalf("unexpected user %+v", user)
+	}
+
+	response = stub.Invoke("getIdentity", "alice", "status")
+	expectStatus(t, response, shim.OK)
+
+	var view map[string]interface{}
+	err = json.Unmarshal(response.Payload, &view)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := view["metadataHash"]; ok || view["publicKey"] != publicKey || view["status"] != statusActive {
+		t.Fatalf("unexpected status view %s", response.Payload)
+	}
+}
+
+func TestGetIdentityFullViewIsRestrictedToAuthority(t *testing.T) {
+	stub := newTestStub(t)
+	expectStatus(t, stub.Invoke("issueIdentity", "alice", newTestPublicKey(t), "hash1"), shim.OK)
+	stub.SetCreator(testOtherMspId)
+
+	expectError(t, stub.Invoke("getIdentity", "alice", "full"), codeUnauthorized)
+
+	// Other members get the status view by default.
+	response := stub.Invoke("getIdentity", "alice")
+	expectStatus(t, response, shim.OK)
+
+	var view map[string]interface{}
+	err := json.Unmarshal(response.Payload, &view)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := view["metadataHash"]; ok || view["status"] != statusActive {
+		t.Fatalf("expected the status view, got %s", response.Payload)
+	}
+}
+
+func TestGetIdentityErrors(t *testing.T) {
+	stub := newTestStub(t)
+	expectStatus(t, stub.Invoke("issueIdentity", "alice", newTestPublicKey(t), "hash1"), shim.OK)
+
+	expectError(t, stub.Invoke("getIdentity", "bob"), codeNotFound)
+	expectError(t, stub.Invoke("getIdentity"), codeInvalidArgument)
+	expectError(t, stub.Invoke("getIdentity", "alice", "status", "x"), codeInvalidArgument)
+	expectError(t, stub.Invoke("getIdentity", "alice", "everything"), codeInvalidArgument)
+}
+
+func TestAddServiceProvider(t *testing.T) {
+	stub := newTestStub(t)
+	publicKey := newTestPublicKey(t)
+
+	expectStatus(t, stub.Invoke("addServiceProvider", "clinic", "Clinic", publicKey, "healthcare", `["publicKey"]`, "https://clinic.mars", "ClinicMSP"), shim.OK)
+
+	var sp ServiceProvider
+	err := json.Unmarshal(storedRecord(t, stub, spObjectType, "clinic"), &sp)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sp.Name != "Clinic" || sp.Category != "healthcare" || sp.MspId != "ClinicMSP" || sp.ContactEndpoint != "https://clinic.mars" {
+		t.Fatalf("unexpected service provider record %+v", sp)
+	}
+
+	if len(sp.AllowedScopes) != 1 || sp.AllowedScopes[0] != scopePublicKey {
+		t.Fatalf("unexpected allowed scopes %v", sp.AllowedScopes)
+	}
+
+	if len(sp.Keys) != 1 || sp.Keys[0].KeyId != primaryKeyId || sp.Keys[0].PublicKey != publicKey {
+		t.Fatalf("unexpected key set %+v", sp.Keys)
+	}
+}
+
+func TestAddServiceProviderErrors(t *testing.T) {
+	stub := newTestStub(t)
+	publicKey := newTestPublicKey(t)
+	args := []string{"addServiceProvider", "clinic", "Clinic", publicKey, "healthcare", `["publicKey"]`, "", "ClinicMSP"}
+
+	expectError(t, stub.Invoke(args[:3]...), codeInvalidArgument)
+	expectError(t, stub.Invoke(append(args, "extra")...), codeInvalidArgument)
+	expectError(t, stub.Invoke("addServiceProvider", "clinic", "Clinic", publicKey, "mining", `[]`, "", "ClinicMSP"), codeInvalidArgument)
+	expectError(t, stub.Invoke("addServiceProvider", "clinic", "Clinic", publicKey, "healthcare", "publicKey", "", "ClinicMSP"), codeInvalidArgument)
+
+	stub.SetCreator(testOtherMspId)
+	expectError(t, stub.Invoke(args...), codeUnauthorized)
+
+	if storedRecord(t, stub, spObjectType, "clinic") != nil {
+		t.Fatal("rejected call stored a service provider")
+	}
+
+	stub.SetCreator(testAuthorityMspId)
+	expectStatus(t, stub.Invoke(args...), shim.OK)
+	expectError(t, stub.Invoke(args...), codeAlreadyExists)
+}
+
+func TestAddServiceProviderLegacyForm(t *testing.T) {
+	stub := newTestStub(t)
+	publicKey := newTestPublicKey(t)
+
+	expectStatus(t, stub.Invoke("addServiceProvider", "shop", "Shop", publicKey), shim.OK)
+	expectStatus(t, stub.Invoke("addServiceProvider", `{"spId":"mint","name":"Mint","publicKey":"`+publicKey+`"}`), shim.OK)
+	expectStatus(t, stub.Invoke("addServiceProvider", "bank", "Bank", publicKey, "finance", `["publicKey"]`), shim.OK)
+
+	for _, spId := range []string{"shop", "mint", "bank"} {
+		var sp ServiceProvider
+		err := json.Unmarshal(storedRecord(t, stub, spObjectType, spId), &sp)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if sp.PublicKey != publicKey || sp.MspId != "" || sp.AllowedScopes == nil || len(sp.Keys) != 1 {
+			t.Fatalf("unexpected service provider record %+v", sp)
+		}
+	}
+
+	// Without an owning MSP, no member may look identities up for the provider.
+	expectStatus(t, stub.Invoke("issueIdentity", "alice", newTestPublicKey(t), "hash1"), shim.OK)
+	expectError(t, stub.Invoke("lookupIdentity", "shop", "alice", "[]"), codeUnauthorized)
+
+	expectError(t, stub.Invoke("addServiceProvider", "cafe", "Cafe", publicKey, "", `["publicKey"]`), codeInvalidArgument)
+}
+
+func TestGetServiceProvider(t *testing.T) {
+	stub := newTestStub(t)
+	expectStatus(t, stub.Invoke("addServiceProvider", "bank", "Bank", newTestPublicKey(t), "finance", `["publicKey"]`, "", "BankMSP"), shim.OK)
+
+	response := stub.Invoke("getServiceProvider", "bank")
+	expectStatus(t, response, shim.OK)
+
+	var sp ServiceProvider
+	err := json.Unmarshal(response.Payload, &sp)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sp.Name != "Bank" || sp.MspId != "BankMSP" {
+		t.Fatalf("unexpected service provider %+v", sp)
+	}
+
+	expectError(t, stub.Invoke("getServiceProvider", "shop"), codeNotFound)
+	expectError(t, stub.Invoke("getServiceProvider"), codeInvalidArgument)
+}
+
+func TestUpdateUserMetadataHash(t *testing.T) {
+	stub := newTestStub(t)
+	expectStatus(t, stub.Invoke("issueIdentity", "alice", newTestPublicKey(t), "hash1"), shim.OK)
+
+	expectStatus(t, stub.Invoke("updateUserMetadataHash", "alice", "hash2"), shim.OK)
+
+	var user User
+	err := json.Unmarshal(storedRecord(t, stub, userObjectType, "alice"), &user)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.MetadataHash != "hash2" {
+		t.Fatalf("expected metadata hash hash2, got %s", user.MetadataHash)
+	}
+
+	expectError(t, stub.Invoke("updateUserMetadataHash", "alice"), codeInvalidArgument)
+	expectError(t, stub.Invoke("updateUserMetadataHash", "bob", "hash2"), codeNotFound)
+	expectStatus(t, stub.Invoke("updateUserMetadataHash", `{"userId":"alice","metadataHash":"hash3"}`), shim.OK)
+
+	stub.SetCreator(testOtherMspId)
+	expectError(t, stub.Invoke("updateUserMetadataHash", "alice", "hash4"), codeUnauthorized)
+
+	err = json.Unmarshal(storedRecord(t, stub, userObjectType, "alice"), &user)
+
+	if err != nil || user.MetadataHash != "hash3" || user.Nonce != 0 {
+		t.Fatalf("unexpected user %+v: %v", user, err)
+	}
+}
+
+func TestLegacyUserKeysAreRead(t *testing.T) {
+	stub := newTestStub(t)
+	stub.Seed("user_alice", []byte(`{"publicKey":"`+newTestPublicKey(t)+`","metadataHash":"hash1"}`))
+
+	expectStatus(t, stub.Invoke("getIdentity", "alice"), shim.OK)
+	expectError(t, stub.Invoke("issueIdentity", "alice", newTestPublicKey(t), "hash2"), codeAlreadyExists)
+
+	expectStatus(t, stub.Invoke("updateUserMetadataHash", "alice", "hash2"), shim.OK)
+
+	if stub.State["user_alice"] != nil || storedRecord(t, stub, userObjectType, "alice") == nil {
+		t.Fatal("storing a legacy user did not move it to its composite key")
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+
+	"github.com/mars-identity-chaincode/teststub"
+)
+
+// fuzzArgSeparator separates the arguments packed into the single string the
+// fuzz target receives, so that the fuzzer can vary their number.
+const fuzzArgSeparator = "\x1f"
+
+// openFunctions may write state when called by a member that is not the
+// identity authority. Every other function must write nothing for such a
+// caller unless given a valid signature, which the fuzzer cannot forge.
+var openFunctions = map[string]bool{
+	"requestServiceProviderRegistration": true,
+}
+
+// newFuzzStub returns a stub holding a user, a dependent, a service provider
+// and a pending registration request, so that fuzzed calls reach past the
+// record lookups.
+func newFuzzStub(t *testing.T, publicKeys []string) *teststub.Stub {
+	stub := newTestStub(t)
+
+	expectStatus(t, stub.Invoke("issueIdentity", "alice", publicKeys[0], "hash1"), shim.OK)
+	expectStatus(t, stub.Invoke("issueIdentity", "bobby", "", "hash2", `["alice"]`, "4102444800"), shim.OK)
+	expectStatus(t, stub.Invoke("addServiceProvider", "bank", "Bank", publicKeys[1], "finance", `["publicKey"]`, "", "BankMSP"), shim.OK)
+
+	stub.SetCreator(testOtherMspId)
+	expectStatus(t, stub.Invoke("requestServiceProviderRegistration", "clinic", "Clinic", publicKeys[2], "healthcare", `["publicKey"]`, ""), shim.OK)
+	stub.SetCreator(testAuthorityMspId)
+
+	return stub
+}
+
+func FuzzInvoke(f *testing.F) {
+	publicKeys := []string{newTestPublicKey(f), newTestPublicKey(f), newTestPublicKey(f)}
+	functions := make([]string, 0, len(contractFunctions))
+
+	for function := range contractFunctions {
+		functions = append(functions, function)
+	}
+
+	sort.Strings(functions)
+
+	for _, function := range functions {
+		f.Add(function, "", true)
+		f.Add(function, "{}", false)
+		f.Add(function, strings.Join([]string{"alice", publicKeys[0], "hash3"}, fuzzArgSeparator), true)
+		f.Add(function, strings.Join([]string{"bank", "secondary", publicKeys[2], "signing", "", "", "primary", "00"}, fuzzArgSeparator), false)
+	}
+
+	f.Add("issueIdentity", strings.Join([]string{"carol", publicKeys[2], "hash3"}, fuzzArgSeparator), false)
+	f.Add("batchIssueIdentities", `[{"userId":"carol","publicKey":"`+publicKeys[2]+`","metadataHash":"h"},{"userId":"dan","guardians":["carol"],"majorityAt":4102444800}]`, true)
+	f.Add("approveServiceProvider", "clinic", true)
+	f.Add("renewIdentity", "alice"+fuzzArgSeparator+"4102444800", true)
+	f.Add("queryIdentities", `{"status":"active","permission":"vote"}`+fuzzArgSeparator+"10"+fuzzArgSeparator, true)
+	f.Add("listPendingMigrations", "user"+fuzzArgSeparator+"10"+fuzzArgSeparator, true)
+	f.Add("migrate", "user"+fuzzArgSeparator+`["alice","bob"]`, true)
+	f.Add("noSuchFunction", "", true)
+
+	f.Fuzz(func(t *testing.T, function string, packedArgs string, asAuthority bool) {
+		stub := newFuzzStub(t, publicKeys)
+		args := []string{function}
+
+		if packedArgs != "" {
+			args = append(args, strings.Split(packedArgs, fuzzArgSeparator)...)
+		}
+
+		if !asAuthority {
+			stub.SetCreator(testOtherMspId)
+		}
+
+		before := snapshotState(stub)
+		response := stub.Invoke(args...)
+
+		checkErrorPayload(t, response)
+
+		if !asAuthority && !openFunctions[function] {
+			if key, changed := changedKey(before, snapshotState(stub)); changed {
+				t.Fatalf("%s by an unauthorized creator wrote %q", function, key)
+			}
+		}
+
+		checkStoredUsers(t, stub)
+	})
+}
+
+func snapshotState(stub *teststub.Stub) map[string][]byte {
+	state := make(map[string][]byte, len(stub.State))
+
+	for key, value := range stub.State {
+		state[key] = value
+	}
+
+	return state
+}
+
+// changedKey returns a key whose value differs between the two snapshots.
+func changedKey(before map[string][]byte, after map[string][]byte) (string, bool) {
+	for key, value := range after {
+		if previous, ok := before[key]; !ok || !bytes.Equal(previous, value) {
+			return key, true
+		}
+	}
+
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			return key, true
+		}
+	}
+
+	return "", false
+}
+
+// checkErrorPayload checks that a failed response carries a ChaincodeError
+// whose code matches its status.
+func checkErrorPayload(t *testing.T, response pb.Response) {
+	t.Helper()
+
+	if response.Status < shim.ERRORTHRESHOLD {
+		return
+	}
+
+	var chaincodeError ChaincodeError
+	err := json.Unmarshal(response.Payload, &chaincodeError)
+
+	if err != nil {
+		t.Fatalf("error payload is not JSON: %q", response.Payload)
+	}
+
+	if status, ok := codeStatus[chaincodeError.Code]; !ok || status != response.Status {
+		t.Fatalf("error code %q does not match status %d", chaincodeError.Code, response.Status)
+	}
+}
+
+// checkStoredUsers checks that every stored user, under a composite or a
+// legacy key, unmarshals into User.
+func checkStoredUsers(t *testing.T, stub *teststub.Stub) {
+	t.Helper()
+	compositePrefix, err := stub.CreateCompositeKey(userObjectType, []string{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, value := range stub.State {
+		if !strings.HasPrefix(key, compositePrefix) && !strings.HasPrefix(key, legacyKeyPrefixes[userObjectType]) {
+			continue
+		}
+
+		var user User
+		err := json.Unmarshal(value, &user)
+
+		if err != nil {
+			t.Fatalf("stored user %q does not unmarshal: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Object types of the composite keys records are stored under. Each key has
+// the record ID as its only attribute.
+const (
+	userObjectType     = "identity~user"
+	spObjectType       = "identity~sp"
+	requestObjectType  = "identity~sprequest"
+	recoveryObjectType = "identity~recovery"
+)
+
+// legacyKeyPrefixes maps each object type to the prefix its records were
+// stored under before composite keys. Records under these keys are still read,
+// and move to their composite key the next time they are stored.
+var legacyKeyPrefixes = map[string]string{
+	userObjectType:     "user_",
+	spObjectType:       "sp_",
+	requestObjectType:  "sprequest_",
+	recoveryObjectType: "recovery_",
+}
+
+func recordKey(stub shim.ChaincodeStubInterface, objectType string, id string) (string, error) {
+	key, err := stub.CreateCompositeKey(objectType, []string{id})
+
+	if err != nil {
+		return "", newError(codeInvalidArgument, "Invalid ID: "+err.Error())
+	}
+
+	return key, nil
+}
+
+// getRecord reads the record id of objectType, falling back to its legacy key.
+func getRecord(stub shim.ChaincodeStubInterface, objectType string, id string) ([]byte, error) {
+	key, err := recordKey(stub, objectType, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := stub.GetState(key)
+
+	if err != nil || value != nil {
+		return value, err
+	}
+
+	return stub.GetState(legacyKeyPrefixes[objectType] + id)
+}
+
+// putRecord writes the record id of objectType under its composite key and
+// removes any copy left under its legacy key.
+func putRecord(stub shim.ChaincodeStubInterface, objectType string, id string, value []byte) error {
+	key, err := recordKey(stub, objectType, id)
+
+	if err != nil {
+		return err
+	}
+
+	err = stub.PutState(key, value)
+
+	if err != nil {
+		return err
+	}
+
+	return deleteLegacyRecord(stub, objectType, id)
+}
+
+// deleteRecord removes the record id of objectType under both key layouts.
+func deleteRecord(stub shim.ChaincodeStubInterface, objectType string, id string) error {
+	key, err := recordKey(stub, objectType, id)
+
+	if err != nil {
+		return err
+	}
+
+	err = stub.DelState(key)
+
+	if err != nil {
+		return err
+	}
+
+	return deleteLegacyRecord(stub, objectType, id)
+}
+
+func deleteLegacyRecord(stub shim.ChaincodeStubInterface, objectType string, id string) error {
+	legacyKey := legacyKeyPrefixes[objectType] + id
+	legacyValue, err := stub.GetState(legacyKey)
+
+	if err != nil || legacyValue == nil {
+		return err
+	}
+
+	return stub.DelState(legacyKey)
+}
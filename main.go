@@ -0,0 +1,17 @@
+//go:build !gateway
+// +build !gateway
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func main() {
+	err := shim.Start(new(IdentityChaincode))
+	if err != nil {
+		fmt.Printf("Error starting chaincode: %s", err)
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Current schema version of each stored record type. Records written before
+// versioning have version 0. Bump a version together with a new step in the
+// matching upgrade function.
+const (
+	userSchemaVersion            = 3
+	serviceProviderSchemaVersion = 2
+	requestSchemaVersion         = 1
+	recoverySchemaVersion        = 1
+)
+
+// upgradeUser brings a user read from the ledger up to the current schema.
+// The store helpers write the current version, so an upgraded record is
+// persisted the next time it is stored.
+func upgradeUser(user *User) {
+	if user.Version < 1 {
+		if user.Status == "" {
+			user.Status = statusActive
+		}
+	}
+
+	if user.Version < 2 {
+		user.DocType = userDocType
+	}
+
+	if user.Version < 3 {
+		// Users issued without a validity end expire five years after
+		// issuance, like every other user.
+		if user.ValidUntil == 0 && user.IssuedAt != 0 {
+			user.ValidUntil = defaultValidUntil(user.IssuedAt)
+		}
+	}
+
+	user.Version = userSchemaVersion
+}
+
+func upgradeServiceProvider(sp *ServiceProvider) {
+	if sp.Version < 1 {
+		// Providers registered before key sets existed only carry PublicKey.
+		if len(sp.Keys) == 0 && sp.PublicKey != "" {
+			sp.Keys = []ProviderKey{{KeyId: primaryKeyId, PublicKey: sp.PublicKey, Purpose: keyPurposeSigning}}
+		}
+	}
+
+	if sp.Version < 2 {
+		sp.DocType = spDocType
+	}
+
+	sp.Version = serviceProviderSchemaVersion
+}
+
+func upgradeServiceProviderRequest(request *ServiceProviderRequest) {
+	request.Version = requestSchemaVersion
+}
+
+func upgradePendingRecovery(recovery *PendingRecovery) {
+	recovery.Version = recoverySchemaVersion
+}
+
+// recordVersion reads the version of a stored record of any type.
+func recordVersion(value []byte) (int, error) {
+	var record struct {
+		Version int `json:"version"`
+	}
+
+	err := json.Unmarshal(value, &record)
+
+	return record.Version, err
+}
+
+// recordRewrite loads the record id through the compatibility layer and
+// stores it again, which upgrades it and moves it to its composite key.
+type recordRewrite func(stub shim.ChaincodeStubInterface, id string) error
+
+func rewriteUser(stub shim.ChaincodeStubInterface, id string) error {
+	user, err := loadUser(stub, id)
+
+	if err != nil {
+		return err
+	}
+
+	return storeUser(stub, id, user)
+}
+
+func rewriteServiceProvider(stub shim.ChaincodeStubInterface, id string) error {
+	sp, err := loadServiceProvider(stub, id)
+
+	if err != nil {
+		return err
+	}
+
+	return storeServiceProvider(stub, id, sp)
+}
+
+func rewriteServiceProviderRequest(stub shim.ChaincodeStubInterface, id string) error {
+	request, err := getServiceProviderRequest(stub, id)
+
+	if err != nil {
+		return err
+	}
+
+	request.Id = id
+
+	return putServiceProviderRequest(stub, request)
+}
+
+func rewritePendingRecovery(stub shim.ChaincodeStubInterface, id string) error {
+	recovery, err := loadPendingRecovery(stub, id)
+
+	if err != nil {
+		return err
+	}
+
+	return storePendingRecovery(stub, id, recovery)
+}
+
+// recordTypes describes each record type listPendingMigrations, migrate and
+// migrateKeys accept.
+var recordTypes = map[string]struct {
+	objectType    string
+	schemaVersion int
+	rewrite       recordRewrite
+}{
+	"user":      {userObjectType, userSchemaVersion, rewriteUser},
+	"sp":        {spObjectType, serviceProviderSchemaVersion, rewriteServiceProvider},
+	"sprequest": {requestObjectType, requestSchemaVersion, rewriteServiceProviderRequest},
+	"recovery":  {recoveryObjectType, recoverySchemaVersion, rewritePendingRecovery},
+}
+
+// MigrationPage is the result of one migrate or migrateKeys call. Bookmark is
+// only set by migrateKeys, and is empty once no legacy records are left.
+type MigrationPage struct {
+	Scanned  int    `json:"scanned"`
+	Migrated int    `json:"migrated"`
+	Bookmark string `json:"bookmark"`
+}
+
+// PendingMigrationPage is one page of listPendingMigrations. Bookmark is
+// passed to the next call and is empty once every record has been read.
+type PendingMigrationPage struct {
+	Ids      []string `json:"ids"`
+	Bookmark string   `json:"bookmark"`
+}
+
+// parseMigrationArgs checks the record type and page size arguments shared
+// by listPendingMigrations and migrateKeys, and returns the page size.
+func parseMigrationArgs(recordType string, pageSizeArg string) (int, error) {
+	if _, ok := recordTypes[recordType]; !ok {
+		return 0, newError(codeInvalidArgument, "Unknown record type: "+recordType)
+	}
+
+	pageSize, err := strconv.Atoi(pageSizeArg)
+
+	if err != nil || pageSize < 1 || pageSize > maxExportPageSize {
+		return 0, newError(codeInvalidArgument, "Page size must be between 1 and "+strconv.Itoa(maxExportPageSize))
+	}
+
+	return pageSize, nil
+}
+
+// listPendingMigrations returns the IDs of the records below the current
+// schema version among a page of records of one type. It takes the record
+// type, user, sp, sprequest or recovery, the page size and the bookmark of
+// the previous page. The IDs are passed to migrate, since paginated queries
+// are not allowed in transactions that write.
+func (t *IdentityChaincode) listPendingMigrations(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return incorrectArgumentCount()
+	}
+
+	pageSize, err := parseMigrationArgs(args[0], args[1])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	recordType := recordTypes[args[0]]
+	iterator, metadata, err := stub.GetStateByPartialCompositeKeyWithPagination(recordType.objectType, []string{}, int32(pageSize), args[2])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	defer iterator.Close()
+
+	page := PendingMigrationPage{Ids: []string{}}
+	read := 0
+
+	for iterator.HasNext() {
+		kv, err := iterator.Next()
+
+		if err != nil {
+			return errorResponse(err)
+		}
+
+		read++
+		_, attributes, err := stub.SplitCompositeKey(kv.Key)
+
+		if err != nil {
+			return errorResponse(err)
+		}
+
+		version, err := recordVersion(kv.Value)
+
+		if err != nil {
+			return errorResponse(withContext(args[0]+" "+attributes[0]+": ", err))
+		}
+
+		if version < recordType.schemaVersion {
+			page.Ids = append(page.Ids, attributes[0])
+		}
+	}
+
+	if read == pageSize {
+		page.Bookmark = metadata.Bookmark
+	}
+
+	pageJson, err := json.Marshal(page)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(pageJson)
+}
+
+// migrate rewrites records of one type to the current schema. It takes the
+// record type and a JSON array of at most maxExportPageSize record IDs, as
+// returned by listPendingMigrations. Records that no longer exist or are
+// already current are skipped, so a list can be submitted again safely.
+// Records still under legacy keys are handled by migrateKeys.
+func (t *IdentityChaincode) migrate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return incorrectArgumentCount()
+	}
+
+	recordType, ok := recordTypes[args[0]]
+
+	if !ok {
+		return invalidArgument("Unknown record type: " + args[0])
+	}
+
+	ids, err := parseStringList(args[1])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if len(ids) > maxExportPageSize {
+		return invalidArgument("At most " + strconv.Itoa(maxExportPageSize) + " records can be migrated at once")
+	}
+
+	var page MigrationPage
+
+	for _, id := range ids {
+		page.Scanned++
+		value, err := getRecord(stub, recordType.objectType, id)
+
+		if err != nil {
+			return errorResponse(err)
+		}
+
+		if value == nil {
+			continue
+		}
+
+		version, err := recordVersion(value)
+
+		if err != nil {
+			return errorResponse(withContext(args[0]+" "+id+": ", err))
+		}
+
+		if version >= recordType.schemaVersion {
+			continue
+		}
+
+		err = recordType.rewrite(stub, id)
+
+		if err != nil {
+			return errorResponse(withContext(args[0]+" "+id+": ", err))
+		}
+
+		page.Migrated++
+	}
+
+	pageJson, err := json.Marshal(page)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(pageJson)
+}
+
+// migrateKeys moves a page of records of one type from their legacy keys to
+// composite keys, upgrading them to the current schema on the way. It takes
+// the record type and the page size. Moved records leave the legacy range, so
+// it is called again, once the previous call has committed, until it reports
+// that no legacy records are left by returning an empty bookmark.
+func (t *IdentityChaincode) migrateKeys(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return incorrectArgumentCount()
+	}
+
+	pageSize, err := parseMigrationArgs(args[0], args[1])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	recordType := recordTypes[args[0]]
+	prefix := legacyKeyPrefixes[recordType.objectType]
+	startKey, endKey := prefixRange(prefix)
+	iterator, err := stub.GetStateByRange(startKey, endKey)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	defer iterator.Close()
+
+	var page MigrationPage
+
+	for iterator.HasNext() {
+		kv, err := iterator.Next()
+
+		if err != nil {
+			return errorResponse(err)
+		}
+
+		if page.Scanned == pageSize {
+			page.Bookmark = kv.Key
+			break
+		}
+
+		page.Scanned++
+		err = recordType.rewrite(stub, kv.Key[len(prefix):])
+
+		if err != nil {
+			return errorResponse(withContext(kv.Key+": ", err))
+		}
+
+		page.Migrated++
+	}
+
+	pageJson, err := json.Marshal(page)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(pageJson)
+}
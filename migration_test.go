@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestMigrateListedRecords(t *testing.T) {
+	stub := newTestStub(t)
+	state := map[string][]byte{}
+
+	for i, version := range []int{0, userSchemaVersion, 1, 0, userSchemaVersion} {
+		key, err := stub.CreateCompositeKey(userObjectType, []string{fmt.Sprintf("user%d", i)})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		state[key] = []byte(fmt.Sprintf(`{"publicKey":"key%d","metadataHash":"hash","version":%d}`, i, version))
+	}
+
+	stub.Load(state)
+
+	var ids []string
+	bookmark := ""
+
+	for pages := 1; ; pages++ {
+		response := stub.Invoke("listPendingMigrations", "user", "2", bookmark)
+		expectStatus(t, response, shim.OK)
+
+		var page PendingMigrationPage
+		err := json.Unmarshal(response.Payload, &page)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids = append(ids, page.Ids...)
+		bookmark = page.Bookmark
+
+		if bookmark == "" {
+			if pages != 3 {
+				t.Fatalf("expected 3 pages, got %d", pages)
+			}
+
+			break
+		}
+	}
+
+	if !reflect.DeepEqual(ids, []string{"user0", "user2", "user3"}) {
+		t.Fatalf("unexpected pending migrations %v", ids)
+	}
+
+	// A deleted or current record in the list is skipped.
+	idsJson, _ := json.Marshal(append(ids, "user1", "nobody"))
+	migrate := func() MigrationPage {
+		response := stub.Invoke("migrate", "user", string(idsJson))
+		expectStatus(t, response, shim.OK)
+
+		var page MigrationPage
+		err := json.Unmarshal(response.Payload, &page)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return page
+	}
+
+	if page := migrate(); page.Scanned != 5 || page.Migrated != 3 || page.Bookmark != "" {
+		t.Fatalf("unexpected migration %+v", page)
+	}
+
+	for _, id := range ids {
+		var user User
+		err := json.Unmarshal(storedRecord(t, stub, userObjectType, id), &user)
+
+		if err != nil || user.Version != userSchemaVersion || user.DocType != userDocType {
+			t.Fatalf("%s was not migrated: %+v %v", id, user, err)
+		}
+	}
+
+	if page := migrate(); page.Migrated != 0 {
+		t.Fatalf("migrated current records again: %+v", page)
+	}
+
+	response := stub.Invoke("listPendingMigrations", "user", "10", "")
+	expectStatus(t, response, shim.OK)
+
+	if string(response.Payload) != `{"ids":[],"bookmark":""}` {
+		t.Fatalf("unexpected pending migrations %s", response.Payload)
+	}
+
+	tooMany, _ := json.Marshal(make([]string, maxExportPageSize+1))
+	expectError(t, stub.Invoke("migrate", "user", string(tooMany)), codeInvalidArgument)
+	expectError(t, stub.Invoke("migrate", "user", "user0"), codeInvalidArgument)
+	expectError(t, stub.Invoke("migrate", "vehicle", `["user0"]`), codeInvalidArgument)
+	expectError(t, stub.Invoke("listPendingMigrations", "user", "0", ""), codeInvalidArgument)
+
+	stub.SetCreator(testOtherMspId)
+	expectError(t, stub.Invoke("migrate", "user", `["user0"]`), codeUnauthorized)
+	expectError(t, stub.Invoke("listPendingMigrations", "user", "10", ""), codeUnauthorized)
+}
+
+func TestMigrateKeysMovesLegacyRecords(t *testing.T) {
+	stub := newTestStub(t)
+
+	for i := 0; i < 3; i++ {
+		stub.Seed(fmt.Sprintf("user_user%d", i), []byte(fmt.Sprintf(`{"publicKey":"key%d","metadataHash":"hash"}`, i)))
+	}
+
+	// Legacy records are read before they are moved.
+	expectStatus(t, stub.Invoke("getIdentity", "user1"), shim.OK)
+
+	moved := 0
+
+	for calls := 1; ; calls++ {
+		response := stub.Invoke("migrateKeys", "user", "2")
+		expectStatus(t, response, shim.OK)
+
+		var page MigrationPage
+		err := json.Unmarshal(response.Payload, &page)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		moved += page.Migrated
+
+		if page.Bookmark == "" {
+			if moved != 3 || calls != 2 {
+				t.Fatalf("expected 3 records moved in 2 calls, got %d in %d", moved, calls)
+			}
+
+			break
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		if stub.State[fmt.Sprintf("user_user%d", i)] != nil {
+			t.Fatalf("user%d is still under its legacy key", i)
+		}
+
+		var user User
+		err := json.Unmarshal(storedRecord(t, stub, userObjectType, fmt.Sprintf("user%d", i)), &user)
+
+		if err != nil || user.PublicKey != fmt.Sprintf("key%d", i) || user.Version != userSchemaVersion {
+			t.Fatalf("user%d was not moved: %+v %v", i, user, err)
+		}
+	}
+}
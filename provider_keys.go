@@ -0,0 +1,281 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	keyPurposeSigning    = "signing"
+	keyPurposeEncryption = "encryption"
+
+	// primaryKeyId identifies the key a provider registered at onboarding.
+	primaryKeyId = "primary"
+)
+
+// ProviderKey is one entry of a service provider's key set. ValidUntil and
+// RetiredAt are zero while the key has no end of validity.
+type ProviderKey struct {
+	KeyId      string `json:"keyId"`
+	PublicKey  string `json:"publicKey"`
+	Purpose    string `json:"purpose"`
+	ValidFrom  int64  `json:"validFrom"`
+	ValidUntil int64  `json:"validUntil,omitempty"`
+	RetiredAt  int64  `json:"retiredAt,omitempty"`
+}
+
+func (key *ProviderKey) activeAt(now int64) bool {
+	return key.RetiredAt == 0 && key.ValidFrom <= now && (key.ValidUntil == 0 || now < key.ValidUntil)
+}
+
+// primaryProviderKey builds the signing key entry for the public key a
+// provider registers with.
+func primaryProviderKey(stub shim.ChaincodeStubInterface, publicKey string) (ProviderKey, error) {
+	var key ProviderKey
+
+	_, err := parsePublicKey(publicKey)
+
+	if err != nil {
+		return key, err
+	}
+
+	now, err := txTime(stub)
+
+	if err != nil {
+		return key, err
+	}
+
+	key.KeyId = primaryKeyId
+	key.PublicKey = publicKey
+	key.Purpose = keyPurposeSigning
+	key.ValidFrom = now
+
+	return key, nil
+}
+
+func findProviderKey(sp *ServiceProvider, keyId string) *ProviderKey {
+	for i := range sp.Keys {
+		if sp.Keys[i].KeyId == keyId {
+			return &sp.Keys[i]
+		}
+	}
+
+	return nil
+}
+
+// verifyProviderSignature checks that signature was made over message by the
+// provider's signing key keyId and that the key is active at the transaction time.
+func verifyProviderSignature(stub shim.ChaincodeStubInterface, sp *ServiceProvider, keyId string, message string, signature string) error {
+	key := findProviderKey(sp, keyId)
+
+	if key == nil {
+		return newError(codeUnauthorized, "Unknown key ID: "+keyId)
+	}
+
+	if key.Purpose != keyPurposeSigning {
+		return newError(codeUnauthorized, "Key "+keyId+" is not a signing key")
+	}
+
+	now, err := txTime(stub)
+
+	if err != nil {
+		return err
+	}
+
+	if !key.activeAt(now) {
+		return newError(codeUnauthorized, "Key "+keyId+" is not active")
+	}
+
+	return verifySignature(key.PublicKey, message, signature)
+}
+
+func parseTimestampArg(arg string) (int64, error) {
+	if arg == "" {
+		return 0, nil
+	}
+
+	value, err := strconv.ParseInt(arg, 10, 64)
+
+	if err != nil || value < 0 {
+		return 0, newError(codeInvalidArgument, "Invalid timestamp: "+arg)
+	}
+
+	return value, nil
+}
+
+// addProviderKey adds a key to a provider's key set. The request must be
+// signed by one of the provider's active signing keys.
+func (t *IdentityChaincode) addProviderKey(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 8 {
+		return incorrectArgumentCount()
+	}
+
+	sp, err := loadServiceProvider(stub, args[0])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if sp == nil {
+		return notFound("Service provider not found")
+	}
+
+	err = verifyProviderSignature(stub, sp, args[6], signedMessage("addProviderKey", args[:7]...), args[7])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if findProviderKey(sp, args[1]) != nil {
+		return alreadyExists("Key ID already exists")
+	}
+
+	if args[3] != keyPurposeSigning && args[3] != keyPurposeEncryption {
+		return invalidArgument("Invalid key purpose: " + args[3])
+	}
+
+	_, err = parsePublicKey(args[2])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	validFrom, err := parseTimestampArg(args[4])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	validUntil, err := parseTimestampArg(args[5])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if validFrom == 0 {
+		validFrom, err = txTime(stub)
+
+		if err != nil {
+			return errorResponse(err)
+		}
+	}
+
+	if validUntil != 0 && validUntil <= validFrom {
+		return invalidArgument("Key validity ends before it starts")
+	}
+
+	var key ProviderKey
+	key.KeyId = args[1]
+	key.PublicKey = args[2]
+	key.Purpose = args[3]
+	key.ValidFrom = validFrom
+	key.ValidUntil = validUntil
+	sp.Keys = append(sp.Keys, key)
+
+	err = storeServiceProvider(stub, args[0], sp)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(nil)
+}
+
+// retireProviderKey retires a key from a provider's key set. The last active
+// signing key cannot be retired, so a provider can never lock itself out.
+// Retiring the key the provider advertises as its public key, normally the
+// primary key, advertises its oldest remaining active signing key instead.
+func (t *IdentityChaincode) retireProviderKey(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 4 {
+		return incorrectArgumentCount()
+	}
+
+	sp, err := loadServiceProvider(stub, args[0])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if sp == nil {
+		return notFound("Service provider not found")
+	}
+
+	err = verifyProviderSignature(stub, sp, args[2], signedMessage("retireProviderKey", args[:3]...), args[3])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	key := findProviderKey(sp, args[1])
+
+	if key == nil {
+		return notFound("Unknown key ID: " + args[1])
+	}
+
+	if key.RetiredAt != 0 {
+		return failedPrecondition("Key is already retired")
+	}
+
+	now, err := txTime(stub)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	key.RetiredAt = now
+
+	var firstActiveSigningKey *ProviderKey
+
+	for i := range sp.Keys {
+		if sp.Keys[i].Purpose == keyPurposeSigning && sp.Keys[i].activeAt(now) {
+			firstActiveSigningKey = &sp.Keys[i]
+			break
+		}
+	}
+
+	if firstActiveSigningKey == nil {
+		return failedPrecondition("Cannot retire the last active signing key")
+	}
+
+	// The provider's advertised public key follows its oldest active signing
+	// key once the key it advertised is retired.
+	if key.PublicKey == sp.PublicKey {
+		sp.PublicKey = firstActiveSigningKey.PublicKey
+	}
+
+	err = storeServiceProvider(stub, args[0], sp)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(nil)
+}
+
+// verifyProviderMessage lets anyone check a message signed by a provider
+// against one of its key IDs. It returns true or false.
+func (t *IdentityChaincode) verifyProviderMessage(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 4 {
+		return incorrectArgumentCount()
+	}
+
+	sp, err := loadServiceProvider(stub, args[0])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if sp == nil {
+		return notFound("Service provider not found")
+	}
+
+	err = verifyProviderSignature(stub, sp, args[1], args[2], args[3])
+
+	if err != nil {
+		return shim.Success([]byte("false"))
+	}
+
+	return shim.Success([]byte("true"))
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+
+	"github.com/mars-identity-chaincode/teststub"
+)
+
+// addTestProviderKey adds a signing key to sp, signed with the primary key.
+func addTestProviderKey(t *testing.T, stub *teststub.Stub, spId string, primaryKey *secp256k1.PrivateKey, keyId string, key *secp256k1.PrivateKey) {
+	t.Helper()
+	args := []string{spId, keyId, testPublicKey(key), keyPurposeSigning, "", "", primaryKeyId}
+	expectStatus(t, stub.Invoke(append(append([]string{"addProviderKey"}, args...), signTestMessage(t, primaryKey, "addProviderKey", args...))...), shim.OK)
+}
+
+func getTestServiceProvider(t *testing.T, stub *teststub.Stub, spId string) ServiceProvider {
+	t.Helper()
+	response := stub.Invoke("getServiceProvider", spId)
+	expectStatus(t, response, shim.OK)
+
+	var sp ServiceProvider
+	err := json.Unmarshal(response.Payload, &sp)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sp
+}
+
+func TestAddProviderKeyRequiresActiveSigningKey(t *testing.T) {
+	stub := newTestStub(t)
+	primaryKey, secondKey, encryptionKey := newTestKey(t), newTestKey(t), newTestKey(t)
+	expectStatus(t, stub.Invoke("addServiceProvider", "bank", "Bank", testPublicKey(primaryKey), "finance", `["publicKey"]`, "", "BankMSP"), shim.OK)
+	expectError(t, stub.Invoke("addServiceProvider", "bank", "Bank", testPublicKey(secondKey), "finance", `["publicKey"]`, "", "BankMSP"), codeAlreadyExists)
+
+	// A key the provider does not hold cannot sign for it.
+	args := []string{"bank", "k2", testPublicKey(secondKey), keyPurposeSigning, "", "", primaryKeyId}
+	expectError(t, stub.Invoke(append(append([]string{"addProviderKey"}, args...), signTestMessage(t, secondKey, "addProviderKey", args...))...), codeUnauthorized)
+
+	addTestProviderKey(t, stub, "bank", primaryKey, "k2", secondKey)
+
+	args = []string{"bank", "enc", testPublicKey(encryptionKey), keyPurposeEncryption, "", "", "k2"}
+	expectStatus(t, stub.Invoke(append(append([]string{"addProviderKey"}, args...), signTestMessage(t, secondKey, "addProviderKey", args...))...), shim.OK)
+
+	// An encryption key cannot authorize changes to the key set.
+	args = []string{"bank", "k3", newTestPublicKey(t), keyPurposeSigning, "", "", "enc"}
+	expectError(t, stub.Invoke(append(append([]string{"addProviderKey"}, args...), signTestMessage(t, encryptionKey, "addProviderKey", args...))...), codeUnauthorized)
+
+	message, signature := signedMessage("hello"), signTestMessage(t, secondKey, "hello")
+	response := stub.Invoke("verifyProviderMessage", "bank", "k2", message, signature)
+	expectStatus(t, response, shim.OK)
+
+	if string(response.Payload) != "true" {
+		t.Fatalf("expected the message to verify, got %s", response.Payload)
+	}
+
+	response = stub.Invoke("verifyProviderMessage", "bank", primaryKeyId, message, signature)
+
+	if string(response.Payload) != "false" {
+		t.Fatalf("expected a signature by another key to fail, got %s", response.Payload)
+	}
+}
+
+func TestRetirePrimaryProviderKey(t *testing.T) {
+	stub := newTestStub(t)
+	primaryKey, secondKey := newTestKey(t), newTestKey(t)
+	expectStatus(t, stub.Invoke("addServiceProvider", "bank", "Bank", testPublicKey(primaryKey), "finance", `["publicKey"]`, "", "BankMSP"), shim.OK)
+	addTestProviderKey(t, stub, "bank", primaryKey, "k2", secondKey)
+
+	if sp := getTestServiceProvider(t, stub, "bank"); sp.PublicKey != testPublicKey(primaryKey) {
+		t.Fatalf("expected the primary key to be advertised, got %s", sp.PublicKey)
+	}
+
+	retirement := []string{"bank", primaryKeyId, "k2"}
+	expectStatus(t, stub.Invoke(append(append([]string{"retireProviderKey"}, retirement...), signTestMessage(t, secondKey, "retireProviderKey", retirement...))...), shim.OK)
+
+	sp := getTestServiceProvider(t, stub, "bank")
+
+	if sp.PublicKey != testPublicKey(secondKey) || findProviderKey(&sp, primaryKeyId).RetiredAt == 0 {
+		t.Fatalf("expected the remaining signing key to be advertised, got %+v", sp)
+	}
+
+	// The remaining key is the last active signing key.
+	retirement = []string{"bank", "k2", "k2"}
+	response := stub.Invoke(append(append([]string{"retireProviderKey"}, retirement...), signTestMessage(t, secondKey, "retireProviderKey", retirement...))...)
+	expectError(t, response, codeFailedPrecondition)
+}
+
+func TestRetireSecondaryProviderKeyKeepsPublicKey(t *testing.T) {
+	stub := newTestStub(t)
+	primaryKey, secondKey := newTestKey(t), newTestKey(t)
+	expectStatus(t, stub.Invoke("addServiceProvider", "bank", "Bank", testPublicKey(primaryKey), "finance", `["publicKey"]`, "", "BankMSP"), shim.OK)
+	addTestProviderKey(t, stub, "bank", primaryKey, "k2", secondKey)
+
+	retirement := []string{"bank", "k2", primaryKeyId}
+	expectStatus(t, stub.Invoke(append(append([]string{"retireProviderKey"}, retirement...), signTestMessage(t, primaryKey, "retireProviderKey", retirement...))...), shim.OK)
+
+	if sp := getTestServiceProvider(t, stub, "bank"); sp.PublicKey != testPublicKey(primaryKey) || findProviderKey(&sp, "k2").RetiredAt == 0 {
+		t.Fatalf("expected only k2 to be retired, got %+v", sp)
+	}
+
+	// A retired key no longer signs, and the last signing key cannot be retired.
+	retirement = []string{"bank", primaryKeyId, "k2"}
+	expectError(t, stub.Invoke(append(append([]string{"retireProviderKey"}, retirement...), signTestMessage(t, secondKey, "retireProviderKey", retirement...))...), codeUnauthorized)
+
+	retirement = []string{"bank", primaryKeyId, primaryKeyId}
+	expectError(t, stub.Invoke(append(append([]string{"retireProviderKey"}, retirement...), signTestMessage(t, primaryKey, "retireProviderKey", retirement...))...), codeFailedPrecondition)
+}
+
+func TestAddProviderKeySignatureCoversBothArgumentForms(t *testing.T) {
+	primaryKey, secondKey := newTestKey(t), newTestKey(t)
+	args := []string{"bank", "k2", testPublicKey(secondKey), keyPurposeSigning, "", "", primaryKeyId}
+	signature := signTestMessage(t, primaryKey, "addProviderKey", args...)
+
+	request, err := json.Marshal(addProviderKeyArgs{SpId: "bank", KeyId: "k2", PublicKey: testPublicKey(secondKey), Purpose: keyPurposeSigning, SigningKeyId: primaryKeyId, Signature: signature})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, callArgs := range [][]string{append(args, signature), {string(request)}} {
+		stub := newTestStub(t)
+		expectStatus(t, stub.Invoke("addServiceProvider", "bank", "Bank", testPublicKey(primaryKey)), shim.OK)
+		expectStatus(t, stub.Invoke(append([]string{"addProviderKey"}, callArgs...)...), shim.OK)
+
+		if sp := getTestServiceProvider(t, stub, "bank"); findProviderKey(&sp, "k2") == nil {
+			t.Fatalf("key was not added with arguments %v", callArgs)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Scopes name the user attributes a service provider may read.
+const (
+	scopePublicKey    = "publicKey"
+	scopeMetadataHash = "metadataHash"
+	scopePermissions  = "permissions"
+)
+
+// categoryScopes lists the scopes each service provider category is permitted to request.
+var categoryScopes = map[string][]string{
+	"healthcare": {scopePublicKey, scopeMetadataHash, scopePermissions},
+	"transport":  {scopePublicKey, scopePermissions},
+	"finance":    {scopePublicKey, scopeMetadataHash},
+	"habitat":    {scopePublicKey, scopePermissions},
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateCategoryScopes checks that category is known and that every scope is
+// permitted for it.
+func validateCategoryScopes(category string, scopes []string) error {
+	permitted, ok := categoryScopes[category]
+
+	if !ok {
+		return newError(codeInvalidArgument, "Unknown service provider category: "+category)
+	}
+
+	for _, scope := range scopes {
+		if !containsString(permitted, scope) {
+			return newError(codeInvalidArgument, "Scope "+scope+" is not permitted for category "+category)
+		}
+	}
+
+	return nil
+}
+
+// checkProviderScopes verifies that the provider may request every scope in
+// scopes. Functions that hand user data to a provider must call it first.
+func checkProviderScopes(sp *ServiceProvider, scopes []string) error {
+	err := validateCategoryScopes(sp.Category, scopes)
+
+	if err != nil {
+		return newError(codeUnauthorized, err.Error())
+	}
+
+	for _, scope := range scopes {
+		if !containsString(sp.AllowedScopes, scope) {
+			return newError(codeUnauthorized, "Scope "+scope+" is not allowed for this service provider")
+		}
+	}
+
+	return nil
+}
+
+// lookupIdentity returns the requested attributes of a user to a service
+// provider. The caller must belong to the MSP that owns the provider.
+func (t *IdentityChaincode) lookupIdentity(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return incorrectArgumentCount()
+	}
+
+	sp, err := loadServiceProvider(stub, args[0])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if sp == nil {
+		return notFound("Service provider not found")
+	}
+
+	mspId, err := getCreatorMspId(stub)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if mspId == "" || mspId != sp.MspId {
+		return unauthorized()
+	}
+
+	scopes, err := parseStringList(args[2])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	err = checkProviderScopes(sp, scopes)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	user, err := loadUser(stub, args[1])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if user == nil {
+		return notFound("User not found")
+	}
+
+	now, err := txTime(stub)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	attributes := map[string]interface{}{"status": identityStatus(user, now)}
+
+	for _, scope := range scopes {
+		switch scope {
+		case scopePublicKey:
+			attributes[scope] = user.PublicKey
+		case scopeMetadataHash:
+			attributes[scope] = user.MetadataHash
+		case scopePermissions:
+			attributes[scope] = user.Permissions
+		}
+	}
+
+	attributesJson, err := json.Marshal(attributes)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(attributesJson)
+}
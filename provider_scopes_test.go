@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestRegistrationRejectsScopesOutsideCategory(t *testing.T) {
+	stub := newTestStub(t)
+	stub.SetCreator(testOtherMspId)
+
+	tests := []struct {
+		category string
+		scopes   string
+		code     string
+	}{
+		{"mining", `["publicKey"]`, codeInvalidArgument},
+		{"finance", `["permissions"]`, codeInvalidArgument},
+		{"transport", `["publicKey","metadataHash"]`, codeInvalidArgument},
+	}
+
+	for _, test := range tests {
+		response := stub.Invoke("requestServiceProviderRegistration", "bank", "Bank", newTestPublicKey(t), test.category, test.scopes, "")
+		expectError(t, response, test.code)
+	}
+
+	stub.SetCreator(testAuthorityMspId)
+	response := stub.Invoke("addServiceProvider", "bank", "Bank", newTestPublicKey(t), "finance", `["permissions"]`, "", testOtherMspId)
+	expectError(t, response, codeInvalidArgument)
+}
+
+func TestLookupIdentityReturnsAllowedScopes(t *testing.T) {
+	stub := newTestStub(t)
+	publicKey := newTestPublicKey(t)
+	expectStatus(t, stub.Invoke("issueIdentity", "alice", publicKey, "hash1"), shim.OK)
+	expectStatus(t, stub.Invoke("addServiceProvider", "clinic", "Clinic", newTestPublicKey(t), "healthcare", `["publicKey","metadataHash"]`, "https://clinic.example", testOtherMspId), shim.OK)
+
+	// Only members of the MSP that owns the provider may look up on its behalf.
+	expectError(t, stub.Invoke("lookupIdentity", "clinic", "alice", `["publicKey"]`), codeUnauthorized)
+
+	stub.SetCreator(testOtherMspId)
+	response := stub.Invoke("lookupIdentity", "clinic", "alice", `["publicKey","metadataHash"]`)
+	expectStatus(t, response, shim.OK)
+
+	var attributes map[string]interface{}
+	err := json.Unmarshal(response.Payload, &attributes)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(attributes) != 3 || attributes["status"] != statusActive || attributes["publicKey"] != publicKey || attributes["metadataHash"] != "hash1" {
+		t.Fatalf("unexpected attributes %v", attributes)
+	}
+
+	// Permissions are permitted for healthcare but were not granted to the clinic.
+	expectError(t, stub.Invoke("lookupIdentity", "clinic", "alice", `["permissions"]`), codeUnauthorized)
+	expectError(t, stub.Invoke("lookupIdentity", "clinic", "bob", `["publicKey"]`), codeNotFound)
+	expectError(t, stub.Invoke("lookupIdentity", "pharmacy", "alice", `["publicKey"]`), codeNotFound)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Document types stored in the docType field, so that rich queries can tell
+// record types apart. The indexes in META-INF/statedb/couchdb/indexes lead
+// with this field.
+const (
+	userDocType = "user"
+	spDocType   = "sp"
+)
+
+// IdentityQuery is the selector accepted by queryIdentities. Only these
+// fields can be queried, so every query is served by a shipped index. Status,
+// the issuance range and Permission apply to users, and Category to service
+// providers. Zero fields are not filtered on.
+type IdentityQuery struct {
+	RecordType string `json:"recordType"`
+	Status     string `json:"status,omitempty"`
+	IssuedFrom int64  `json:"issuedFrom,omitempty"`
+	IssuedTo   int64  `json:"issuedTo,omitempty"`
+	Permission string `json:"permission,omitempty"`
+	Category   string `json:"category,omitempty"`
+}
+
+// QueryResult is one record matched by queryIdentities. Users are returned
+// in full to the identity authority and in the status view to other members.
+type QueryResult struct {
+	Id     string      `json:"id"`
+	Record interface{} `json:"record"`
+}
+
+// QueryPage is one page of queryIdentities. Bookmark is passed to the next
+// call and is empty once every match has been returned.
+type QueryPage struct {
+	Records  []QueryResult `json:"records"`
+	Bookmark string        `json:"bookmark"`
+}
+
+// identitySelector builds the CouchDB selector for query at the time now.
+// Expiry is not stored, so the active and expired statuses are translated
+// into conditions on validUntil, which every stored user has.
+func identitySelector(query IdentityQuery, now int64) (map[string]interface{}, error) {
+	selector := map[string]interface{}{}
+
+	switch query.RecordType {
+	case "", userDocType:
+		if query.Category != "" {
+			return nil, newError(codeInvalidArgument, "Users cannot be queried by category")
+		}
+
+		selector["docType"] = userDocType
+
+		switch query.Status {
+		case "":
+		case statusActive:
+			selector["status"] = statusActive
+			selector["validUntil"] = map[string]interface{}{"$gt": now}
+		case statusExpired:
+			selector["validUntil"] = map[string]interface{}{"$gt": 0, "$lte": now}
+		default:
+			return nil, newError(codeInvalidArgument, "Unknown status: "+query.Status)
+		}
+
+		if query.IssuedFrom != 0 || query.IssuedTo != 0 {
+			if query.IssuedTo != 0 && query.IssuedTo <= query.IssuedFrom {
+				return nil, newError(codeInvalidArgument, "Issuance range ends before it starts")
+			}
+
+			issuedAt := map[string]interface{}{"$gte": query.IssuedFrom}
+
+			if query.IssuedTo != 0 {
+				issuedAt["$lt"] = query.IssuedTo
+			}
+
+			selector["issuedAt"] = issuedAt
+		}
+
+		if query.Permission != "" {
+			selector["permissions"] = map[string]interface{}{"$elemMatch": map[string]interface{}{"$eq": query.Permission}}
+		}
+	case spDocType:
+		if query.Status != "" || query.IssuedFrom != 0 || query.IssuedTo != 0 || query.Permission != "" {
+			return nil, newError(codeInvalidArgument, "Service providers can only be queried by category")
+		}
+
+		selector["docType"] = spDocType
+
+		if query.Category != "" {
+			if _, ok := categoryScopes[query.Category]; !ok {
+				return nil, newError(codeInvalidArgument, "Unknown service provider category: "+query.Category)
+			}
+
+			selector["category"] = query.Category
+		}
+	default:
+		return nil, newError(codeInvalidArgument, "Unknown record type: "+query.RecordType)
+	}
+
+	return selector, nil
+}
+
+// queryIdentities runs a rich query over users or service providers. It
+// takes an IdentityQuery as JSON, the page size and the bookmark of the
+// previous page, and needs CouchDB as the state database. Records written
+// before the docType field existed are only matched once migrated.
+func (t *IdentityChaincode) queryIdentities(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return incorrectArgumentCount()
+	}
+
+	var query IdentityQuery
+	decoder := json.NewDecoder(strings.NewReader(args[0]))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&query)
+
+	if err != nil {
+		return invalidArgument("Expected a JSON identity query")
+	}
+
+	pageSize, err := strconv.Atoi(args[1])
+
+	if err != nil || pageSize < 1 || pageSize > maxExportPageSize {
+		return invalidArgument("Page size must be between 1 and " + strconv.Itoa(maxExportPageSize))
+	}
+
+	now, err := txTime(stub)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	selector, err := identitySelector(query, now)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	authority, err := isIdentityAuthority(stub)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	queryJson, err := json.Marshal(map[string]interface{}{"selector": selector})
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	iterator, metadata, err := stub.GetQueryResultWithPagination(string(queryJson), int32(pageSize), args[2])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	defer iterator.Close()
+
+	page := QueryPage{Records: []QueryResult{}}
+
+	for iterator.HasNext() {
+		kv, err := iterator.Next()
+
+		if err != nil {
+			return errorResponse(err)
+		}
+
+		_, attributes, err := stub.SplitCompositeKey(kv.Key)
+
+		if err != nil {
+			return errorResponse(err)
+		}
+
+		result := QueryResult{Id: attributes[0]}
+
+		if selector["docType"] == userDocType {
+			var user User
+			err = json.Unmarshal(kv.Value, &user)
+			upgradeUser(&user)
+			user.Status = identityStatus(&user, now)
+			result.Record = statusView(&user)
+
+			if authority {
+				result.Record = user
+			}
+		} else {
+			var sp ServiceProvider
+			err = json.Unmarshal(kv.Value, &sp)
+			upgradeServiceProvider(&sp)
+			result.Record = sp
+		}
+
+		if err != nil {
+			return errorResponse(err)
+		}
+
+		page.Records = append(page.Records, result)
+	}
+
+	if len(page.Records) == pageSize {
+		page.Bookmark = metadata.Bookmark
+	}
+
+	pageJson, err := json.Marshal(page)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(pageJson)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+
+	"github.com/mars-identity-chaincode/teststub"
+)
+
+// queryIds runs queryIdentities page by page and returns the IDs of every
+// matched record.
+func queryIds(t *testing.T, stub *teststub.Stub, query string, pageSize int) []string {
+	t.Helper()
+	ids := []string{}
+	bookmark := ""
+
+	for {
+		response := stub.Invoke("queryIdentities", query, strconv.Itoa(pageSize), bookmark)
+		expectStatus(t, response, shim.OK)
+
+		var page QueryPage
+		err := json.Unmarshal(response.Payload, &page)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, result := range page.Records {
+			ids = append(ids, result.Id)
+		}
+
+		if page.Bookmark == "" {
+			return ids
+		}
+
+		bookmark = page.Bookmark
+	}
+}
+
+func expectIds(t *testing.T, ids []string, expected ...string) {
+	t.Helper()
+
+	if len(ids) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, ids)
+	}
+
+	for i := range ids {
+		if ids[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, ids)
+		}
+	}
+}
+
+func TestIdentitySelector(t *testing.T) {
+	tests := []struct {
+		query    IdentityQuery
+		selector string
+		code     string
+	}{
+		{IdentityQuery{}, `{"docType":"user"}`, ""},
+		{IdentityQuery{Status: statusActive}, `{"docType":"user","status":"active","validUntil":{"$gt":1000}}`, ""},
+		{IdentityQuery{Status: statusExpired}, `{"docType":"user","validUntil":{"$gt":0,"$lte":1000}}`, ""},
+		{IdentityQuery{IssuedFrom: 10, IssuedTo: 20}, `{"docType":"user","issuedAt":{"$gte":10,"$lt":20}}`, ""},
+		{IdentityQuery{IssuedFrom: 10}, `{"docType":"user","issuedAt":{"$gte":10}}`, ""},
+		{IdentityQuery{Permission: "vote"}, `{"docType":"user","permissions":{"$elemMatch":{"$eq":"vote"}}}`, ""},
+		{IdentityQuery{RecordType: spDocType, Category: "finance"}, `{"category":"finance","docType":"sp"}`, ""},
+		{IdentityQuery{Status: "revoked"}, "", codeInvalidArgument},
+		{IdentityQuery{IssuedFrom: 20, IssuedTo: 10}, "", codeInvalidArgument},
+		{IdentityQuery{Category: "finance"}, "", codeInvalidArgument},
+		{IdentityQuery{RecordType: spDocType, Status: statusActive}, "", codeInvalidArgument},
+		{IdentityQuery{RecordType: spDocType, Permission: "vote"}, "", codeInvalidArgument},
+		{IdentityQuery{RecordType: spDocType, Category: "mining"}, "", codeInvalidArgument},
+		{IdentityQuery{RecordType: "vehicle"}, "", codeInvalidArgument},
+	}
+
+	for _, test := range tests {
+		selector, err := identitySelector(test.query, 1000)
+
+		if test.code != "" {
+			if chaincodeError, ok := err.(*ChaincodeError); !ok || chaincodeError.Code != test.code {
+				t.Errorf("%+v: expected %s, got %v", test.query, test.code, err)
+			}
+
+			continue
+		}
+
+		selectorJson, _ := json.Marshal(selector)
+
+		if err != nil || string(selectorJson) != test.selector {
+			t.Errorf("%+v: expected %s, got %s: %v", test.query, test.selector, selectorJson, err)
+		}
+	}
+}
+
+func TestQueryIdentitiesByStatusAndIssuance(t *testing.T) {
+	stub := newTestStub(t)
+	start := stub.Now().Unix()
+
+	expectStatus(t, stub.Invoke("issueIdentity", "alice", newTestPublicKey(t), "hash1"), shim.OK)
+	expectStatus(t, stub.Invoke("issueIdentity", "bob", newTestPublicKey(t), "hash2"), shim.OK)
+	stub.Advance(identityValidityYears * 366 * 24 * time.Hour)
+	middle := stub.Now().Unix()
+	expectStatus(t, stub.Invoke("issueIdentity", "carol", newTestPublicKey(t), "hash3"), shim.OK)
+	expectStatus(t, stub.Invoke("issueIdentity", "dave", newTestPublicKey(t), "hash4"), shim.OK)
+	expectStatus(t, stub.Invoke("addServiceProvider", "bank", "Bank", newTestPublicKey(t), "finance", `["publicKey"]`, "", "BankMSP"), shim.OK)
+
+	expectIds(t, queryIds(t, stub, `{}`, 1), "alice", "bob", "carol", "dave")
+	expectIds(t, queryIds(t, stub, `{"status":"active"}`, 10), "carol", "dave")
+	expectIds(t, queryIds(t, stub, `{"status":"expired"}`, 1), "alice", "bob")
+	expectIds(t, queryIds(t, stub, `{"issuedFrom":`+strconv.FormatInt(start, 10)+`,"issuedTo":`+strconv.FormatInt(middle, 10)+`}`, 10), "alice", "bob")
+
+	response := stub.Invoke("queryIdentities", `{"status":"expired"}`, "10", "")
+	expectStatus(t, response, shim.OK)
+
+	var page struct {
+		Records []struct {
+			Record User `json:"record"`
+		} `json:"records"`
+	}
+	err := json.Unmarshal(response.Payload, &page)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(page.Records) != 2 || page.Records[0].Record.Status != statusExpired {
+		t.Fatalf("expected expired users, got %s", response.Payload)
+	}
+}
+
+func TestQueryIdentitiesByPermissionAndCategory(t *testing.T) {
+	stub := newTestStub(t)
+	key, err := stub.CreateCompositeKey(userObjectType, []string{"erin"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Erin was stored before issuance and validity were recorded.
+	stub.Seed(key, []byte(`{"docType":"user","version":2,"status":"active","publicKey":"`+newTestPublicKey(t)+`","permissions":["vote","travel"]}`))
+	expectStatus(t, stub.Invoke("issueIdentity", "alice", newTestPublicKey(t), "hash1"), shim.OK)
+	expectStatus(t, stub.Invoke("addServiceProvider", "bank", "Bank", newTestPublicKey(t), "finance", `["publicKey"]`, "", "BankMSP"), shim.OK)
+	expectStatus(t, stub.Invoke("addServiceProvider", "clinic", "Clinic", newTestPublicKey(t), "healthcare", `["publicKey"]`, "", "ClinicMSP"), shim.OK)
+
+	expectIds(t, queryIds(t, stub, `{"permission":"travel"}`, 10), "erin")
+	expectIds(t, queryIds(t, stub, `{"status":"active","permission":"travel"}`, 10))
+
+	// The migration stores a validity end, after which Erin is matched as
+	// active.
+	expectStatus(t, stub.Invoke("migrate", "user", `["erin"]`), shim.OK)
+	expectIds(t, queryIds(t, stub, `{"status":"active","permission":"travel"}`, 10), "erin")
+	expectIds(t, queryIds(t, stub, `{"status":"active"}`, 10), "alice", "erin")
+
+	expectIds(t, queryIds(t, stub, `{"recordType":"sp"}`, 10), "bank", "clinic")
+	expectIds(t, queryIds(t, stub, `{"recordType":"sp","category":"healthcare"}`, 10), "clinic")
+
+	expectError(t, stub.Invoke("queryIdentities", `{"category":"finance"}`, "10", ""), codeInvalidArgument)
+	expectError(t, stub.Invoke("queryIdentities", `{"recordType":"sp","status":"active"}`, "10", ""), codeInvalidArgument)
+	expectError(t, stub.Invoke("queryIdentities", `{"status":"dormant"}`, "10", ""), codeInvalidArgument)
+	expectError(t, stub.Invoke("queryIdentities", `{"recordType":"sp","permission":"travel"}`, "10", ""), codeInvalidArgument)
+	expectError(t, stub.Invoke("queryIdentities", `{"name":"Erin"}`, "10", ""), codeInvalidArgument)
+
+	response := stub.Invoke("queryIdentities", `{"query":{"name":"Erin"},"pageSize":10}`)
+	expectError(t, response, codeInvalidArgument)
+
+	if !strings.Contains(string(response.Payload), `{"field":"query","error":"has an unknown field \"name\""}`) {
+		t.Fatalf("unexpected error %s", response.Payload)
+	}
+
+	expectError(t, stub.Invoke("queryIdentities", `{}`, "0", ""), codeInvalidArgument)
+}
+
+func TestExportRecords(t *testing.T) {
+	stub := newTestStub(t)
+
+	for _, userId := range []string{"alice", "bob", "carol"} {
+		expectStatus(t, stub.Invoke("issueIdentity", userId, newTestPublicKey(t), "hash"), shim.OK)
+	}
+
+	var keys []string
+	bookmark := ""
+
+	for {
+		response := stub.Invoke("exportRecords", "user", "2", bookmark)
+		expectStatus(t, response, shim.OK)
+
+		var page ExportPage
+		err := json.Unmarshal(response.Payload, &page)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, record := range page.Records {
+			keys = append(keys, record.Key)
+		}
+
+		if page.Bookmark == "" {
+			break
+		}
+
+		bookmark = page.Bookmark
+	}
+
+	if len(keys) != 3 {
+		t.Fatalf("expected three exported users, got %d", len(keys))
+	}
+
+	stub.SetCreator(testOtherMspId)
+	expectError(t, stub.Invoke("exportRecords", "user", "2", ""), codeUnauthorized)
+}
+
+func TestQueryIdentitiesReturnsStatusViewToMembers(t *testing.T) {
+	stub := newTestStub(t)
+	expectStatus(t, stub.Invoke("issueIdentity", "alice", newTestPublicKey(t), "hash1"), shim.OK)
+
+	records := func() []map[string]interface{} {
+		response := stub.Invoke("queryIdentities", `{}`, "10", "")
+		expectStatus(t, response, shim.OK)
+
+		var page struct {
+			Records []struct {
+				Record map[string]interface{} `json:"record"`
+			} `json:"records"`
+		}
+		err := json.Unmarshal(response.Payload, &page)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var records []map[string]interface{}
+
+		for _, result := range page.Records {
+			records = append(records, result.Record)
+		}
+
+		return records
+	}
+
+	if records := records(); len(records) != 1 || records[0]["metadataHash"] != "hash1" {
+		t.Fatalf("expected the full record for the authority, got %v", records)
+	}
+
+	stub.SetCreator(testOtherMspId)
+
+	if records := records(); len(records) != 1 || records[0]["metadataHash"] != nil || records[0]["status"] != statusActive {
+		t.Fatalf("expected the status view for a member, got %v", records)
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// recoveryTimeLock is how long, in seconds, a recovery waits before the new
+// key can be installed. The user's current key can cancel it meanwhile.
+const recoveryTimeLock int64 = 72 * 60 * 60
+
+// RecoveryApproval is a recovery contact's signature over the recovery request.
+type RecoveryApproval struct {
+	ContactId string `json:"contactId"`
+	Signature string `json:"signature"`
+}
+
+// PendingRecovery is a key recovery approved by the user's recovery contacts
+// and waiting for its time lock to pass. Nonce is the user nonce the
+// approvals were signed against; any signed action by the user advances it
+// and so supersedes the recovery.
+type PendingRecovery struct {
+	NewPublicKey string   `json:"newPublicKey"`
+	Approvers    []string `json:"approvers"`
+	Nonce        int      `json:"nonce"`
+	InitiatedAt  int64    `json:"initiatedAt"`
+	ExecutableAt int64    `json:"executableAt"`
+	Version      int      `json:"version"`
+}
+
+// setRecoveryContacts registers the users who can jointly recover a user's
+// key and how many of them must approve. An empty list with a threshold of
+// zero removes them.
+func (t *IdentityChaincode) setRecoveryContacts(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 5 {
+		return incorrectArgumentCount()
+	}
+
+	user, err := loadUser(stub, args[0])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if user == nil {
+		return notFound("User not found")
+	}
+
+	contacts, err := parseStringList(args[1])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	threshold, err := strconv.Atoi(args[2])
+
+	if err != nil || threshold < 0 || threshold > len(contacts) || (threshold == 0 && len(contacts) > 0) {
+		return invalidArgument("Invalid threshold")
+	}
+
+	for i, contactId := range contacts {
+		if contactId == args[0] || containsString(contacts[:i], contactId) {
+			return invalidArgument("Invalid recovery contact: " + contactId)
+		}
+
+		contact, err := loadUser(stub, contactId)
+
+		if err != nil {
+			return errorResponse(err)
+		}
+
+		if contact == nil {
+			return notFound("Recovery contact not found: " + contactId)
+		}
+	}
+
+	err = authorizeUserAction(stub, args[0], user, "setRecoveryContacts", args[:3], args[3], args[4])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	user.RecoveryContacts = contacts
+	user.RecoveryThreshold = threshold
+	err = storeUser(stub, args[0], user)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(nil)
+}
+
+// initiateRecovery starts replacing a user's key with newPublicKey. Each
+// approval is a recovery contact's signature over
+// ["approveRecovery", userId, newPublicKey, nonce], where nonce is the user's
+// current nonce, and at least the user's threshold of contacts must approve.
+// Like cancelRecovery and completeRecovery, it needs the user to be active.
+func (t *IdentityChaincode) initiateRecovery(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return incorrectArgumentCount()
+	}
+
+	user, err := loadUser(stub, args[0])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if user == nil {
+		return notFound("User not found")
+	}
+
+	err = checkIdentityActive(stub, user)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if user.RecoveryThreshold == 0 {
+		return failedPrecondition("User has no recovery contacts")
+	}
+
+	existing, err := loadPendingRecovery(stub, args[0])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if existing != nil && existing.Nonce == user.Nonce {
+		return alreadyExists("Recovery already pending")
+	}
+
+	_, err = parsePublicKey(args[1])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	var approvals []RecoveryApproval
+	err = json.Unmarshal([]byte(args[2]), &approvals)
+
+	if err != nil {
+		return invalidArgument("Expected a JSON array of approvals")
+	}
+
+	message := signedMessage("approveRecovery", args[0], args[1], strconv.Itoa(user.Nonce))
+	approvers := []string{}
+
+	for _, approval := range approvals {
+		if !containsString(user.RecoveryContacts, approval.ContactId) || containsString(approvers, approval.ContactId) {
+			return invalidArgument("Invalid recovery contact: " + approval.ContactId)
+		}
+
+		contact, err := loadUser(stub, approval.ContactId)
+
+		if err != nil {
+			return errorResponse(err)
+		}
+
+		if contact == nil {
+			return notFound("Recovery contact not found: " + approval.ContactId)
+		}
+
+		err = checkIdentityActive(stub, contact)
+
+		if err != nil {
+			return errorResponse(withContext("Recovery contact "+approval.ContactId+": ", err))
+		}
+
+		err = verifySignature(contact.PublicKey, message, approval.Signature)
+
+		if err != nil {
+			return errorResponse(withContext("Approval of "+approval.ContactId+": ", err))
+		}
+
+		approvers = append(approvers, approval.ContactId)
+	}
+
+	if len(approvers) < user.RecoveryThreshold {
+		return errorResponse(newError(codeUnauthorized, "Not enough recovery approvals"))
+	}
+
+	now, err := txTime(stub)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	var recovery PendingRecovery
+	recovery.NewPublicKey = args[1]
+	recovery.Approvers = approvers
+	recovery.Nonce = user.Nonce
+	recovery.InitiatedAt = now
+	recovery.ExecutableAt = now + recoveryTimeLock
+
+	err = storePendingRecovery(stub, args[0], &recovery)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(nil)
+}
+
+// cancelRecovery discards a pending recovery. It is signed with the user's
+// current key, or by a guardian for a dependent.
+func (t *IdentityChaincode) cancelRecovery(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return incorrectArgumentCount()
+	}
+
+	user, err := loadUser(stub, args[0])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if user == nil {
+		return notFound("User not found")
+	}
+
+	recovery, err := loadPendingRecovery(stub, args[0])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if recovery == nil {
+		return notFound("No pending recovery")
+	}
+
+	err = authorizeUserAction(stub, args[0], user, "cancelRecovery", args[:1], args[1], args[2])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	err = storeUser(stub, args[0], user)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	err = deleteRecord(stub, recoveryObjectType, args[0])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(nil)
+}
+
+// completeRecovery installs the recovered key once the time lock has passed.
+// Anyone may submit it, but not while the user is expired, since the user
+// could not cancel it then.
+func (t *IdentityChaincode) completeRecovery(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return incorrectArgumentCount()
+	}
+
+	user, err := loadUser(stub, args[0])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if user == nil {
+		return notFound("User not found")
+	}
+
+	err = checkIdentityActive(stub, user)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	recovery, err := loadPendingRecovery(stub, args[0])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if recovery == nil {
+		return notFound("No pending recovery")
+	}
+
+	if recovery.Nonce != user.Nonce {
+		return failedPrecondition("Recovery was superseded by a signed action of the user")
+	}
+
+	now, err := txTime(stub)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if now < recovery.ExecutableAt {
+		return failedPrecondition("Recovery time lock has not passed")
+	}
+
+	user.PublicKey = recovery.NewPublicKey
+	user.Nonce++
+	err = storeUser(stub, args[0], user)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	err = deleteRecord(stub, recoveryObjectType, args[0])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(nil)
+}
+
+func (t *IdentityChaincode) getRecovery(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return incorrectArgumentCount()
+	}
+
+	recovery, err := loadPendingRecovery(stub, args[0])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if recovery == nil {
+		return notFound("No pending recovery")
+	}
+
+	recoveryJson, err := json.Marshal(recovery)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(recoveryJson)
+}
+
+func loadPendingRecovery(stub shim.ChaincodeStubInterface, userId string) (*PendingRecovery, error) {
+	recoveryJson, err := getRecord(stub, recoveryObjectType, userId)
+
+	if err != nil || recoveryJson == nil {
+		return nil, err
+	}
+
+	var recovery PendingRecovery
+	err = json.Unmarshal(recoveryJson, &recovery)
+
+	if err != nil {
+		return nil, errors.New("Corrupt recovery record: " + err.Error())
+	}
+
+	upgradePendingRecovery(&recovery)
+
+	return &recovery, nil
+}
+
+func storePendingRecovery(stub shim.ChaincodeStubInterface, userId string, recovery *PendingRecovery) error {
+	recovery.Version = recoverySchemaVersion
+	recoveryJson, err := json.Marshal(recovery)
+
+	if err != nil {
+		return err
+	}
+
+	return putRecord(stub, recoveryObjectType, userId, recoveryJson)
+}
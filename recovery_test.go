@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+
+	"github.com/mars-identity-chaincode/teststub"
+)
+
+// recoveryFixture is Alice with recovery contacts Bob, Carol and Dave, two of
+// whom must approve, and Eve, who is not a contact.
+type recoveryFixture struct {
+	stub *teststub.Stub
+	keys map[string]*secp256k1.PrivateKey
+}
+
+func newRecoveryFixture(t *testing.T) *recoveryFixture {
+	fixture := &recoveryFixture{stub: newTestStub(t), keys: map[string]*secp256k1.PrivateKey{}}
+
+	for _, userId := range []string{"alice", "bob", "carol", "dave", "eve"} {
+		fixture.keys[userId] = newTestKey(t)
+		expectStatus(t, fixture.stub.Invoke("issueIdentity", userId, testPublicKey(fixture.keys[userId]), "hash-"+userId), shim.OK)
+	}
+
+	contacts := []string{"alice", `["bob","carol","dave"]`, "2", "alice"}
+	signature := signTestMessage(t, fixture.keys["alice"], "setRecoveryContacts", append(contacts, "0")...)
+	expectStatus(t, fixture.stub.Invoke(append(append([]string{"setRecoveryContacts"}, contacts...), signature)...), shim.OK)
+
+	return fixture
+}
+
+// approvals returns the approvals of contactIds for replacing Alice's key
+// with newPublicKey at her current nonce.
+func (fixture *recoveryFixture) approvals(t *testing.T, newPublicKey string, contactIds ...string) string {
+	nonce := strconv.Itoa(fixture.user(t).Nonce)
+	approvals := []RecoveryApproval{}
+
+	for _, contactId := range contactIds {
+		signature := signTestMessage(t, fixture.keys[contactId], "approveRecovery", "alice", newPublicKey, nonce)
+		approvals = append(approvals, RecoveryApproval{contactId, signature})
+	}
+
+	approvalsJson, err := json.Marshal(approvals)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(approvalsJson)
+}
+
+func (fixture *recoveryFixture) user(t *testing.T) *User {
+	response := fixture.stub.Invoke("getIdentity", "alice")
+	expectStatus(t, response, shim.OK)
+
+	var user User
+	err := json.Unmarshal(response.Payload, &user)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &user
+}
+
+func (fixture *recoveryFixture) recovery(t *testing.T) *PendingRecovery {
+	response := fixture.stub.Invoke("getRecovery", "alice")
+
+	if response.Status == codeStatus[codeNotFound] {
+		return nil
+	}
+
+	expectStatus(t, response, shim.OK)
+
+	var recovery PendingRecovery
+	err := json.Unmarshal(response.Payload, &recovery)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &recovery
+}
+
+func TestCompleteRecoveryAfterTimeLock(t *testing.T) {
+	fixture := newRecoveryFixture(t)
+	stub := fixture.stub
+	newPublicKey := newTestPublicKey(t)
+
+	expectError(t, stub.Invoke("completeRecovery", "alice"), codeNotFound)
+
+	// Any member may submit the approvals and complete the recovery.
+	stub.SetCreator(testOtherMspId)
+	expectStatus(t, stub.Invoke("initiateRecovery", "alice", newPublicKey, fixture.approvals(t, newPublicKey, "bob", "dave")), shim.OK)
+
+	recovery := fixture.recovery(t)
+
+	if recovery == nil || recovery.NewPublicKey != newPublicKey || recovery.ExecutableAt != recovery.InitiatedAt+recoveryTimeLock {
+		t.Fatalf("unexpected pending recovery %+v", recovery)
+	}
+
+	stub.Advance(time.Duration(recoveryTimeLock-60) * time.Second)
+	expectError(t, stub.Invoke("completeRecovery", "alice"), codeFailedPrecondition)
+
+	if user := fixture.user(t); user.PublicKey != testPublicKey(fixture.keys["alice"]) || user.Nonce != 1 {
+		t.Fatalf("recovery completed before its time lock: %+v", user)
+	}
+
+	stub.Advance(time.Minute)
+	expectStatus(t, stub.Invoke("completeRecovery", "alice"), shim.OK)
+
+	if user := fixture.user(t); user.PublicKey != newPublicKey || user.Nonce != 2 {
+		t.Fatalf("unexpected user after recovery %+v", user)
+	}
+
+	if fixture.recovery(t) != nil {
+		t.Fatal("completed recovery is still pending")
+	}
+
+	expectError(t, stub.Invoke("completeRecovery", "alice"), codeNotFound)
+}
+
+func TestInitiateRecoveryRequiresThresholdOfContacts(t *testing.T) {
+	fixture := newRecoveryFixture(t)
+	stub := fixture.stub
+	newPublicKey := newTestPublicKey(t)
+	otherPublicKey := newTestPublicKey(t)
+
+	// Bob approved the new key, Carol a different one.
+	bobApproval := fixture.approvals(t, newPublicKey, "bob")
+	carolApproval := fixture.approvals(t, otherPublicKey, "carol")
+	mixedApprovals := bobApproval[:len(bobApproval)-1] + "," + carolApproval[1:]
+
+	tests := []struct {
+		approvals string
+		code      string
+	}{
+		{bobApproval, codeUnauthorized},
+		{fixture.approvals(t, newPublicKey), codeUnauthorized},
+		{fixture.approvals(t, newPublicKey, "bob", "bob"), codeInvalidArgument},
+		{fixture.approvals(t, newPublicKey, "bob", "eve"), codeInvalidArgument},
+		{fixture.approvals(t, newPublicKey, "bob", "alice"), codeInvalidArgument},
+		{mixedApprovals, codeUnauthorized},
+		{"not json", codeInvalidArgument},
+	}
+
+	for _, test := range tests {
+		expectError(t, stub.Invoke("initiateRecovery", "alice", newPublicKey, test.approvals), test.code)
+	}
+
+	if fixture.recovery(t) != nil {
+		t.Fatal("a rejected recovery is pending")
+	}
+
+	// An approval signed at an earlier nonce no longer counts.
+	staleApprovals := fixture.approvals(t, newPublicKey, "bob", "carol")
+	update := []string{"alice", "hash2", "alice"}
+	expectStatus(t, stub.Invoke(append(append([]string{"setUserMetadataHash"}, update...), signTestMessage(t, fixture.keys["alice"], "setUserMetadataHash", append(update, "1")...))...), shim.OK)
+	expectError(t, stub.Invoke("initiateRecovery", "alice", newPublicKey, staleApprovals), codeUnauthorized)
+}
+
+func TestCancelRecoveryByOwner(t *testing.T) {
+	fixture := newRecoveryFixture(t)
+	stub := fixture.stub
+	newPublicKey := newTestPublicKey(t)
+	expectStatus(t, stub.Invoke("initiateRecovery", "alice", newPublicKey, fixture.approvals(t, newPublicKey, "bob", "carol")), shim.OK)
+
+	// Only Alice's current key can cancel.
+	expectError(t, stub.Invoke("cancelRecovery", "alice", "bob", signTestMessage(t, fixture.keys["bob"], "cancelRecovery", "alice", "bob", "1")), codeUnauthorized)
+	expectError(t, stub.Invoke("cancelRecovery", "alice", "alice", signTestMessage(t, fixture.keys["bob"], "cancelRecovery", "alice", "alice", "1")), codeUnauthorized)
+	expectStatus(t, stub.Invoke("cancelRecovery", "alice", "alice", signTestMessage(t, fixture.keys["alice"], "cancelRecovery", "alice", "alice", "1")), shim.OK)
+
+	if fixture.recovery(t) != nil {
+		t.Fatal("cancelled recovery is still pending")
+	}
+
+	stub.Advance(time.Duration(recoveryTimeLock) * time.Second)
+	expectError(t, stub.Invoke("completeRecovery", "alice"), codeNotFound)
+
+	if user := fixture.user(t); user.PublicKey != testPublicKey(fixture.keys["alice"]) || user.Nonce != 2 {
+		t.Fatalf("unexpected user after cancellation %+v", user)
+	}
+
+	expectError(t, stub.Invoke("cancelRecovery", "alice", "alice", signTestMessage(t, fixture.keys["alice"], "cancelRecovery", "alice", "alice", "2")), codeNotFound)
+}
+
+func TestNewRecoveryReplacesSupersededOne(t *testing.T) {
+	fixture := newRecoveryFixture(t)
+	stub := fixture.stub
+	firstKey, secondKey := newTestPublicKey(t), newTestPublicKey(t)
+	expectStatus(t, stub.Invoke("initiateRecovery", "alice", firstKey, fixture.approvals(t, firstKey, "bob", "carol")), shim.OK)
+
+	// While the first recovery stands, a second one is refused.
+	expectError(t, stub.Invoke("initiateRecovery", "alice", secondKey, fixture.approvals(t, secondKey, "carol", "dave")), codeAlreadyExists)
+
+	// A signed action by Alice supersedes it, and a new recovery replaces it.
+	update := []string{"alice", "hash2", "alice"}
+	expectStatus(t, stub.Invoke(append(append([]string{"setUserMetadataHash"}, update...), signTestMessage(t, fixture.keys["alice"], "setUserMetadataHash", append(update, "1")...))...), shim.OK)
+
+	stub.Advance(time.Duration(recoveryTimeLock) * time.Second)
+	expectError(t, stub.Invoke("completeRecovery", "alice"), codeFailedPrecondition)
+
+	expectStatus(t, stub.Invoke("initiateRecovery", "alice", secondKey, fixture.approvals(t, secondKey, "carol", "dave")), shim.OK)
+
+	if recovery := fixture.recovery(t); recovery == nil || recovery.NewPublicKey != secondKey || recovery.Nonce != 2 {
+		t.Fatalf("expected the second recovery to replace the first, got %+v", recovery)
+	}
+
+	stub.Advance(time.Duration(recoveryTimeLock) * time.Second)
+	expectStatus(t, stub.Invoke("completeRecovery", "alice"), shim.OK)
+
+	if user := fixture.user(t); user.PublicKey != secondKey {
+		t.Fatalf("expected the second key to be installed, got %s", user.PublicKey)
+	}
+}
+
+func TestRecoveryRequiresActiveIdentity(t *testing.T) {
+	fixture := newRecoveryFixture(t)
+	stub := fixture.stub
+	newPublicKey := newTestPublicKey(t)
+	expectStatus(t, stub.Invoke("initiateRecovery", "alice", newPublicKey, fixture.approvals(t, newPublicKey, "bob", "carol")), shim.OK)
+
+	// Alice expires during the time lock. The recovery can no longer be
+	// cancelled, so it cannot complete either.
+	validUntil := stub.Now().Add(time.Hour).Unix()
+	expectStatus(t, stub.Invoke("renewIdentity", "alice", strconv.FormatInt(validUntil, 10)), shim.OK)
+	stub.Advance(time.Duration(recoveryTimeLock) * time.Second)
+
+	expectError(t, stub.Invoke("cancelRecovery", "alice", "alice", signTestMessage(t, fixture.keys["alice"], "cancelRecovery", "alice", "alice", "1")), codeFailedPrecondition)
+	expectError(t, stub.Invoke("completeRecovery", "alice"), codeFailedPrecondition)
+
+	otherPublicKey := newTestPublicKey(t)
+	expectError(t, stub.Invoke("initiateRecovery", "alice", otherPublicKey, fixture.approvals(t, otherPublicKey, "bob", "carol")), codeFailedPrecondition)
+
+	if user := fixture.user(t); user.PublicKey != testPublicKey(fixture.keys["alice"]) {
+		t.Fatalf("recovery completed while the user was expired: %+v", user)
+	}
+
+	// Once renewed, the recovery completes.
+	expectStatus(t, stub.Invoke("renewIdentity", "alice"), shim.OK)
+	expectStatus(t, stub.Invoke("completeRecovery", "alice"), shim.OK)
+
+	if user := fixture.user(t); user.PublicKey != newPublicKey {
+		t.Fatalf("expected the recovered key, got %s", user.PublicKey)
+	}
+}
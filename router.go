@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// accessPolicy says who may call a function. The router enforces policies
+// that have a check before dispatching. The others depend on the records a
+// call names, such as the user whose signature authorizes it, so the
+// handlers enforce them.
+type accessPolicy struct {
+	name        string
+	description string
+	check       func(stub shim.ChaincodeStubInterface) error
+}
+
+var (
+	policyMember            = accessPolicy{"member", "Any member of the channel.", nil}
+	policyAuthority         = accessPolicy{"authority", "The identity authority, the MSP that instantiated the chaincode.", requireIdentityAuthority}
+	policyProviderMsp       = accessPolicy{"providerMsp", "The MSP of the named service provider.", nil}
+	policyProviderSignature = accessPolicy{"providerSignature", "Anyone relaying a request signed with a signing key of the named service provider.", nil}
+	policyUserSignature     = accessPolicy{"userSignature", "Anyone relaying an action signed by the named user, or by a guardian of a dependent.", nil}
+	policyRecoveryContacts  = accessPolicy{"recoveryContacts", "Anyone relaying the approvals of enough of the user's recovery contacts.", nil}
+)
+
+var accessPolicies = []accessPolicy{
+	policyMember,
+	policyAuthority,
+	policyProviderMsp,
+	policyProviderSignature,
+	policyUserSignature,
+	policyRecoveryContacts,
+}
+
+func requireIdentityAuthority(stub shim.ChaincodeStubInterface) error {
+	authorized, err := isIdentityAuthority(stub)
+
+	if err != nil {
+		return err
+	}
+
+	if !authorized {
+		return newError(codeUnauthorized, "You are not authorized")
+	}
+
+	return nil
+}
+
+// contractFunction is a function callable through Invoke. args is its
+// argument schema, described in args.go. A read-only function never writes,
+// so clients may evaluate it on one peer instead of submitting it.
+type contractFunction struct {
+	handler     func(t *IdentityChaincode, stub shim.ChaincodeStubInterface, args []string) pb.Response
+	args        interface{}
+	policy      accessPolicy
+	readOnly    bool
+	description string
+}
+
+// contractFunctions is the registry Invoke dispatches from. It is filled in
+// init, since getMetadata reads it.
+var contractFunctions = map[string]*contractFunction{}
+
+func init() {
+	register := func(name string, function contractFunction) {
+		contractFunctions[name] = &function
+	}
+
+	register("getCreatorIdentity", contractFunction{(*IdentityChaincode).getCreatorIdentity, noArgs{}, policyMember, true,
+		"Returns the MSP ID of the identity authority."})
+	register("getMetadata", contractFunction{(*IdentityChaincode).getMetadata, noArgs{}, policyMember, true,
+		"Describes every function, its arguments and who may call it."})
+	register("issueIdentity", contractFunction{(*IdentityChaincode).issueIdentity, issueIdentityArgs{}, policyAuthority, false,
+		"Issues an identity, or a dependent's identity held by guardians until majorityAt."})
+	register("getIdentity", contractFunction{(*IdentityChaincode).getIdentity, getIdentityArgs{}, policyMember, true,
+		"Returns a user, in the full view to the identity authority or the status view to any member."})
+	register("identityExists", contractFunction{(*IdentityChaincode).identityExists, userIdArgs{}, policyMember, true,
+		"Returns true or false depending on whether a user was issued."})
+	register("addServiceProvider", contractFunction{(*IdentityChaincode).addServiceProvider, addServiceProviderArgs{}, policyAuthority, false,
+		"Registers a service provider directly."})
+	register("getServiceProvider", contractFunction{(*IdentityChaincode).getServiceProvider, spIdArgs{}, policyMember, true,
+		"Returns a service provider."})
+	register("requestServiceProviderRegistration", contractFunction{(*IdentityChaincode).requestServiceProviderRegistration, requestServiceProviderRegistrationArgs{}, policyMember, false,
+		"Asks the identity authority to register a service provider hosted by the caller's MSP."})
+	register("approveServiceProvider", contractFunction{(*IdentityChaincode).approveServiceProvider, spIdArgs{}, policyAuthority, false,
+		"Approves a pending registration request and registers the service provider."})
+	register("rejectServiceProvider", contractFunction{(*IdentityChaincode).rejectServiceProvider, rejectServiceProviderArgs{}, policyAuthority, false,
+		"Rejects a pending registration request."})
+	register("getServiceProviderRegistration", contractFunction{(*IdentityChaincode).getServiceProviderRegistration, spIdArgs{}, policyMember, true,
+		"Returns a registration request."})
+	register("listServiceProviderRequests", contractFunction{(*IdentityChaincode).listServiceProviderRequests, listServiceProviderRequestsArgs{}, policyMember, true,
+		"Lists the registration requests, optionally with a given status."})
+	register("lookupIdentity", contractFunction{(*IdentityChaincode).lookupIdentity, lookupIdentityArgs{}, policyProviderMsp, true,
+		"Returns the status of a user and the attributes a service provider's scopes allow."})
+	register("addProviderKey", contractFunction{(*IdentityChaincode).addProviderKey, addProviderKeyArgs{}, policyProviderSignature, false,
+		"Adds a key to a service provider."})
+	register("retireProviderKey", contractFunction{(*IdentityChaincode).retireProviderKey, retireProviderKeyArgs{}, policyProviderSignature, false,
+		"Retires a key of a service provider."})
+	register("verifyProviderMessage", contractFunction{(*IdentityChaincode).verifyProviderMessage, verifyProviderMessageArgs{}, policyMember, true,
+		"Verifies a message signed with a service provider's key."})
+	register("rotateUserKey", contractFunction{(*IdentityChaincode).rotateUserKey, rotateUserKeyArgs{}, policyUserSignature, false,
+		"Replaces a user's public key."})
+	register("setUserMetadataHash", contractFunction{(*IdentityChaincode).setUserMetadataHash, setUserMetadataHashArgs{}, policyUserSignature, false,
+		"Replaces the hash of a user's off-chain metadata."})
+	register("updateUserMetadataHash", contractFunction{(*IdentityChaincode).updateUserMetadataHash, updateUserMetadataHashArgs{}, policyAuthority, false,
+		"Replaces the hash of a user's off-chain metadata without the user's signature."})
+	register("promoteDependent", contractFunction{(*IdentityChaincode).promoteDependent, promoteDependentArgs{}, policyAuthority, false,
+		"Hands a dependent who has come of age control of their own key."})
+	register("setRecoveryContacts", contractFunction{(*IdentityChaincode).setRecoveryContacts, setRecoveryContactsArgs{}, policyUserSignature, false,
+		"Sets the users who can jointly recover a user's key, and how many must approve."})
+	register("initiateRecovery", contractFunction{(*IdentityChaincode).initiateRecovery, initiateRecoveryArgs{}, policyRecoveryContacts, false,
+		"Starts replacing a user's key, subject to a time lock."})
+	register("cancelRecovery", contractFunction{(*IdentityChaincode).cancelRecovery, cancelRecoveryArgs{}, policyUserSignature, false,
+		"Discards a pending recovery."})
+	register("completeRecovery", contractFunction{(*IdentityChaincode).completeRecovery, userIdArgs{}, policyMember, false,
+		"Installs the recovered key once the time lock has passed."})
+	register("getRecovery", contractFunction{(*IdentityChaincode).getRecovery, userIdArgs{}, policyMember, true,
+		"Returns a user's pending recovery."})
+	register("renewIdentity", contractFunction{(*IdentityChaincode).renewIdentity, renewIdentityArgs{}, policyAuthority, false,
+		"Sets the end of a user's validity, by default five years from now."})
+	register("verifyIdentity", contractFunction{(*IdentityChaincode).verifyIdentity, verifyIdentityArgs{}, policyMember, true,
+		"Verifies a message signed by a user and reports the user's status."})
+	register("batchIssueIdentities", contractFunction{(*IdentityChaincode).batchIssueIdentities, batchIssueIdentitiesArgs{}, policyAuthority, false,
+		"Issues every identity of a batch, or none of them."})
+	register("setMaxBatchSize", contractFunction{(*IdentityChaincode).setMaxBatchSize, setMaxBatchSizeArgs{}, policyAuthority, false,
+		"Changes how many identities a batch may hold."})
+	register("exportRecords", contractFunction{(*IdentityChaincode).exportRecords, recordPageArgs{}, policyAuthority, true,
+		"Returns a page of the raw user or service provider records."})
+	register("listPendingMigrations", contractFunction{(*IdentityChaincode).listPendingMigrations, recordPageArgs{}, policyAuthority, true,
+		"Returns the IDs of the records below the current schema version among a page of records."})
+	register("migrate", contractFunction{(*IdentityChaincode).migrate, migrateArgs{}, policyAuthority, false,
+		"Rewrites the listed records in the current schema version."})
+	register("migrateKeys", contractFunction{(*IdentityChaincode).migrateKeys, migrateKeysArgs{}, policyAuthority, false,
+		"Moves a page of records from legacy keys to composite keys."})
+	register("queryIdentities", contractFunction{(*IdentityChaincode).queryIdentities, queryIdentitiesArgs{}, policyMember, true,
+		"Returns a page of the users or service providers matching a query, with users in the status view unless the caller is the identity authority."})
+	register("getRegistryStats", contractFunction{(*IdentityChaincode).getRegistryStats, noArgs{}, policyMember, true,
+		"Returns the number of identities by status, issuances per day and providers by category."})
+	register("compactStats", contractFunction{(*IdentityChaincode).compactStats, compactStatsArgs{}, policyAuthority, false,
+		"Merges registry counter deltas to keep getRegistryStats cheap."})
+}
+
+// ContractMetadata is the result of getMetadata.
+type ContractMetadata struct {
+	Functions  []FunctionMetadata `json:"functions"`
+	Policies   []PolicyMetadata   `json:"policies"`
+	ErrorCodes map[string]int32   `json:"errorCodes"`
+}
+
+// FunctionMetadata describes a function. Access names one of the policies.
+type FunctionMetadata struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Access      string        `json:"access"`
+	ReadOnly    bool          `json:"readOnly"`
+	Args        []ArgMetadata `json:"args"`
+}
+
+// ArgMetadata describes an argument, or a field or element of one. Type is
+// string, integer, boolean, array or object. Arrays describe their elements
+// in Items and objects their fields in Fields. Optional arguments may be left
+// off the end of the positional form.
+type ArgMetadata struct {
+	Name     string        `json:"name,omitempty"`
+	Type     string        `json:"type"`
+	Required bool          `json:"required,omitempty"`
+	Optional bool          `json:"optional,omitempty"`
+	Items    *ArgMetadata  `json:"items,omitempty"`
+	Fields   []ArgMetadata `json:"fields,omitempty"`
+}
+
+// PolicyMetadata describes an access policy.
+type PolicyMetadata struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// getMetadata describes every function, so that clients and documentation
+// can be generated from the registry.
+func (t *IdentityChaincode) getMetadata(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 0 {
+		return incorrectArgumentCount()
+	}
+
+	metadataJson, err := json.Marshal(contractMetadata())
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(metadataJson)
+}
+
+func contractMetadata() ContractMetadata {
+	metadata := ContractMetadata{Functions: []FunctionMetadata{}, ErrorCodes: codeStatus}
+
+	for name, function := range contractFunctions {
+		metadata.Functions = append(metadata.Functions, FunctionMetadata{
+			Name:        name,
+			Description: function.description,
+			Access:      function.policy.name,
+			ReadOnly:    function.readOnly,
+			Args:        describeFields(reflect.TypeOf(function.args)),
+		})
+	}
+
+	// The registry is a map, so sort for identical responses on every
+	// endorsing peer.
+	sort.Slice(metadata.Functions, func(i, j int) bool {
+		return metadata.Functions[i].Name < metadata.Functions[j].Name
+	})
+
+	for _, policy := range accessPolicies {
+		metadata.Policies = append(metadata.Policies, PolicyMetadata{policy.name, policy.description})
+	}
+
+	return metadata
+}
+
+// describeFields describes the fields of a struct by their JSON names, in
+// declaration order, which is the positional order of argument schemas.
+func describeFields(structType reflect.Type) []ArgMetadata {
+	fields := []ArgMetadata{}
+
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		arg := describeArg(field.Type)
+		arg.Name = strings.Split(field.Tag.Get("json"), ",")[0]
+		arg.Required = field.Tag.Get("arg") == "required"
+		arg.Optional = field.Tag.Get("arg") == "optional"
+		fields = append(fields, arg)
+	}
+
+	return fields
+}
+
+func describeArg(argType reflect.Type) ArgMetadata {
+	switch argType.Kind() {
+	case reflect.String:
+		return ArgMetadata{Type: "string"}
+	case reflect.Int, reflect.Int64:
+		return ArgMetadata{Type: "integer"}
+	case reflect.Bool:
+		return ArgMetadata{Type: "boolean"}
+	case reflect.Slice:
+		items := describeArg(argType.Elem())
+
+		return ArgMetadata{Type: "array", Items: &items}
+	case reflect.Struct:
+		return ArgMetadata{Type: "object", Fields: describeFields(argType)}
+	}
+
+	return ArgMetadata{Type: argType.Kind().String()}
+}
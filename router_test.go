@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestGetMetadata(t *testing.T) {
+	stub := newTestStub(t)
+	stub.SetCreator(testOtherMspId)
+	response := stub.Invoke("getMetadata")
+	expectStatus(t, response, shim.OK)
+
+	var metadata ContractMetadata
+	err := json.Unmarshal(response.Payload, &metadata)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(metadata.Functions) != len(contractFunctions) || metadata.ErrorCodes[codeNotFound] != 404 {
+		t.Fatalf("unexpected metadata %+v", metadata)
+	}
+
+	policies := map[string]bool{}
+
+	for _, policy := range metadata.Policies {
+		policies[policy.Name] = true
+	}
+
+	functions := map[string]FunctionMetadata{}
+
+	for i, function := range metadata.Functions {
+		if i > 0 && metadata.Functions[i-1].Name >= function.Name {
+			t.Fatalf("functions are not sorted: %s before %s", metadata.Functions[i-1].Name, function.Name)
+		}
+
+		if !policies[function.Access] || function.Description == "" {
+			t.Fatalf("%s is not fully described: %+v", function.Name, function)
+		}
+
+		functions[function.Name] = function
+	}
+
+	issue := functions["issueIdentity"]
+	expectedArgs := []ArgMetadata{
+		{Name: "userId", Type: "string", Required: true},
+		{Name: "publicKey", Type: "string"},
+		{Name: "metadataHash", Type: "string", Required: true},
+		{Name: "guardians", Type: "array", Optional: true, Items: &ArgMetadata{Type: "string"}},
+		{Name: "majorityAt", Type: "integer", Optional: true},
+	}
+
+	if issue.Access != policyAuthority.name || issue.ReadOnly || !reflect.DeepEqual(issue.Args, expectedArgs) {
+		t.Fatalf("unexpected issueIdentity metadata %+v", issue)
+	}
+
+	batch := functions["batchIssueIdentities"].Args[0]
+
+	if batch.Type != "array" || batch.Items.Type != "object" || len(batch.Items.Fields) != 5 || batch.Items.Fields[4].Name != "majorityAt" {
+		t.Fatalf("unexpected batchIssueIdentities argument %+v", batch)
+	}
+
+	if !functions["getIdentity"].ReadOnly || len(functions["getMetadata"].Args) != 0 {
+		t.Fatal("unexpected metadata for readers")
+	}
+}
+
+func TestAuthorityPolicy(t *testing.T) {
+	stub := newTestStub(t)
+	stub.SetCreator(testOtherMspId)
+	expectStatus(t, stub.Invoke("getCreatorIdentity"), shim.OK)
+
+	for name, function := range contractFunctions {
+		if function.policy.name != policyAuthority.name {
+			continue
+		}
+
+		// The policy is checked before the arguments are validated, in either
+		// form, so other members learn nothing about them.
+		for _, args := range [][]string{{name}, {name, "{}"}, {name, `{"noSuchField":1}`}} {
+			endorsement := stub.Endorse(args...)
+
+			if len(endorsement.Writes) != 0 {
+				t.Fatalf("%s wrote %v for another member", name, endorsement.Writes)
+			}
+
+			expectError(t, endorsement.Response, codeUnauthorized)
+		}
+	}
+
+	// A valid JSON call from another member is refused as well.
+	expectError(t, stub.Invoke("issueIdentity", `{"userId":"mallory","publicKey":"`+newTestPublicKey(t)+`","metadataHash":"h"}`), codeUnauthorized)
+}
+
+func TestReadOnlyFunctionsDoNotWrite(t *testing.T) {
+	keys := determinismKeys{newTestKey(t), newTestKey(t), newTestKey(t), newTestKey(t), newTestKey(t)}
+	stub := newDeterminismFixture(t, keys)()
+	message := signedMessage("checkIn", "bank")
+
+	newPublicKey := testPublicKey(keys.newKey)
+	recoveryMessage := []string{"alice", newPublicKey, "1"}
+	approvals := `[{"contactId":"carol","signature":"` + signTestMessage(t, keys.carol, "approveRecovery", recoveryMessage...) +
+		`"},{"contactId":"dave","signature":"` + signTestMessage(t, keys.dave, "approveRecovery", recoveryMessage...) + `"}]`
+	expectStatus(t, stub.Invoke("initiateRecovery", "alice", newPublicKey, approvals), shim.OK)
+
+	tests := map[string][]string{
+		"getCreatorIdentity":             {},
+		"getMetadata":                    {},
+		"getIdentity":                    {"alice", "status"},
+		"identityExists":                 {"alice"},
+		"getServiceProvider":             {"bank"},
+		"getServiceProviderRegistration": {"clinic"},
+		"listServiceProviderRequests":    {},
+		"lookupIdentity":                 {"bank", "alice", `["publicKey"]`},
+		"verifyProviderMessage":          {"bank", "primary", message, signTestMessage(t, keys.bank, "checkIn", "bank")},
+		"getRecovery":                    {"alice"},
+		"verifyIdentity":                 {"alice", message, signTestMessage(t, keys.alice, "checkIn", "bank")},
+		"exportRecords":                  {"user", "10", ""},
+		"listPendingMigrations":          {"user", "10", ""},
+		"queryIdentities":                {`{"recordType":"user"}`, "10", ""},
+		"getRegistryStats":               {},
+	}
+
+	for name, function := range contractFunctions {
+		args, ok := tests[name]
+
+		if function.readOnly != ok {
+			t.Fatalf("%s: expected readOnly to be %v", name, ok)
+		}
+
+		if !ok {
+			continue
+		}
+
+		stub.SetCreator(testAuthorityMspId)
+
+		if name == "lookupIdentity" {
+			stub.SetCreator("BankMSP")
+		}
+
+		endorsement := stub.Endorse(append([]string{name}, args...)...)
+		expectStatus(t, endorsement.Response, shim.OK)
+
+		if len(endorsement.Writes) != 0 {
+			t.Fatalf("%s wrote %v", name, endorsement.Writes)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+
+	"github.com/mars-identity-chaincode/teststub"
+)
+
+// The other two authorities on the identity channel. The health authority
+// hosts the clinic's peers, and the transport authority relays the signed
+// actions of users.
+const (
+	testHealthMspId    = "HealthAuthorityMSP"
+	testTransportMspId = "TransportAuthorityMSP"
+)
+
+func newTestNetwork(t *testing.T) *teststub.Network {
+	network := teststub.NewNetwork("identity", new(IdentityChaincode), testAuthorityMspId, testHealthMspId, testTransportMspId)
+	network.SetTime(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))
+	expectCommitted(t, network.Instantiate(testAuthorityMspId))
+
+	return network
+}
+
+func expectCommitted(t *testing.T, tx *teststub.Transaction) {
+	t.Helper()
+	expectValidationCode(t, tx, pb.TxValidationCode_VALID)
+}
+
+func expectValidationCode(t *testing.T, tx *teststub.Transaction, code pb.TxValidationCode) {
+	t.Helper()
+
+	if tx.ValidationCode != code {
+		t.Fatalf("expected %s to be %s, got %s: %s", tx.Args[0], code, tx.ValidationCode, tx.Response().Message)
+	}
+}
+
+// verifyAs has mspId verify message, signed by userId, with verifyIdentity.
+func verifyAs(t *testing.T, network *teststub.Network, mspId string, userId string, message string, signature string) IdentityVerification {
+	t.Helper()
+	response := network.Query(mspId, "verifyIdentity", userId, message, signature)
+	expectStatus(t, response, shim.OK)
+
+	var verification IdentityVerification
+	err := json.Unmarshal(response.Payload, &verification)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return verification
+}
+
+func TestScenarioIdentityLifecycle(t *testing.T) {
+	network := newTestNetwork(t)
+	aliceKey, clinicKey, newKey := newTestKey(t), newTestKey(t), newTestKey(t)
+
+	// The identity authority issues Alice's identity.
+	expectCommitted(t, network.Invoke(testAuthorityMspId, "issueIdentity", "alice", testPublicKey(aliceKey), "hash1"))
+
+	// The health authority registers its clinic, and the identity authority
+	// approves it.
+	network.Advance(time.Hour)
+	expectCommitted(t, network.Invoke(testHealthMspId, "requestServiceProviderRegistration", "clinic", "Clinic", testPublicKey(clinicKey), "healthcare", `["publicKey"]`, ""))
+	expectCommitted(t, network.Invoke(testAuthorityMspId, "approveServiceProvider", "clinic"))
+
+	// The clinic looks Alice up and verifies a message she signed.
+	response := network.Query(testHealthMspId, "lookupIdentity", "clinic", "alice", `["publicKey"]`)
+	expectStatus(t, response, shim.OK)
+	expectStatus(t, network.Query(testTransportMspId, "lookupIdentity", "clinic", "alice", `["publicKey"]`), codeStatus[codeUnauthorized])
+
+	message := signedMessage("checkIn", "clinic")
+	oldSignature := signTestMessage(t, aliceKey, "checkIn", "clinic")
+
+	if verification := verifyAs(t, network, testHealthMspId, "alice", message, oldSignature); !verification.Valid {
+		t.Fatalf("expected Alice's signature to verify, got %+v", verification)
+	}
+
+	// Alice rotates her key through the transport authority's peers.
+	network.Advance(24 * time.Hour)
+	rotation := []string{"alice", testPublicKey(newKey), "alice"}
+	expectCommitted(t, network.Invoke(testTransportMspId, append(append([]string{"rotateUserKey"}, rotation...), signTestMessage(t, aliceKey, "rotateUserKey", append(rotation, "0")...))...))
+
+	newSignature := signTestMessage(t, newKey, "checkIn", "clinic")
+
+	if verifyAs(t, network, testHealthMspId, "alice", message, oldSignature).Valid || !verifyAs(t, network, testHealthMspId, "alice", message, newSignature).Valid {
+		t.Fatal("expected only the new key to verify after rotation")
+	}
+
+	// A week later the identity authority withdraws Alice's identity. The
+	// registry has no revocation, so it ends her validity a minute from now.
+	network.Advance(7 * 24 * time.Hour)
+	withdrawnAt := network.Now().Add(time.Minute).Unix()
+	expectCommitted(t, network.Invoke(testAuthorityMspId, "renewIdentity", "alice", strconv.FormatInt(withdrawnAt, 10)))
+	network.Advance(2 * time.Minute)
+
+	if verification := verifyAs(t, network, testHealthMspId, "alice", message, newSignature); verification.Valid || verification.Status != statusExpired {
+		t.Fatalf("expected Alice's identity to be withdrawn, got %+v", verification)
+	}
+
+	// The ledger holds Alice's final record and every change to it.
+	var alice User
+	err := json.Unmarshal(storedRecord(t, network.Stub, userObjectType, "alice"), &alice)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if alice.PublicKey != testPublicKey(newKey) || alice.ValidUntil != withdrawnAt || alice.Nonce != 1 {
+		t.Fatalf("unexpected final record %+v", alice)
+	}
+
+	key, _ := network.Stub.CreateCompositeKey(userObjectType, []string{"alice"})
+	history := network.Stub.History[key]
+
+	if len(history) != 3 || history[0].Timestamp.Seconds >= history[1].Timestamp.Seconds || history[1].Timestamp.Seconds >= history[2].Timestamp.Seconds {
+		t.Fatalf("expected issuance, rotation and withdrawal in order, got %v", history)
+	}
+
+	if len(network.Blocks) != 6 {
+		t.Fatalf("expected 6 blocks, got %d", len(network.Blocks))
+	}
+}
+
+func TestScenarioConflictsWithinABlock(t *testing.T) {
+	network := newTestNetwork(t)
+	aliceKey, newKey := newTestKey(t), newTestKey(t)
+	expectCommitted(t, network.Invoke(testAuthorityMspId, "issueIdentity", "alice", testPublicKey(aliceKey), "hash1"))
+
+	// Two operators issue the same person in the same block. Both endorse
+	// against a ledger without Bob, but only the first is committed.
+	first := network.Submit(testAuthorityMspId, "issueIdentity", "bob", newTestPublicKey(t), "hash2")
+	second := network.Submit(testAuthorityMspId, "issueIdentity", "bob", newTestPublicKey(t), "hash3")
+
+	// Alice rotates her key while the authority renews her identity.
+	rotation := []string{"alice", testPublicKey(newKey), "alice"}
+	rotate := network.Submit(testTransportMspId, append(append([]string{"rotateUserKey"}, rotation...), signTestMessage(t, aliceKey, "rotateUserKey", append(rotation, "0")...))...)
+	renew := network.Submit(testAuthorityMspId, "renewIdentity", "alice")
+	network.CutBlock()
+
+	expectCommitted(t, first)
+	expectValidationCode(t, second, pb.TxValidationCode_MVCC_READ_CONFLICT)
+	expectCommitted(t, rotate)
+	expectValidationCode(t, renew, pb.TxValidationCode_MVCC_READ_CONFLICT)
+
+	var bob User
+	err := json.Unmarshal(storedRecord(t, network.Stub, userObjectType, "bob"), &bob)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bob.MetadataHash != "hash2" {
+		t.Fatalf("expected the first issuance to win, got %+v", bob)
+	}
+
+	// The renewal succeeds once resubmitted against the new ledger.
+	expectCommitted(t, network.Invoke(testAuthorityMspId, "renewIdentity", "alice"))
+	stats := network.Query(testAuthorityMspId, "getRegistryStats")
+	expectStatus(t, stats, shim.OK)
+
+	var registryStats RegistryStats
+	err = json.Unmarshal(stats.Payload, &registryStats)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if registryStats.Identities != 2 {
+		t.Fatalf("expected the conflicting issuance not to be counted, got %+v", registryStats)
+	}
+}
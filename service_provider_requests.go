@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	requestPending  = "pending"
+	requestApproved = "approved"
+	requestRejected = "rejected"
+)
+
+// ServiceProviderRequest is a registration request submitted by a service
+// provider and waiting for the identity authority to approve or reject it.
+type ServiceProviderRequest struct {
+	Id              string   `json:"id"`
+	Name            string   `json:"name"`
+	PublicKey       string   `json:"publicKey"`
+	Category        string   `json:"category"`
+	Scopes          []string `json:"scopes"`
+	ContactEndpoint string   `json:"contactEndpoint"`
+	MspId           string   `json:"mspId"`
+	Status          string   `json:"status"`
+	Reason          string   `json:"reason,omitempty"`
+	Version         int      `json:"version"`
+}
+
+func (t *IdentityChaincode) requestServiceProviderRegistration(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 6 {
+		return incorrectArgumentCount()
+	}
+
+	mspId, err := getCreatorMspId(stub)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if mspId == "" {
+		return unauthorized()
+	}
+
+	scopes, err := parseStringList(args[4])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	err = validateCategoryScopes(args[3], scopes)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	_, err = parsePublicKey(args[2])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	spExists, err := getRecord(stub, spObjectType, args[0])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if spExists != nil {
+		return alreadyExists("Service provider already exists")
+	}
+
+	existing, err := getServiceProviderRequest(stub, args[0])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if existing != nil && existing.Status == requestPending {
+		return alreadyExists("Registration request already pending")
+	}
+
+	var request ServiceProviderRequest
+	request.Id = args[0]
+	request.Name = args[1]
+	request.PublicKey = args[2]
+	request.Category = args[3]
+	request.Scopes = scopes
+	request.ContactEndpoint = args[5]
+	request.MspId = mspId
+	request.Status = requestPending
+
+	err = putServiceProviderRequest(stub, &request)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(nil)
+}
+
+func (t *IdentityChaincode) approveServiceProvider(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return incorrectArgumentCount()
+	}
+
+	request, err := getServiceProviderRequest(stub, args[0])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if request == nil {
+		return notFound("Registration request not found")
+	}
+
+	if request.Status != requestPending {
+		return failedPrecondition("Registration request is already " + request.Status)
+	}
+
+	spExists, err := getRecord(stub, spObjectType, args[0])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if spExists != nil {
+		return alreadyExists("Service provider already exists")
+	}
+
+	primaryKey, err := primaryProviderKey(stub, request.PublicKey)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	var newSP ServiceProvider
+	newSP.Name = request.Name
+	newSP.PublicKey = request.PublicKey
+	newSP.Category = request.Category
+	newSP.AllowedScopes = request.Scopes
+	newSP.ContactEndpoint = request.ContactEndpoint
+	newSP.MspId = request.MspId
+	newSP.Keys = []ProviderKey{primaryKey}
+
+	err = storeServiceProvider(stub, args[0], &newSP)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	deltas := statDeltas{}
+	deltas.add(statCategory, newSP.Category, 1)
+	err = deltas.write(stub)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	request.Status = requestApproved
+	err = putServiceProviderRequest(stub, request)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(nil)
+}
+
+func (t *IdentityChaincode) rejectServiceProvider(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return incorrectArgumentCount()
+	}
+
+	request, err := getServiceProviderRequest(stub, args[0])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if request == nil {
+		return notFound("Registration request not found")
+	}
+
+	if request.Status != requestPending {
+		return failedPrecondition("Registration request is already " + request.Status)
+	}
+
+	request.Status = requestRejected
+	request.Reason = args[1]
+	err = putServiceProviderRequest(stub, request)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(nil)
+}
+
+func (t *IdentityChaincode) getServiceProviderRegistration(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return incorrectArgumentCount()
+	}
+
+	request, err := getServiceProviderRequest(stub, args[0])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if request == nil {
+		return notFound("Registration request not found")
+	}
+
+	requestJson, err := json.Marshal(request)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(requestJson)
+}
+
+// defaultRequestPageSize is the page size of listServiceProviderRequests
+// when none is given.
+const defaultRequestPageSize = 100
+
+// ServiceProviderRequestPage is one page of listServiceProviderRequests.
+// Bookmark is passed to the next call and is empty once every request has
+// been read.
+type ServiceProviderRequestPage struct {
+	Requests []ServiceProviderRequest `json:"requests"`
+	Bookmark string                   `json:"bookmark"`
+}
+
+// listServiceProviderRequests returns a page of registration requests,
+// optionally filtered by status. It takes the status, the page size and the
+// bookmark of the previous page, all of which may be left off. Each page reads
+// up to pageSize stored requests and returns those with the status, so a
+// filtered page may hold fewer. Like exportRecords, it only reads requests
+// under composite keys, so requests still under legacy keys are listed once
+// migrateKeys has moved them.
+func (t *IdentityChaincode) listServiceProviderRequests(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) > 3 {
+		return incorrectArgumentCount()
+	}
+
+	args = append(args, make([]string, 3-len(args))...)
+	status := args[0]
+	pageSize := defaultRequestPageSize
+
+	if args[1] != "" && args[1] != "0" {
+		var err error
+		pageSize, err = strconv.Atoi(args[1])
+
+		if err != nil || pageSize < 1 || pageSize > maxExportPageSize {
+			return invalidArgument("Page size must be between 1 and " + strconv.Itoa(maxExportPageSize))
+		}
+	}
+
+	iterator, metadata, err := stub.GetStateByPartialCompositeKeyWithPagination(requestObjectType, []string{}, int32(pageSize), args[2])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	defer iterator.Close()
+
+	page := ServiceProviderRequestPage{Requests: []ServiceProviderRequest{}}
+	read := 0
+
+	for iterator.HasNext() {
+		kv, err := iterator.Next()
+
+		if err != nil {
+			return errorResponse(err)
+		}
+
+		read++
+
+		var request ServiceProviderRequest
+		err = json.Unmarshal(kv.Value, &request)
+
+		if err != nil {
+			return errorResponse(err)
+		}
+
+		upgradeServiceProviderRequest(&request)
+
+		if status == "" || request.Status == status {
+			page.Requests = append(page.Requests, request)
+		}
+	}
+
+	if read == pageSize {
+		page.Bookmark = metadata.Bookmark
+	}
+
+	pageJson, err := json.Marshal(page)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(pageJson)
+}
+
+func getServiceProviderRequest(stub shim.ChaincodeStubInterface, spId string) (*ServiceProviderRequest, error) {
+	requestJson, err := getRecord(stub, requestObjectType, spId)
+
+	if err != nil || requestJson == nil {
+		return nil, err
+	}
+
+	var request ServiceProviderRequest
+	err = json.Unmarshal(requestJson, &request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	upgradeServiceProviderRequest(&request)
+
+	return &request, nil
+}
+
+func putServiceProviderRequest(stub shim.ChaincodeStubInterface, request *ServiceProviderRequest) error {
+	request.Version = requestSchemaVersion
+	requestJson, err := json.Marshal(request)
+
+	if err != nil {
+		return err
+	}
+
+	return putRecord(stub, requestObjectType, request.Id, requestJson)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+
+	"github.com/mars-identity-chaincode/teststub"
+)
+
+func requestTestRegistration(t *testing.T, stub *teststub.Stub, spId string) {
+	t.Helper()
+	stub.SetCreator(testOtherMspId)
+	expectStatus(t, stub.Invoke("requestServiceProviderRegistration", spId, "Provider "+spId, newTestPublicKey(t), "finance", `["publicKey"]`, ""), shim.OK)
+	stub.SetCreator(testAuthorityMspId)
+}
+
+func TestApproveServiceProviderRegistersProvider(t *testing.T) {
+	stub := newTestStub(t)
+	requestTestRegistration(t, stub, "bank")
+
+	// A pending request is refused again, and only the authority decides it.
+	stub.SetCreator(testOtherMspId)
+	expectError(t, stub.Invoke("requestServiceProviderRegistration", "bank", "Bank", newTestPublicKey(t), "finance", "[]", ""), codeAlreadyExists)
+	expectError(t, stub.Invoke("approveServiceProvider", "bank"), codeUnauthorized)
+	stub.SetCreator(testAuthorityMspId)
+
+	expectStatus(t, stub.Invoke("approveServiceProvider", "bank"), shim.OK)
+
+	response := stub.Invoke("getServiceProvider", "bank")
+	expectStatus(t, response, shim.OK)
+
+	var sp ServiceProvider
+	err := json.Unmarshal(response.Payload, &sp)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sp.Name != "Provider bank" || sp.Category != "finance" || fmt.Sprint(sp.AllowedScopes) != "[publicKey]" || sp.MspId != testOtherMspId {
+		t.Fatalf("unexpected service provider %+v", sp)
+	}
+
+	response = stub.Invoke("getServiceProviderRegistration", "bank")
+	expectStatus(t, response, shim.OK)
+
+	var request ServiceProviderRequest
+	err = json.Unmarshal(response.Payload, &request)
+
+	if err != nil || request.Status != requestApproved || request.MspId != testOtherMspId {
+		t.Fatalf("unexpected request %+v: %v", request, err)
+	}
+}
+
+func TestApproveAndRejectRequireAPendingRequest(t *testing.T) {
+	stub := newTestStub(t)
+	requestTestRegistration(t, stub, "bank")
+	requestTestRegistration(t, stub, "shop")
+
+	expectError(t, stub.Invoke("approveServiceProvider", "mint"), codeNotFound)
+	expectError(t, stub.Invoke("rejectServiceProvider", "mint", "unknown"), codeNotFound)
+
+	expectStatus(t, stub.Invoke("approveServiceProvider", "bank"), shim.OK)
+	expectStatus(t, stub.Invoke("rejectServiceProvider", "shop", "duplicate"), shim.OK)
+
+	expectError(t, stub.Invoke("approveServiceProvider", "shop"), codeFailedPrecondition)
+	expectError(t, stub.Invoke("rejectServiceProvider", "shop", "again"), codeFailedPrecondition)
+	expectError(t, stub.Invoke("rejectServiceProvider", "bank", "too late"), codeFailedPrecondition)
+}
+
+func TestListServiceProviderRequestsPaginates(t *testing.T) {
+	stub := newTestStub(t)
+
+	for i := 0; i < 5; i++ {
+		requestTestRegistration(t, stub, fmt.Sprintf("sp%d", i))
+	}
+
+	expectStatus(t, stub.Invoke("approveServiceProvider", "sp1"), shim.OK)
+	expectStatus(t, stub.Invoke("approveServiceProvider", "sp3"), shim.OK)
+
+	listAll := func(args ...string) (ids []string, pages int) {
+		bookmark := ""
+
+		for {
+			response := stub.Invoke(append(append([]string{"listServiceProviderRequests"}, args...), bookmark)...)
+			expectStatus(t, response, shim.OK)
+
+			var page ServiceProviderRequestPage
+			err := json.Unmarshal(response.Payload, &page)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, request := range page.Requests {
+				ids = append(ids, request.Id)
+			}
+
+			pages++
+			bookmark = page.Bookmark
+
+			if bookmark == "" {
+				return ids, pages
+			}
+		}
+	}
+
+	if ids, pages := listAll("", "2"); fmt.Sprint(ids) != "[sp0 sp1 sp2 sp3 sp4]" || pages != 3 {
+		t.Fatalf("unexpected listing %v in %d pages", ids, pages)
+	}
+
+	if ids, _ := listAll(requestPending, "2"); fmt.Sprint(ids) != "[sp0 sp2 sp4]" {
+		t.Fatalf("unexpected pending requests %v", ids)
+	}
+
+	response := stub.Invoke("listServiceProviderRequests")
+	expectStatus(t, response, shim.OK)
+
+	var page ServiceProviderRequestPage
+	err := json.Unmarshal(response.Payload, &page)
+
+	if err != nil || len(page.Requests) != 5 || page.Bookmark != "" {
+		t.Fatalf("unexpected default page %+v: %v", page, err)
+	}
+
+	expectError(t, stub.Invoke("listServiceProviderRequests", "", "1001"), codeInvalidArgument)
+	expectError(t, stub.Invoke("listServiceProviderRequests", "", "x"), codeInvalidArgument)
+}
+
+func TestListServiceProviderRequestsAfterMigrateKeys(t *testing.T) {
+	stub := newTestStub(t)
+	requestTestRegistration(t, stub, "bank")
+	stub.Seed("sprequest_clinic", []byte(`{"id":"clinic","name":"Clinic","publicKey":"`+newTestPublicKey(t)+`","category":"healthcare","scopes":["publicKey"],"mspId":"`+testOtherMspId+`","status":"pending"}`))
+
+	listIds := func() string {
+		response := stub.Invoke("listServiceProviderRequests", requestPending)
+		expectStatus(t, response, shim.OK)
+
+		var page ServiceProviderRequestPage
+		err := json.Unmarshal(response.Payload, &page)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids := []string{}
+
+		for _, request := range page.Requests {
+			ids = append(ids, request.Id)
+		}
+
+		return fmt.Sprint(ids)
+	}
+
+	// A request under its legacy key is read, but not listed until it moves.
+	expectStatus(t, stub.Invoke("getServiceProviderRegistration", "clinic"), shim.OK)
+
+	if ids := listIds(); ids != "[bank]" {
+		t.Fatalf("expected only the composite key request, got %s", ids)
+	}
+
+	expectStatus(t, stub.Invoke("migrateKeys", "sprequest", "10"), shim.OK)
+
+	if ids := listIds(); ids != "[bank clinic]" {
+		t.Fatalf("expected the moved request to be listed, got %s", ids)
+	}
+
+	if stub.State["sprequest_clinic"] != nil {
+		t.Fatal("request is still under its legacy key")
+	}
+}
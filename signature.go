@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/decred/dcrd/dcrec/secp256k1"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// signedMessage builds the canonical message a key holder signs to authorize
+// function with the given arguments. The parts are JSON encoded so that no
+// two argument lists produce the same message.
+func signedMessage(function string, args ...string) string {
+	message, _ := json.Marshal(append([]string{function}, args...))
+
+	return string(message)
+}
+
+// parsePublicKey decodes a hex encoded secp256k1 public key.
+func parsePublicKey(publicKey string) (*secp256k1.PublicKey, error) {
+	keyBytes, err := hex.DecodeString(publicKey)
+
+	if err != nil {
+		return nil, newError(codeInvalidArgument, "Public key is not hex encoded")
+	}
+
+	key, err := secp256k1.ParsePubKey(keyBytes)
+
+	if err != nil {
+		return nil, newError(codeInvalidArgument, "Invalid public key")
+	}
+
+	return key, nil
+}
+
+// verifySignature checks a hex encoded DER signature over the SHA-256 hash of
+// message against a hex encoded secp256k1 public key.
+func verifySignature(publicKey string, message string, signature string) error {
+	key, err := parsePublicKey(publicKey)
+
+	if err != nil {
+		return err
+	}
+
+	sigBytes, err := hex.DecodeString(signature)
+
+	if err != nil {
+		return newError(codeInvalidArgument, "Signature is not hex encoded")
+	}
+
+	sig, err := secp256k1.ParseDERSignature(sigBytes)
+
+	if err != nil {
+		return newError(codeInvalidArgument, "Invalid signature")
+	}
+
+	hash := sha256.Sum256([]byte(message))
+
+	if !sig.Verify(hash[:], key) {
+		return newError(codeUnauthorized, "Signature verification failed")
+	}
+
+	return nil
+}
+
+// txTime returns the transaction timestamp in seconds since the Unix epoch.
+// It is the same on every endorsing peer, unlike the local clock.
+func txTime(stub shim.ChaincodeStubInterface) (int64, error) {
+	timestamp, err := stub.GetTxTimestamp()
+
+	if err != nil {
+		return 0, err
+	}
+
+	return timestamp.Seconds, nil
+}
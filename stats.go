@@ -0,0 +1,333 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Registry counters are never updated in place. Each transaction writes its
+// changes as delta keys with the attributes kind, name and transaction ID, so
+// concurrent issuances never write the same key. Reads sum the deltas, and
+// compactStats merges them to keep reads cheap.
+const statObjectType = "identity~stat"
+
+// Counter kinds. Issued counts issuances per day and expires counts the
+// identities whose validity ends on a day, from which the number of expired
+// identities is derived at read time.
+const (
+	statIssued   = "issued"
+	statExpires  = "expires"
+	statCategory = "category"
+)
+
+type statCounter struct {
+	kind string
+	name string
+}
+
+// statDeltas collects the counter changes of a transaction. Writing the same
+// delta key twice in a transaction keeps only the last value, so changes are
+// collected and written once with write.
+type statDeltas map[statCounter]int
+
+func statDay(timestamp int64) string {
+	return time.Unix(timestamp, 0).UTC().Format("2006-01-02")
+}
+
+func (deltas statDeltas) add(kind string, name string, delta int) {
+	deltas[statCounter{kind, name}] += delta
+}
+
+// addIdentity counts the issuance of user.
+func (deltas statDeltas) addIdentity(user *User) {
+	deltas.add(statIssued, statDay(user.IssuedAt), 1)
+
+	if user.ValidUntil != 0 {
+		deltas.add(statExpires, statDay(user.ValidUntil), 1)
+	}
+}
+
+// moveExpiry counts a change of validity from oldValidUntil to newValidUntil.
+func (deltas statDeltas) moveExpiry(oldValidUntil int64, newValidUntil int64) {
+	if oldValidUntil != 0 {
+		deltas.add(statExpires, statDay(oldValidUntil), -1)
+	}
+
+	if newValidUntil != 0 {
+		deltas.add(statExpires, statDay(newValidUntil), 1)
+	}
+}
+
+func (deltas statDeltas) write(stub shim.ChaincodeStubInterface) error {
+	for counter, delta := range deltas {
+		if delta == 0 {
+			continue
+		}
+
+		key, err := stub.CreateCompositeKey(statObjectType, []string{counter.kind, counter.name, stub.GetTxID()})
+
+		if err != nil {
+			return err
+		}
+
+		err = stub.PutState(key, []byte(strconv.Itoa(delta)))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RegistryStats is the result of getRegistryStats.
+type RegistryStats struct {
+	Identities          int            `json:"identities"`
+	IdentitiesByStatus  map[string]int `json:"identitiesByStatus"`
+	IssuedPerDay        map[string]int `json:"issuedPerDay"`
+	ProvidersByCategory map[string]int `json:"providersByCategory"`
+}
+
+// getRegistryStats sums the registry counters. An identity counts as expired
+// from the day after its validity ends.
+func (t *IdentityChaincode) getRegistryStats(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 0 {
+		return incorrectArgumentCount()
+	}
+
+	now, err := txTime(stub)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	iterator, err := stub.GetStateByPartialCompositeKey(statObjectType, []string{})
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	defer iterator.Close()
+
+	var stats RegistryStats
+	stats.IdentitiesByStatus = map[string]int{statusActive: 0, statusExpired: 0}
+	stats.IssuedPerDay = map[string]int{}
+	stats.ProvidersByCategory = map[string]int{}
+	today := statDay(now)
+
+	for iterator.HasNext() {
+		kv, err := iterator.Next()
+
+		if err != nil {
+			return errorResponse(err)
+		}
+
+		_, attributes, err := stub.SplitCompositeKey(kv.Key)
+
+		if err != nil {
+			return errorResponse(err)
+		}
+
+		delta, err := strconv.Atoi(string(kv.Value))
+
+		if err != nil {
+			return errorResponse(err)
+		}
+
+		switch attributes[0] {
+		case statIssued:
+			stats.Identities += delta
+			stats.IssuedPerDay[attributes[1]] += delta
+		case statExpires:
+			if attributes[1] < today {
+				stats.IdentitiesByStatus[statusExpired] += delta
+			}
+		case statCategory:
+			stats.ProvidersByCategory[attributes[1]] += delta
+		}
+	}
+
+	for day, count := range stats.IssuedPerDay {
+		if count == 0 {
+			delete(stats.IssuedPerDay, day)
+		}
+	}
+
+	for category, count := range stats.ProvidersByCategory {
+		if count == 0 {
+			delete(stats.ProvidersByCategory, category)
+		}
+	}
+
+	stats.IdentitiesByStatus[statusActive] = stats.Identities - stats.IdentitiesByStatus[statusExpired]
+
+	statsJson, err := json.Marshal(stats)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(statsJson)
+}
+
+// StatsCompaction is the result of compactStats. Bookmark names the counter
+// the next call resumes at, and is empty once every counter has been visited.
+type StatsCompaction struct {
+	Compacted int    `json:"compacted"`
+	Bookmark  string `json:"bookmark"`
+}
+
+// statBookmark renders counter as a compactStats bookmark, kind/name.
+func statBookmark(counter statCounter) string {
+	return counter.kind + "/" + counter.name
+}
+
+func parseStatBookmark(bookmark string) (statCounter, error) {
+	if bookmark == "" {
+		return statCounter{}, nil
+	}
+
+	separator := strings.Index(bookmark, "/")
+
+	if separator < 0 {
+		return statCounter{}, newError(codeInvalidArgument, "Invalid bookmark: "+bookmark)
+	}
+
+	return statCounter{bookmark[:separator], bookmark[separator+1:]}, nil
+}
+
+// before reports whether counter sorts before other in the delta key range.
+func (counter statCounter) before(other statCounter) bool {
+	return counter.kind < other.kind || counter.kind == other.kind && counter.name < other.name
+}
+
+// compactStats merges the delta keys of each counter into one. It takes the
+// maximum number of delta keys to read, at least 2, and the bookmark of the
+// previous call. Counters with a single delta are left as they are. The keys
+// of the counters before the bookmark are skipped without being counted
+// against the limit; once compacted there is one per counter, so resuming
+// costs no more than reading the counters. Deltas written while it runs
+// invalidate only the compaction, which can simply be retried.
+func (t *IdentityChaincode) compactStats(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return incorrectArgumentCount()
+	}
+
+	limit, err := strconv.Atoi(args[0])
+
+	if err != nil || limit < 2 || limit > maxExportPageSize {
+		return invalidArgument("Limit must be between 2 and " + strconv.Itoa(maxExportPageSize))
+	}
+
+	start, err := parseStatBookmark(args[1])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	iterator, err := stub.GetStateByPartialCompositeKey(statObjectType, []string{})
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	defer iterator.Close()
+
+	var compaction StatsCompaction
+	var counter statCounter
+	var keys []string
+	deltas := statDeltas{}
+	read := 0
+
+	// merge replaces the delta keys read for counter with their sum, unless
+	// there is only one.
+	merge := func() error {
+		if len(keys) < 2 {
+			delete(deltas, counter)
+			return nil
+		}
+
+		for _, key := range keys {
+			err := stub.DelState(key)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		compaction.Compacted += len(keys)
+
+		return nil
+	}
+
+	for iterator.HasNext() {
+		kv, err := iterator.Next()
+
+		if err != nil {
+			return errorResponse(err)
+		}
+
+		_, attributes, err := stub.SplitCompositeKey(kv.Key)
+
+		if err != nil {
+			return errorResponse(err)
+		}
+
+		next := statCounter{attributes[0], attributes[1]}
+
+		if next.before(start) {
+			continue
+		}
+
+		if read == limit {
+			compaction.Bookmark = statBookmark(next)
+			break
+		}
+
+		if next != counter {
+			err = merge()
+
+			if err != nil {
+				return errorResponse(err)
+			}
+
+			counter = next
+			keys = nil
+		}
+
+		delta, err := strconv.Atoi(string(kv.Value))
+
+		if err != nil {
+			return errorResponse(err)
+		}
+
+		deltas.add(counter.kind, counter.name, delta)
+		keys = append(keys, kv.Key)
+		read++
+	}
+
+	err = merge()
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	err = deltas.write(stub)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	compactionJson, err := json.Marshal(compaction)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(compactionJson)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+
+	"github.com/mars-identity-chaincode/teststub"
+)
+
+// statKeys counts the delta keys of each counter, by kind/name.
+func statKeys(stub *teststub.Stub) map[string]int {
+	keys := map[string]int{}
+
+	for _, key := range stub.SortedKeys() {
+		if !strings.HasPrefix(key, "\x00"+statObjectType+"\x00") {
+			continue
+		}
+
+		_, attributes, _ := stub.SplitCompositeKey(key)
+		keys[statBookmark(statCounter{attributes[0], attributes[1]})]++
+	}
+
+	return keys
+}
+
+func getTestRegistryStats(t *testing.T, stub *teststub.Stub) RegistryStats {
+	t.Helper()
+	response := stub.Invoke("getRegistryStats")
+	expectStatus(t, response, shim.OK)
+
+	var stats RegistryStats
+	err := json.Unmarshal(response.Payload, &stats)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return stats
+}
+
+func TestRegistryStatsCountsIssuanceExpiryAndProviders(t *testing.T) {
+	stub := newTestStub(t)
+	firstDay := statDay(stub.Now().Unix())
+
+	for _, userId := range []string{"alice", "bob"} {
+		expectStatus(t, stub.Invoke("issueIdentity", userId, newTestPublicKey(t), "hash"), shim.OK)
+	}
+
+	expectStatus(t, stub.Invoke("addServiceProvider", "bank", "Bank", newTestPublicKey(t), "finance", `["publicKey"]`, "", "BankMSP"), shim.OK)
+	stub.Advance(24 * time.Hour)
+	secondDay := statDay(stub.Now().Unix())
+	expectStatus(t, stub.Invoke("issueIdentity", "carol", newTestPublicKey(t), "hash"), shim.OK)
+
+	// Alice's validity is cut short, and she counts as expired from the day after it ends.
+	validUntil := stub.Now().Add(time.Hour).Unix()
+	expectStatus(t, stub.Invoke("renewIdentity", "alice", strconv.FormatInt(validUntil, 10)), shim.OK)
+
+	stats := getTestRegistryStats(t, stub)
+	expected := fmt.Sprintf("{3 map[active:3 expired:0] map[%s:2 %s:1] map[finance:1]}", firstDay, secondDay)
+
+	if fmt.Sprint(stats) != expected {
+		t.Fatalf("expected stats %s, got %v", expected, stats)
+	}
+
+	stub.Advance(48 * time.Hour)
+
+	if stats := getTestRegistryStats(t, stub); stats.IdentitiesByStatus[statusExpired] != 1 || stats.IdentitiesByStatus[statusActive] != 2 {
+		t.Fatalf("expected one expired identity, got %v", stats.IdentitiesByStatus)
+	}
+}
+
+func TestCompactStatsResumesAcrossCounters(t *testing.T) {
+	stub := newTestStub(t)
+
+	// Six users issued on different days give twelve counters of one delta.
+	for i := 0; i < 6; i++ {
+		expectStatus(t, stub.Invoke("issueIdentity", fmt.Sprintf("user%d", i), newTestPublicKey(t), "hash"), shim.OK)
+		stub.Advance(24 * time.Hour)
+	}
+
+	// Four users issued on one day give two counters of four deltas.
+	for i := 6; i < 10; i++ {
+		expectStatus(t, stub.Invoke("issueIdentity", fmt.Sprintf("user%d", i), newTestPublicKey(t), "hash"), shim.OK)
+	}
+
+	stats := stub.Invoke("getRegistryStats")
+	expectStatus(t, stats, shim.OK)
+	before := statKeys(stub)
+
+	if len(before) != 14 {
+		t.Fatalf("expected 14 counters, got %v", before)
+	}
+
+	compact := func() (compacted int, calls int) {
+		bookmark := ""
+
+		for calls = 1; calls <= 20; calls++ {
+			response := stub.Invoke("compactStats", "3", bookmark)
+			expectStatus(t, response, shim.OK)
+
+			var compaction StatsCompaction
+			err := json.Unmarshal(response.Payload, &compaction)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			compacted += compaction.Compacted
+			bookmark = compaction.Bookmark
+
+			if bookmark == "" {
+				return compacted, calls
+			}
+		}
+
+		t.Fatal("compaction did not finish")
+
+		return
+	}
+
+	// There are more counters than the limit, so the compaction takes several
+	// calls, and the four deltas of a counter may be merged across two.
+	if compacted, calls := compact(); compacted < 8 || calls < 7 {
+		t.Fatalf("expected at least 8 keys compacted in at least 7 calls, got %d in %d", compacted, calls)
+	}
+
+	after := statKeys(stub)
+
+	for counter, keys := range after {
+		if keys != 1 {
+			t.Fatalf("counter %s has %d keys after compaction", counter, keys)
+		}
+	}
+
+	if len(after) != len(before) {
+		t.Fatalf("compaction changed the counters from %v to %v", before, after)
+	}
+
+	if response := stub.Invoke("getRegistryStats"); string(response.Payload) != string(stats.Payload) {
+		t.Fatalf("compaction changed the stats from %s to %s", stats.Payload, response.Payload)
+	}
+
+	// Counters of a single key are not rewritten.
+	if compacted, _ := compact(); compacted != 0 {
+		t.Fatalf("expected nothing left to compact, got %d", compacted)
+	}
+
+	expectError(t, stub.Invoke("compactStats", "1", ""), codeInvalidArgument)
+	expectError(t, stub.Invoke("compactStats", "10", "issued"), codeInvalidArgument)
+}
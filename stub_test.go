@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+
+	"github.com/mars-identity-chaincode/teststub"
+)
+
+const (
+	testAuthorityMspId = "AuthorityMSP"
+	testOtherMspId     = "OtherMSP"
+)
+
+// newTestStub returns a stub whose chaincode was instantiated by the identity
+// authority.
+func newTestStub(t *testing.T) *teststub.Stub {
+	stub := teststub.New("identity", new(IdentityChaincode))
+	stub.SetCreator(testAuthorityMspId)
+	expectStatus(t, stub.Init(), shim.OK)
+
+	return stub
+}
+
+// storedRecord returns the stored value of the record id of objectType.
+func storedRecord(t *testing.T, stub *teststub.Stub, objectType string, id string) []byte {
+	key, err := stub.CreateCompositeKey(objectType, []string{id})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return stub.State[key]
+}
+
+func newTestPublicKey(t testing.TB) string {
+	return testPublicKey(newTestKey(t))
+}
+
+func newTestKey(t testing.TB) *secp256k1.PrivateKey {
+	key, err := secp256k1.GeneratePrivateKey()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func testPublicKey(key *secp256k1.PrivateKey) string {
+	return hex.EncodeToString(key.PubKey().SerializeCompressed())
+}
+
+// signTestMessage signs the message of function and args the way clients of
+// signed actions do.
+func signTestMessage(t testing.TB, key *secp256k1.PrivateKey, function string, args ...string) string {
+	hash := sha256.Sum256([]byte(signedMessage(function, args...)))
+	signature, err := key.Sign(hash[:])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return hex.EncodeToString(signature.Serialize())
+}
+
+func expectStatus(t testing.TB, response pb.Response, status int32) {
+	t.Helper()
+
+	if response.Status != status {
+		t.Fatalf("expected status %d, got %d: %s", status, response.Status, response.Message)
+	}
+}
+
+// expectError checks that response failed with the error code.
+func expectError(t *testing.T, response pb.Response, code string) {
+	t.Helper()
+	expectStatus(t, response, codeStatus[code])
+
+	var chaincodeError ChaincodeError
+	err := json.Unmarshal(response.Payload, &chaincodeError)
+
+	if err != nil {
+		t.Fatalf("error payload is not JSON: %s", response.Payload)
+	}
+
+	if chaincodeError.Code != code {
+		t.Fatalf("expected error code %s, got %s", code, chaincodeError.Code)
+	}
+}
@@ -0,0 +1,142 @@
+package teststub
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Endorsement is what a peer signs for a transaction it endorses: the
+// response, the read set, the write set and the event. As in a Fabric
+// read/write set, reads and writes are ordered by key, so the order in which
+// the chaincode touched the keys does not matter. Reads holds every key read,
+// including those returned by range queries, which are also listed in
+// RangeReads.
+type Endorsement struct {
+	TxId       string
+	Response   pb.Response
+	Reads      []string
+	RangeReads []*RangeRead
+	Writes     []Write
+	Event      *pb.ChaincodeEvent
+}
+
+// Write is one entry of a write set.
+type Write struct {
+	Key      string
+	Value    []byte
+	IsDelete bool
+}
+
+// Endorse runs the chaincode's Invoke as a transaction and returns what an
+// endorsing peer would sign for it.
+func (stub *Stub) Endorse(args ...string) Endorsement {
+	return stub.endorse(args, stub.chaincode.Invoke)
+}
+
+func (stub *Stub) endorse(args []string, fn func(shim.ChaincodeStubInterface) pb.Response) Endorsement {
+	var endorsement Endorsement
+
+	endorsement.Response = stub.Run(args, func(txStub shim.ChaincodeStubInterface) pb.Response {
+		response := fn(txStub)
+		endorsement.TxId = stub.TxID
+
+		for key := range stub.txReads {
+			endorsement.Reads = append(endorsement.Reads, key)
+		}
+
+		endorsement.RangeReads = stub.txRangeReads
+
+		for _, key := range stub.txWriteOrder {
+			value, ok := stub.State[key]
+			endorsement.Writes = append(endorsement.Writes, Write{key, value, !ok})
+		}
+
+		endorsement.Event = stub.txEvent
+
+		return response
+	})
+
+	sort.Strings(endorsement.Reads)
+	sort.Slice(endorsement.Writes, func(i, j int) bool {
+		return endorsement.Writes[i].Key < endorsement.Writes[j].Key
+	})
+
+	return endorsement
+}
+
+// CheckDeterminism endorses args on two stubs returned by newStub, as two
+// peers would, and returns an error listing how the endorsements differ.
+// newStub must build a new chaincode and bring it to the same state each
+// time; the second stub's clock is set to the first's before the endorsement.
+// Differences that depend on map iteration order only show on some runs, so
+// checks are worth repeating, and a nil error does not prove determinism.
+func CheckDeterminism(newStub func() *Stub, args ...string) error {
+	first := newStub()
+	second := newStub()
+	second.SetTime(first.Now())
+
+	differences := diffEndorsements(first.Endorse(args...), second.Endorse(args...))
+
+	if len(differences) > 0 {
+		return errors.New("Endorsements of " + strings.Join(args, " ") + " differ:\n" + strings.Join(differences, "\n"))
+	}
+
+	return nil
+}
+
+func diffEndorsements(a Endorsement, b Endorsement) []string {
+	var differences []string
+
+	if a.Response.Status != b.Response.Status {
+		differences = append(differences, fmt.Sprintf("status %d != %d", a.Response.Status, b.Response.Status))
+	}
+
+	if a.Response.Message != b.Response.Message {
+		differences = append(differences, fmt.Sprintf("message %q != %q", a.Response.Message, b.Response.Message))
+	}
+
+	if !bytes.Equal(a.Response.Payload, b.Response.Payload) {
+		differences = append(differences, fmt.Sprintf("payload %q != %q", a.Response.Payload, b.Response.Payload))
+	}
+
+	if strings.Join(a.Reads, "\n") != strings.Join(b.Reads, "\n") {
+		differences = append(differences, fmt.Sprintf("reads %q != %q", a.Reads, b.Reads))
+	}
+
+	writesA := map[string]Write{}
+
+	for _, write := range a.Writes {
+		writesA[write.Key] = write
+	}
+
+	for _, write := range b.Writes {
+		other, ok := writesA[write.Key]
+		delete(writesA, write.Key)
+
+		if !ok {
+			differences = append(differences, fmt.Sprintf("only the second wrote %q", write.Key))
+		} else if other.IsDelete != write.IsDelete || !bytes.Equal(other.Value, write.Value) {
+			differences = append(differences, fmt.Sprintf("write %q: %q != %q", write.Key, other.Value, write.Value))
+		}
+	}
+
+	for _, write := range a.Writes {
+		if _, ok := writesA[write.Key]; ok {
+			differences = append(differences, fmt.Sprintf("only the first wrote %q", write.Key))
+		}
+	}
+
+	if (a.Event == nil) != (b.Event == nil) {
+		differences = append(differences, "only one set an event")
+	} else if a.Event != nil && (a.Event.EventName != b.Event.EventName || !bytes.Equal(a.Event.Payload, b.Event.Payload)) {
+		differences = append(differences, fmt.Sprintf("event %s %q != %s %q", a.Event.EventName, a.Event.Payload, b.Event.EventName, b.Event.Payload))
+	}
+
+	return differences
+}
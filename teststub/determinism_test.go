@@ -0,0 +1,108 @@
+package teststub
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// invocations counts calls across chaincode instances, as a package variable
+// in chaincode would.
+var invocations int
+
+// nondeterministicChaincode writes a value built from map iteration order,
+// or one that depends on earlier invocations in the same process.
+type nondeterministicChaincode struct{}
+
+func (cc *nondeterministicChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (cc *nondeterministicChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	function, _ := stub.GetFunctionAndParameters()
+
+	switch function {
+	case "mapOrder":
+		var names []string
+
+		for name := range map[string]bool{"a": true, "b": true, "c": true, "d": true, "e": true, "f": true, "g": true, "h": true} {
+			names = append(names, name)
+		}
+
+		stub.PutState("names", []byte(strings.Join(names, ",")))
+	case "counter":
+		invocations++
+		stub.SetEvent("counted", []byte(strconv.Itoa(invocations)))
+	}
+
+	return shim.Success(nil)
+}
+
+func newEchoStub() *Stub {
+	stub := New("echo", new(echoChaincode))
+	stub.SetTime(time.Unix(1000, 0))
+	stub.Seed("k", []byte("v1"))
+
+	return stub
+}
+
+func TestEndorse(t *testing.T) {
+	stub := newEchoStub()
+	endorsement := stub.Endorse("put", "k", "v2")
+
+	if endorsement.Response.Status != shim.OK || len(endorsement.Writes) != 1 || string(endorsement.Writes[0].Value) != "v2" {
+		t.Fatalf("unexpected endorsement %+v", endorsement)
+	}
+
+	if endorsement.Event == nil || string(endorsement.Event.Payload) != "k" {
+		t.Fatalf("unexpected event %v", endorsement.Event)
+	}
+
+	endorsement = stub.Endorse("del", "k")
+
+	if len(endorsement.Writes) != 1 || !endorsement.Writes[0].IsDelete {
+		t.Fatalf("expected a delete, got %+v", endorsement.Writes)
+	}
+}
+
+func TestCheckDeterminismPasses(t *testing.T) {
+	for _, args := range [][]string{{"put", "k", "v2"}, {"del", "k"}, {"time"}, {"unknown"}} {
+		err := CheckDeterminism(newEchoStub, args...)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCheckDeterminismFlagsMapOrder(t *testing.T) {
+	newStub := func() *Stub {
+		return New("nondeterministic", new(nondeterministicChaincode))
+	}
+
+	// Eight keys come out in the same order twice in a row with small odds;
+	// retrying keeps the test from being flaky.
+	for i := 0; i < 20; i++ {
+		if CheckDeterminism(newStub, "mapOrder") != nil {
+			return
+		}
+	}
+
+	t.Fatal("map iteration order was not flagged")
+}
+
+func TestCheckDeterminismFlagsProcessState(t *testing.T) {
+	newStub := func() *Stub {
+		return New("nondeterministic", new(nondeterministicChaincode))
+	}
+
+	err := CheckDeterminism(newStub, "counter")
+
+	if err == nil || !strings.Contains(err.Error(), "event") {
+		t.Fatalf("expected differing events, got %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package teststub
+
+import (
+	"sort"
+)
+
+// keyIndex keeps the keys of the state in order for range reads. MockStub
+// keeps them in a linked list that every write walks, which is too slow for a
+// state of a million keys, so keys added or removed since the last range read
+// are set aside and merged in by the next one.
+type keyIndex struct {
+	sorted  []string
+	added   map[string]bool
+	removed map[string]bool
+}
+
+func newKeyIndex() *keyIndex {
+	return &keyIndex{added: map[string]bool{}, removed: map[string]bool{}}
+}
+
+// add records a key that was not in the state.
+func (index *keyIndex) add(key string) {
+	if index.removed[key] {
+		delete(index.removed, key)
+	} else {
+		index.added[key] = true
+	}
+}
+
+// remove records the deletion of a key that was in the state.
+func (index *keyIndex) remove(key string) {
+	if index.added[key] {
+		delete(index.added, key)
+	} else {
+		index.removed[key] = true
+	}
+}
+
+// keys returns every key in order. The slice must not be modified.
+func (index *keyIndex) keys() []string {
+	if len(index.added) == 0 && len(index.removed) == 0 {
+		return index.sorted
+	}
+
+	added := make([]string, 0, len(index.added))
+
+	for key := range index.added {
+		added = append(added, key)
+	}
+
+	sort.Strings(added)
+	merged := make([]string, 0, len(index.sorted)+len(added)-len(index.removed))
+	i := 0
+
+	for _, key := range index.sorted {
+		if index.removed[key] {
+			continue
+		}
+
+		for i < len(added) && added[i] < key {
+			merged = append(merged, added[i])
+			i++
+		}
+
+		merged = append(merged, key)
+	}
+
+	index.sorted = append(merged, added[i:]...)
+	index.added = map[string]bool{}
+	index.removed = map[string]bool{}
+
+	return index.sorted
+}
+
+// rangeKeys returns the keys from startKey up to but excluding endKey, in
+// order. An empty endKey leaves the range open.
+func (index *keyIndex) rangeKeys(startKey string, endKey string) []string {
+	keys := index.keys()
+	start := sort.SearchStrings(keys, startKey)
+	end := len(keys)
+
+	if endKey != "" {
+		end = sort.SearchStrings(keys, endKey)
+	}
+
+	if end < start {
+		return nil
+	}
+
+	return keys[start:end]
+}
@@ -0,0 +1,65 @@
+package teststub
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeyIndex(t *testing.T) {
+	index := newKeyIndex()
+
+	for _, key := range []string{"c", "a", "e"} {
+		index.add(key)
+	}
+
+	if keys := index.keys(); !reflect.DeepEqual(keys, []string{"a", "c", "e"}) {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+
+	// Changes made between reads are merged in by the next one, and a key
+	// removed and added again is kept.
+	index.add("b")
+	index.remove("c")
+	index.add("d")
+	index.remove("d")
+	index.remove("e")
+	index.add("e")
+
+	if keys := index.keys(); !reflect.DeepEqual(keys, []string{"a", "b", "e"}) {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+
+	if keys := index.rangeKeys("b", "e"); !reflect.DeepEqual(keys, []string{"b"}) {
+		t.Fatalf("unexpected range %v", keys)
+	}
+
+	if keys := index.rangeKeys("b", ""); !reflect.DeepEqual(keys, []string{"b", "e"}) {
+		t.Fatalf("unexpected open range %v", keys)
+	}
+
+	if keys := index.rangeKeys("e", "b"); len(keys) != 0 {
+		t.Fatalf("unexpected inverted range %v", keys)
+	}
+}
+
+func TestRangeExcludesCompositeKeys(t *testing.T) {
+	stub := New("echo", new(echoChaincode))
+	composite, _ := stub.CreateCompositeKey("type", []string{"id"})
+	stub.Load(map[string][]byte{"a": []byte("1"), composite: []byte("2")})
+
+	iterator, err := stub.GetStateByRange("", "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kv, err := iterator.Next()
+
+	if err != nil || kv.Key != "a" || iterator.HasNext() {
+		t.Fatalf("expected only the simple key, got %v %v", kv, err)
+	}
+
+	if _, err := stub.GetStateByRange(composite, ""); err == nil {
+		t.Fatal("expected a composite start key to be rejected")
+	}
+}
@@ -0,0 +1,464 @@
+package teststub
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// mangoQuery is the subset of a CouchDB query that the emulator evaluates.
+// Other members, such as use_index and fields, are accepted and ignored.
+type mangoQuery struct {
+	Selector map[string]interface{} `json:"selector"`
+	Sort     []interface{}          `json:"sort"`
+	Limit    int                    `json:"limit"`
+	Skip     int                    `json:"skip"`
+}
+
+type sortField struct {
+	path       string
+	descending bool
+}
+
+func parseMangoQuery(query string) (*mangoQuery, []sortField, error) {
+	var parsed mangoQuery
+	decoder := json.NewDecoder(strings.NewReader(query))
+	decoder.UseNumber()
+	err := decoder.Decode(&parsed)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("Invalid query: %v", err)
+	}
+
+	if parsed.Selector == nil {
+		return nil, nil, errors.New("Query has no selector")
+	}
+
+	var fields []sortField
+
+	for _, entry := range parsed.Sort {
+		switch value := entry.(type) {
+		case string:
+			fields = append(fields, sortField{path: value})
+		case map[string]interface{}:
+			if len(value) != 1 {
+				return nil, nil, errors.New("Sort entries must name one field")
+			}
+
+			for path, direction := range value {
+				if direction != "asc" && direction != "desc" {
+					return nil, nil, fmt.Errorf("Invalid sort direction %v", direction)
+				}
+
+				fields = append(fields, sortField{path, direction == "desc"})
+			}
+		default:
+			return nil, nil, fmt.Errorf("Invalid sort entry %v", entry)
+		}
+	}
+
+	return &parsed, fields, nil
+}
+
+// matchSelector reports whether doc matches a Mango selector. Supported are
+// implicit equality, the combination operators $and, $or, $nor and $not, and
+// the condition operators $eq, $ne, $gt, $gte, $lt, $lte, $in, $nin, $exists,
+// $elemMatch and $all, on dotted field paths.
+func matchSelector(doc interface{}, selector map[string]interface{}) (bool, error) {
+	for field, condition := range selector {
+		var matched bool
+		var err error
+
+		switch field {
+		case "$and", "$or", "$nor":
+			matched, err = matchCombination(doc, field, condition)
+		case "$not":
+			subSelector, ok := condition.(map[string]interface{})
+
+			if !ok {
+				return false, errors.New("$not needs a selector")
+			}
+
+			matched, err = matchSelector(doc, subSelector)
+			matched = !matched
+		default:
+			if strings.HasPrefix(field, "$") {
+				return false, fmt.Errorf("Unsupported operator %s", field)
+			}
+
+			value, exists := lookupField(doc, field)
+			matched, err = matchCondition(value, exists, condition)
+		}
+
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func matchCombination(doc interface{}, operator string, condition interface{}) (bool, error) {
+	selectors, ok := condition.([]interface{})
+
+	if !ok {
+		return false, fmt.Errorf("%s needs an array of selectors", operator)
+	}
+
+	matches := 0
+
+	for _, entry := range selectors {
+		subSelector, ok := entry.(map[string]interface{})
+
+		if !ok {
+			return false, fmt.Errorf("%s needs an array of selectors", operator)
+		}
+
+		matched, err := matchSelector(doc, subSelector)
+
+		if err != nil {
+			return false, err
+		}
+
+		if matched {
+			matches++
+		}
+	}
+
+	switch operator {
+	case "$and":
+		return matches == len(selectors), nil
+	case "$or":
+		return matches > 0, nil
+	default:
+		return matches == 0, nil
+	}
+}
+
+// matchCondition matches the value of a field against its condition, which
+// is either a value to equal or an object of condition operators.
+func matchCondition(value interface{}, exists bool, condition interface{}) (bool, error) {
+	operators, ok := condition.(map[string]interface{})
+
+	if !ok || !hasOperators(operators) {
+		return exists && compareValues(value, condition) == 0, nil
+	}
+
+	for operator, operand := range operators {
+		matched, err := matchOperator(value, exists, operator, operand)
+
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func hasOperators(object map[string]interface{}) bool {
+	for key := range object {
+		if strings.HasPrefix(key, "$") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchOperator(value interface{}, exists bool, operator string, operand interface{}) (bool, error) {
+	switch operator {
+	case "$exists":
+		want, ok := operand.(bool)
+
+		if !ok {
+			return false, errors.New("$exists needs a boolean")
+		}
+
+		return exists == want, nil
+	case "$ne":
+		return !exists || compareValues(value, operand) != 0, nil
+	case "$nin":
+		in, err := matchIn(value, operand)
+		return !exists || !in, err
+	}
+
+	if !exists {
+		return false, nil
+	}
+
+	switch operator {
+	case "$eq":
+		return compareValues(value, operand) == 0, nil
+	case "$gt":
+		return sameKind(value, operand) && compareValues(value, operand) > 0, nil
+	case "$gte":
+		return sameKind(value, operand) && compareValues(value, operand) >= 0, nil
+	case "$lt":
+		return sameKind(value, operand) && compareValues(value, operand) < 0, nil
+	case "$lte":
+		return sameKind(value, operand) && compareValues(value, operand) <= 0, nil
+	case "$in":
+		return matchIn(value, operand)
+	case "$elemMatch":
+		elements, ok := value.([]interface{})
+
+		if !ok {
+			return false, nil
+		}
+
+		for _, element := range elements {
+			matched, err := matchElement(element, operand)
+
+			if err != nil || matched {
+				return matched, err
+			}
+		}
+
+		return false, nil
+	case "$all":
+		elements, ok := value.([]interface{})
+		wanted, isArray := operand.([]interface{})
+
+		if !isArray {
+			return false, errors.New("$all needs an array")
+		}
+
+		if !ok {
+			return false, nil
+		}
+
+		for _, want := range wanted {
+			in, _ := matchIn(want, elements)
+
+			if !in {
+				return false, nil
+			}
+		}
+
+		return true, nil
+	}
+
+	return false, fmt.Errorf("Unsupported operator %s", operator)
+}
+
+// matchElement matches an array element for $elemMatch, whose operand is
+// either a selector over the element's fields or conditions on the element.
+func matchElement(element interface{}, operand interface{}) (bool, error) {
+	conditions, ok := operand.(map[string]interface{})
+
+	if !ok {
+		return false, errors.New("$elemMatch needs an object")
+	}
+
+	if hasOperators(conditions) {
+		for key := range conditions {
+			if !strings.HasPrefix(key, "$") || key == "$and" || key == "$or" || key == "$nor" || key == "$not" {
+				return matchSelector(element, conditions)
+			}
+		}
+
+		return matchCondition(element, true, conditions)
+	}
+
+	return matchSelector(element, conditions)
+}
+
+func matchIn(value interface{}, operand interface{}) (bool, error) {
+	candidates, ok := operand.([]interface{})
+
+	if !ok {
+		return false, errors.New("$in and $nin need an array")
+	}
+
+	for _, candidate := range candidates {
+		if compareValues(value, candidate) == 0 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func lookupField(doc interface{}, path string) (interface{}, bool) {
+	value := doc
+
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+
+		if !ok {
+			return nil, false
+		}
+
+		value, ok = object[name]
+
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+// typeRank orders JSON types the way CouchDB collates them.
+func typeRank(value interface{}) int {
+	switch value.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case json.Number, float64, int, int64:
+		return 2
+	case string:
+		return 3
+	case []interface{}:
+		return 4
+	default:
+		return 5
+	}
+}
+
+// sameKind reports whether the range operators can compare value and operand;
+// CouchDB never matches a range condition across types.
+func sameKind(value interface{}, operand interface{}) bool {
+	return typeRank(value) == typeRank(operand)
+}
+
+func toFloat(value interface{}) float64 {
+	switch number := value.(type) {
+	case json.Number:
+		f, _ := number.Float64()
+		return f
+	case float64:
+		return number
+	case int:
+		return float64(number)
+	case int64:
+		return float64(number)
+	}
+
+	return 0
+}
+
+// compareValues returns -1, 0 or 1 as a collates before, equal to or after b.
+func compareValues(a interface{}, b interface{}) int {
+	rankA, rankB := typeRank(a), typeRank(b)
+
+	if rankA != rankB {
+		if rankA < rankB {
+			return -1
+		}
+
+		return 1
+	}
+
+	switch a := a.(type) {
+	case nil:
+		return 0
+	case bool:
+		bValue := b.(bool)
+
+		if a == bValue {
+			return 0
+		} else if !a {
+			return -1
+		}
+
+		return 1
+	case string:
+		return strings.Compare(a, b.(string))
+	case []interface{}:
+		bValue := b.([]interface{})
+
+		for i := 0; i < len(a) && i < len(bValue); i++ {
+			if c := compareValues(a[i], bValue[i]); c != 0 {
+				return c
+			}
+		}
+
+		return compareInts(len(a), len(bValue))
+	case map[string]interface{}:
+		aJson, _ := json.Marshal(a)
+		bJson, _ := json.Marshal(b)
+
+		return bytes.Compare(aJson, bJson)
+	}
+
+	aFloat, bFloat := toFloat(a), toFloat(b)
+
+	if aFloat < bFloat {
+		return -1
+	} else if aFloat > bFloat {
+		return 1
+	}
+
+	return 0
+}
+
+func compareInts(a int, b int) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+
+	return 0
+}
+
+type queryMatch struct {
+	key   string
+	value []byte
+	doc   interface{}
+}
+
+// runQuery returns the state entries that match query in result order:
+// sorted by the sort fields, then by key.
+func (stub *Stub) runQuery(query string) ([]queryMatch, *mangoQuery, error) {
+	parsed, sortFields, err := parseMangoQuery(query)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var matches []queryMatch
+
+	for _, key := range stub.committedRangeKeys("", "") {
+		value := stub.committedValue(key)
+		decoder := json.NewDecoder(bytes.NewReader(value))
+		decoder.UseNumber()
+
+		var doc map[string]interface{}
+
+		if decoder.Decode(&doc) != nil {
+			continue
+		}
+
+		matched, err := matchSelector(doc, parsed.Selector)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if matched {
+			matches = append(matches, queryMatch{key, value, doc})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		for _, field := range sortFields {
+			a, _ := lookupField(matches[i].doc, field.path)
+			b, _ := lookupField(matches[j].doc, field.path)
+			c := compareValues(a, b)
+
+			if c != 0 {
+				return (c < 0) != field.descending
+			}
+		}
+
+		return matches[i].key < matches[j].key
+	})
+
+	return matches, parsed, nil
+}
@@ -0,0 +1,295 @@
+package teststub
+
+import (
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Network simulates a channel whose member organizations submit transactions
+// to one chaincode. Transactions are endorsed against the committed state
+// when they are submitted, and only take effect when a block is cut. As on a
+// committing peer, a transaction that read a key or a range of keys written
+// since its endorsement, by an earlier block or an earlier transaction in its
+// own block, is invalidated and its writes are discarded.
+type Network struct {
+	// Stub holds the committed ledger: its State, History and Events.
+	Stub *Stub
+
+	// Blocks holds the blocks cut so far, in order.
+	Blocks []*Block
+
+	members  map[string]bool
+	versions map[string]Version
+	pending  []*Transaction
+}
+
+// Version identifies the transaction that last wrote a key. Blocks are
+// numbered from 1, so the zero Version stands for a key that does not exist.
+type Version struct {
+	BlockNumber uint64
+	TxNumber    int
+}
+
+// Block is a block of ordered transactions, valid or not.
+type Block struct {
+	Number       uint64
+	Transactions []*Transaction
+}
+
+// Transaction is a transaction submitted to the network. ValidationCode is
+// NOT_VALIDATED until the transaction's block is cut, and stays so for a
+// transaction whose endorsement failed, since it is never ordered.
+type Transaction struct {
+	TxId           string
+	MspId          string
+	Args           []string
+	Timestamp      time.Time
+	Endorsement    Endorsement
+	ValidationCode pb.TxValidationCode
+	BlockNumber    uint64
+
+	ordered       bool
+	readVersions  map[string]Version
+	rangeVersions [][]Version
+}
+
+// Response returns the response of the transaction's endorsement.
+func (tx *Transaction) Response() pb.Response {
+	return tx.Endorsement.Response
+}
+
+// Valid reports whether the transaction was committed.
+func (tx *Transaction) Valid() bool {
+	return tx.ValidationCode == pb.TxValidationCode_VALID
+}
+
+// NewNetwork returns a network running chaincode on a channel whose members
+// are the MSPs mspIds. The chaincode is not yet instantiated.
+func NewNetwork(name string, chaincode shim.Chaincode, mspIds ...string) *Network {
+	network := &Network{
+		Stub:     New(name, chaincode),
+		members:  map[string]bool{},
+		versions: map[string]Version{},
+	}
+
+	for _, mspId := range mspIds {
+		network.members[mspId] = true
+	}
+
+	return network
+}
+
+// SetTime sets the timestamp of the following proposals.
+func (network *Network) SetTime(now time.Time) {
+	network.Stub.SetTime(now)
+}
+
+// Now returns the timestamp of the following proposals.
+func (network *Network) Now() time.Time {
+	return network.Stub.Now()
+}
+
+// Advance moves the timestamp of the following proposals forward by d.
+func (network *Network) Advance(d time.Duration) {
+	network.Stub.Advance(d)
+}
+
+// Instantiate runs the chaincode's Init, submitted by mspId, in a block of
+// its own.
+func (network *Network) Instantiate(mspId string, args ...string) *Transaction {
+	tx := network.propose(mspId, args, network.Stub.chaincode.Init)
+	network.Order(tx)
+	network.CutBlock()
+
+	return tx
+}
+
+// Submit endorses args as a proposal by mspId and, if the endorsement
+// succeeds, queues the transaction for the next block.
+func (network *Network) Submit(mspId string, args ...string) *Transaction {
+	tx := network.Propose(mspId, args...)
+	network.Order(tx)
+
+	return tx
+}
+
+// Propose endorses args as a proposal by mspId without queuing the
+// transaction, so that it can be ordered after later blocks with Order.
+func (network *Network) Propose(mspId string, args ...string) *Transaction {
+	return network.propose(mspId, args, network.Stub.chaincode.Invoke)
+}
+
+// Order queues proposed transactions for the next block. Transactions whose
+// endorsement failed, or that were already ordered, are skipped.
+func (network *Network) Order(txs ...*Transaction) {
+	for _, tx := range txs {
+		if tx.readVersions != nil && !tx.ordered {
+			tx.ordered = true
+			network.pending = append(network.pending, tx)
+		}
+	}
+}
+
+// Invoke submits args by mspId and cuts a block holding the pending
+// transactions.
+func (network *Network) Invoke(mspId string, args ...string) *Transaction {
+	tx := network.Submit(mspId, args...)
+	network.CutBlock()
+
+	return tx
+}
+
+// Query evaluates args as a proposal by mspId without submitting it.
+func (network *Network) Query(mspId string, args ...string) pb.Response {
+	if !network.members[mspId] {
+		return shim.Error(mspId + " is not a member of the channel")
+	}
+
+	network.Stub.SetCreator(mspId)
+	network.Stub.simulating = true
+	defer func() { network.Stub.simulating = false }()
+
+	return network.Stub.endorse(args, network.Stub.chaincode.Invoke).Response
+}
+
+func (network *Network) propose(mspId string, args []string, fn func(shim.ChaincodeStubInterface) pb.Response) *Transaction {
+	tx := &Transaction{
+		MspId:          mspId,
+		Args:           args,
+		Timestamp:      network.Now(),
+		ValidationCode: pb.TxValidationCode_NOT_VALIDATED,
+	}
+
+	if !network.members[mspId] {
+		tx.Endorsement.Response = shim.Error(mspId + " is not a member of the channel")
+
+		return tx
+	}
+
+	network.Stub.SetCreator(mspId)
+	network.Stub.simulating = true
+	tx.Endorsement = network.Stub.endorse(args, fn)
+	network.Stub.simulating = false
+	tx.TxId = tx.Endorsement.TxId
+
+	if tx.Endorsement.Response.Status >= shim.ERRORTHRESHOLD {
+		return tx
+	}
+
+	tx.readVersions = map[string]Version{}
+
+	for _, key := range tx.Endorsement.Reads {
+		tx.readVersions[key] = network.versions[key]
+	}
+
+	for _, rangeRead := range tx.Endorsement.RangeReads {
+		versions := make([]Version, len(rangeRead.Keys))
+
+		for i, key := range rangeRead.Keys {
+			versions[i] = network.versions[key]
+		}
+
+		tx.rangeVersions = append(tx.rangeVersions, versions)
+	}
+
+	return tx
+}
+
+// CutBlock orders the pending transactions into a block, validates them in
+// order and commits the valid ones. It returns nil when nothing is pending.
+func (network *Network) CutBlock() *Block {
+	if len(network.pending) == 0 {
+		return nil
+	}
+
+	block := &Block{Number: uint64(len(network.Blocks) + 1), Transactions: network.pending}
+	network.pending = nil
+
+	for i, tx := range block.Transactions {
+		tx.BlockNumber = block.Number
+		tx.ValidationCode = network.validate(tx)
+
+		if tx.Valid() {
+			network.commit(tx, Version{block.Number, i})
+		}
+	}
+
+	network.Blocks = append(network.Blocks, block)
+
+	return block
+}
+
+func (network *Network) validate(tx *Transaction) pb.TxValidationCode {
+	for key, version := range tx.readVersions {
+		if network.versions[key] != version {
+			return pb.TxValidationCode_MVCC_READ_CONFLICT
+		}
+	}
+
+	for i, rangeRead := range tx.Endorsement.RangeReads {
+		keys := network.rangeKeys(rangeRead)
+
+		if len(keys) != len(rangeRead.Keys) {
+			return pb.TxValidationCode_PHANTOM_READ_CONFLICT
+		}
+
+		for j, key := range keys {
+			if key != rangeRead.Keys[j] || network.versions[key] != tx.rangeVersions[i][j] {
+				return pb.TxValidationCode_PHANTOM_READ_CONFLICT
+			}
+		}
+	}
+
+	return pb.TxValidationCode_VALID
+}
+
+// rangeKeys returns the committed keys of the part of rangeRead that the
+// transaction iterated over.
+func (network *Network) rangeKeys(rangeRead *RangeRead) []string {
+	keys := network.Stub.index.rangeKeys(rangeRead.StartKey, rangeRead.EndKey)
+
+	if rangeRead.Exhausted {
+		return keys
+	}
+
+	if len(rangeRead.Keys) == 0 {
+		return nil
+	}
+
+	last := rangeRead.Keys[len(rangeRead.Keys)-1]
+
+	return keys[:sort.Search(len(keys), func(i int) bool { return keys[i] > last })]
+}
+
+func (network *Network) commit(tx *Transaction, version Version) {
+	stub := network.Stub
+	txTimestamp := toTimestamp(tx.Timestamp)
+	stub.MockTransactionStart(tx.TxId)
+
+	for _, write := range tx.Endorsement.Writes {
+		if write.IsDelete {
+			stub.deleteState(write.Key)
+			delete(network.versions, write.Key)
+		} else {
+			stub.setState(write.Key, write.Value)
+			network.versions[write.Key] = version
+		}
+
+		stub.History[write.Key] = append(stub.History[write.Key], &queryresult.KeyModification{
+			TxId:      tx.TxId,
+			Value:     write.Value,
+			Timestamp: txTimestamp,
+			IsDelete:  write.IsDelete,
+		})
+	}
+
+	if tx.Endorsement.Event != nil {
+		stub.Events = append(stub.Events, tx.Endorsement.Event)
+	}
+
+	stub.MockTransactionEnd(tx.TxId)
+}
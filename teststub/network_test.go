@@ -0,0 +1,138 @@
+package teststub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func newEchoNetwork(t *testing.T) *Network {
+	network := NewNetwork("echo", new(echoChaincode), "Org1MSP", "Org2MSP")
+	network.SetTime(time.Unix(1000, 0))
+
+	if !network.Instantiate("Org1MSP").Valid() {
+		t.Fatal("instantiation was not committed")
+	}
+
+	return network
+}
+
+func expectValidation(t *testing.T, tx *Transaction, code pb.TxValidationCode) {
+	t.Helper()
+
+	if tx.ValidationCode != code {
+		t.Fatalf("expected %s to be %s, got %s: %s", tx.Args, code, tx.ValidationCode, tx.Response().Message)
+	}
+}
+
+func TestNetworkCommitsWhenBlockIsCut(t *testing.T) {
+	network := newEchoNetwork(t)
+
+	tx := network.Submit("Org1MSP", "put", "k", "v1")
+	network.Advance(time.Minute)
+	other := network.Submit("Org2MSP", "put", "other", "v1")
+
+	if network.Stub.State["k"] != nil || tx.ValidationCode != pb.TxValidationCode_NOT_VALIDATED {
+		t.Fatal("a submitted transaction took effect before its block was cut")
+	}
+
+	block := network.CutBlock()
+
+	if block == nil || block.Number != 2 || len(block.Transactions) != 2 {
+		t.Fatalf("unexpected block %+v", block)
+	}
+
+	expectValidation(t, tx, pb.TxValidationCode_VALID)
+	expectValidation(t, other, pb.TxValidationCode_VALID)
+
+	if string(network.Stub.State["k"]) != "v1" || string(network.Stub.State["other"]) != "v1" {
+		t.Fatal("a valid transaction was not committed")
+	}
+
+	history := network.Stub.History["other"]
+
+	if len(history) != 1 || history[0].TxId != other.TxId || history[0].Timestamp.Seconds != 1060 {
+		t.Fatalf("unexpected history %v", history)
+	}
+
+	if len(network.Stub.Events) != 2 || network.Stub.Events[1].TxId != other.TxId {
+		t.Fatalf("unexpected events %v", network.Stub.Events)
+	}
+
+	if network.CutBlock() != nil {
+		t.Fatal("an empty block was cut")
+	}
+}
+
+func TestNetworkCreators(t *testing.T) {
+	network := newEchoNetwork(t)
+
+	response := network.Query("Org2MSP", "creator")
+
+	if string(response.Payload) != "Org2MSP" {
+		t.Fatalf("expected Org2MSP, got %q", response.Payload)
+	}
+
+	tx := network.Invoke("Org3MSP", "put", "k", "v1")
+
+	if tx.Response().Status != shim.ERROR || tx.ValidationCode != pb.TxValidationCode_NOT_VALIDATED || network.Stub.State["k"] != nil {
+		t.Fatal("a transaction from outside the channel was accepted")
+	}
+
+	tx = network.Invoke("Org1MSP", "putAndFail", "k", "v1")
+
+	if tx.ValidationCode != pb.TxValidationCode_NOT_VALIDATED || len(network.Blocks) != 1 {
+		t.Fatal("a transaction whose endorsement failed was ordered")
+	}
+}
+
+func TestNetworkReadConflict(t *testing.T) {
+	network := newEchoNetwork(t)
+	expectValidation(t, network.Invoke("Org1MSP", "put", "k", "a"), pb.TxValidationCode_VALID)
+
+	first := network.Submit("Org1MSP", "append", "k", "b")
+	second := network.Submit("Org2MSP", "append", "k", "c")
+	blind := network.Submit("Org2MSP", "put", "k", "d")
+	network.CutBlock()
+
+	expectValidation(t, first, pb.TxValidationCode_VALID)
+	expectValidation(t, second, pb.TxValidationCode_MVCC_READ_CONFLICT)
+	expectValidation(t, blind, pb.TxValidationCode_VALID)
+
+	if string(network.Stub.State["k"]) != "d" || len(network.Stub.History["k"]) != 3 {
+		t.Fatalf("unexpected state %q and history %v", network.Stub.State["k"], network.Stub.History["k"])
+	}
+
+	stale := network.Propose("Org1MSP", "append", "k", "e")
+	expectValidation(t, network.Invoke("Org2MSP", "put", "k", "f"), pb.TxValidationCode_VALID)
+	network.Order(stale)
+	network.CutBlock()
+	expectValidation(t, stale, pb.TxValidationCode_MVCC_READ_CONFLICT)
+}
+
+func TestNetworkPhantomRead(t *testing.T) {
+	network := newEchoNetwork(t)
+	expectValidation(t, network.Invoke("Org1MSP", "put", "a1", "x"), pb.TxValidationCode_VALID)
+
+	count := network.Submit("Org1MSP", "count", "a", "b")
+	insert := network.Submit("Org2MSP", "put", "a2", "x")
+	network.CutBlock()
+
+	expectValidation(t, count, pb.TxValidationCode_VALID)
+	expectValidation(t, insert, pb.TxValidationCode_VALID)
+
+	insert = network.Submit("Org2MSP", "put", "a3", "x")
+	count = network.Submit("Org1MSP", "count", "a", "b")
+	outside := network.Submit("Org1MSP", "count", "b", "c")
+	network.CutBlock()
+
+	expectValidation(t, insert, pb.TxValidationCode_VALID)
+	expectValidation(t, count, pb.TxValidationCode_PHANTOM_READ_CONFLICT)
+	expectValidation(t, outside, pb.TxValidationCode_VALID)
+
+	if string(network.Stub.State["count"]) != "0" {
+		t.Fatalf("expected the count outside the range to be committed, got %q", network.Stub.State["count"])
+	}
+}
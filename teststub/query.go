@@ -0,0 +1,198 @@
+package teststub
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// GetQueryResult evaluates a CouchDB query against the state. The selector,
+// sort, limit and skip members are honoured; see matchSelector for the
+// supported operators. Values that are not JSON objects never match. As on a
+// peer, the results are not recorded in the read set.
+func (stub *Stub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	matches, parsed, err := stub.runQuery(query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	matches = skipMatches(matches, parsed.Skip)
+
+	if parsed.Limit > 0 && parsed.Limit < len(matches) {
+		matches = matches[:parsed.Limit]
+	}
+
+	return stub.queryIterator(matches), nil
+}
+
+// GetQueryResultWithPagination evaluates a CouchDB query like GetQueryResult
+// and returns pageSize results from bookmark on. As with CouchDB, pageSize
+// takes the place of the query's limit, and a bookmark is returned with
+// every page, including the last.
+func (stub *Stub) GetQueryResultWithPagination(query string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	if pageSize <= 0 {
+		return nil, nil, errors.New("Page size must be positive")
+	}
+
+	matches, parsed, err := stub.runQuery(query)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	offset := 0
+
+	if bookmark != "" {
+		offset, err = strconv.Atoi(bookmark)
+
+		if err != nil || offset < 0 {
+			return nil, nil, fmt.Errorf("Invalid bookmark %q", bookmark)
+		}
+	}
+
+	matches = skipMatches(matches, parsed.Skip+offset)
+
+	if int(pageSize) < len(matches) {
+		matches = matches[:pageSize]
+	}
+
+	metadata := &pb.QueryResponseMetadata{
+		FetchedRecordsCount: int32(len(matches)),
+		Bookmark:            strconv.Itoa(offset + len(matches)),
+	}
+
+	return stub.queryIterator(matches), metadata, nil
+}
+
+// GetStateByRangeWithPagination returns pageSize keys of the range from
+// bookmark on. As on a peer, the bookmark is the key the next page starts at,
+// and is empty after the last page.
+func (stub *Stub) GetStateByRangeWithPagination(startKey string, endKey string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	if bookmark != "" {
+		startKey = bookmark
+	}
+
+	return stub.rangePage(startKey, endKey, pageSize)
+}
+
+// GetStateByPartialCompositeKeyWithPagination returns pageSize keys of the
+// partial composite key from bookmark on, like GetStateByRangeWithPagination.
+func (stub *Stub) GetStateByPartialCompositeKeyWithPagination(objectType string, attributes []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	startKey, err := stub.CreateCompositeKey(objectType, attributes)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	endKey := startKey + string(utf8.MaxRune)
+
+	if bookmark != "" {
+		startKey = bookmark
+	}
+
+	return stub.rangePage(startKey, endKey, pageSize)
+}
+
+// rangePage returns the keys from startKey up to but excluding endKey, at
+// most pageSize of them. An empty endKey leaves the range open.
+func (stub *Stub) rangePage(startKey string, endKey string, pageSize int32) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	if pageSize <= 0 {
+		return nil, nil, errors.New("Page size must be positive")
+	}
+
+	keys := stub.committedRangeKeys(startKey, endKey)
+	nextKey := ""
+
+	if len(keys) > int(pageSize) {
+		nextKey = keys[pageSize]
+		keys = keys[:pageSize]
+	}
+
+	metadata := &pb.QueryResponseMetadata{FetchedRecordsCount: int32(len(keys)), Bookmark: nextKey}
+
+	// The page reads the range up to the key the next page starts at.
+	if nextKey != "" {
+		endKey = nextKey
+	}
+
+	return stub.recordRange(startKey, endKey, &keysIterator{stub: stub, keys: keys}), metadata, nil
+}
+
+func skipMatches(matches []queryMatch, skip int) []queryMatch {
+	if skip >= len(matches) {
+		return nil
+	}
+
+	return matches[skip:]
+}
+
+func (stub *Stub) queryIterator(matches []queryMatch) *stateIterator {
+	results := make([]*queryresult.KV, len(matches))
+
+	for i, match := range matches {
+		results[i] = &queryresult.KV{Namespace: stub.Name, Key: match.key, Value: match.value}
+	}
+
+	return &stateIterator{results: results}
+}
+
+// rangeIterator returns the keys from startKey up to but excluding endKey,
+// recording them as a range read.
+func (stub *Stub) rangeIterator(startKey string, endKey string) shim.StateQueryIteratorInterface {
+	return stub.recordRange(startKey, endKey, &keysIterator{stub: stub, keys: stub.committedRangeKeys(startKey, endKey)})
+}
+
+// keysIterator iterates over keys, reading their values as it goes, so that a
+// range over a large state does not copy it.
+type keysIterator struct {
+	stub *Stub
+	keys []string
+}
+
+func (iterator *keysIterator) HasNext() bool {
+	return len(iterator.keys) > 0
+}
+
+func (iterator *keysIterator) Next() (*queryresult.KV, error) {
+	if len(iterator.keys) == 0 {
+		return nil, errors.New("No more results")
+	}
+
+	key := iterator.keys[0]
+	iterator.keys = iterator.keys[1:]
+
+	return &queryresult.KV{Namespace: iterator.stub.Name, Key: key, Value: iterator.stub.committedValue(key)}, nil
+}
+
+func (iterator *keysIterator) Close() error {
+	return nil
+}
+
+type stateIterator struct {
+	results []*queryresult.KV
+}
+
+func (iterator *stateIterator) HasNext() bool {
+	return len(iterator.results) > 0
+}
+
+func (iterator *stateIterator) Next() (*queryresult.KV, error) {
+	if len(iterator.results) == 0 {
+		return nil, errors.New("No more results")
+	}
+
+	result := iterator.results[0]
+	iterator.results = iterator.results[1:]
+
+	return result, nil
+}
+
+func (iterator *stateIterator) Close() error {
+	return nil
+}
@@ -0,0 +1,211 @@
+package teststub
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func newQueryStub() *Stub {
+	stub := New("echo", new(echoChaincode))
+	stub.Seed("a", []byte(`{"name":"a","age":30,"tags":["x","y"],"address":{"city":"Olympus"}}`))
+	stub.Seed("b", []byte(`{"name":"b","age":20,"tags":["y"]}`))
+	stub.Seed("c", []byte(`{"name":"c","age":40,"address":{"city":"Tharsis"}}`))
+	stub.Seed("d", []byte(`{"name":"d","age":"old"}`))
+	stub.Seed("e", []byte(`not json`))
+
+	return stub
+}
+
+func queryKeys(t *testing.T, iterator shim.StateQueryIteratorInterface) []string {
+	t.Helper()
+	keys := []string{}
+
+	for iterator.HasNext() {
+		kv, err := iterator.Next()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		keys = append(keys, kv.Key)
+	}
+
+	return keys
+}
+
+func expectKeys(t *testing.T, keys []string, expected ...string) {
+	t.Helper()
+
+	if len(keys) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, keys)
+	}
+
+	for i := range keys {
+		if keys[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, keys)
+		}
+	}
+}
+
+func TestQuerySelectors(t *testing.T) {
+	stub := newQueryStub()
+
+	tests := []struct {
+		name     string
+		selector string
+		expected []string
+	}{
+		{"implicit equality", `{"name":"b"}`, []string{"b"}},
+		{"$eq", `{"age":{"$eq":30}}`, []string{"a"}},
+		{"$ne", `{"name":{"$ne":"b"}}`, []string{"a", "c", "d"}},
+		{"$gt", `{"age":{"$gt":25}}`, []string{"a", "c"}},
+		{"$gte and $lt", `{"age":{"$gte":20,"$lt":40}}`, []string{"a", "b"}},
+		{"$lte", `{"age":{"$lte":30}}`, []string{"a", "b"}},
+		{"$in", `{"name":{"$in":["a","c","z"]}}`, []string{"a", "c"}},
+		{"$nin", `{"name":{"$nin":["a","c"]}}`, []string{"b", "d"}},
+		{"$exists", `{"tags":{"$exists":false}}`, []string{"c", "d"}},
+		{"$elemMatch", `{"tags":{"$elemMatch":{"$eq":"x"}}}`, []string{"a"}},
+		{"$all", `{"tags":{"$all":["x","y"]}}`, []string{"a"}},
+		{"$and", `{"$and":[{"age":{"$gt":10}},{"tags":{"$exists":true}}]}`, []string{"a", "b"}},
+		{"$or", `{"$or":[{"name":"a"},{"age":{"$gt":35}}]}`, []string{"a", "c"}},
+		{"$nor", `{"$nor":[{"name":"a"},{"name":"b"}]}`, []string{"c", "d"}},
+		{"$not", `{"$not":{"name":"a"}}`, []string{"b", "c", "d"}},
+		{"nested field", `{"address.city":"Tharsis"}`, []string{"c"}},
+		{"no match across types", `{"age":{"$gt":"a"}}`, []string{"d"}},
+		{"empty selector", `{}`, []string{"a", "b", "c", "d"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			iterator, err := stub.GetQueryResult(`{"selector":` + test.selector + `}`)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expectKeys(t, queryKeys(t, iterator), test.expected...)
+		})
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	stub := newQueryStub()
+
+	for _, query := range []string{
+		`not json`,
+		`{}`,
+		`{"selector":{"$where":"x"}}`,
+		`{"selector":{"age":{"$regex":"x"}}}`,
+		`{"selector":{"$or":{"name":"a"}}}`,
+		`{"selector":{},"sort":[{"age":"up"}]}`,
+	} {
+		_, err := stub.GetQueryResult(query)
+
+		if err == nil {
+			t.Fatalf("expected %s to be rejected", query)
+		}
+	}
+}
+
+func TestQuerySortSkipAndLimit(t *testing.T) {
+	stub := newQueryStub()
+
+	iterator, err := stub.GetQueryResult(`{"selector":{"age":{"$gt":0}},"sort":[{"age":"desc"}]}`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectKeys(t, queryKeys(t, iterator), "c", "a", "b")
+
+	iterator, err = stub.GetQueryResult(`{"selector":{},"sort":["age"],"skip":1,"limit":2}`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Numbers collate before strings.
+	expectKeys(t, queryKeys(t, iterator), "a", "c")
+}
+
+func TestQueryPagination(t *testing.T) {
+	stub := newQueryStub()
+	query := `{"selector":{},"sort":[{"name":"desc"}]}`
+	bookmark := ""
+	var keys []string
+
+	for page := 0; page < 3; page++ {
+		iterator, metadata, err := stub.GetQueryResultWithPagination(query, 3, bookmark)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pageKeys := queryKeys(t, iterator)
+
+		if int(metadata.FetchedRecordsCount) != len(pageKeys) {
+			t.Fatalf("fetched %d records but counted %d", len(pageKeys), metadata.FetchedRecordsCount)
+		}
+
+		keys = append(keys, pageKeys...)
+		bookmark = metadata.Bookmark
+	}
+
+	expectKeys(t, keys, "d", "c", "b", "a")
+
+	_, _, err := stub.GetQueryResultWithPagination(query, 3, "nonsense")
+
+	if err == nil {
+		t.Fatal("expected an invalid bookmark to be rejected")
+	}
+}
+
+func TestRangePagination(t *testing.T) {
+	stub := newQueryStub()
+
+	iterator, metadata, err := stub.GetStateByRangeWithPagination("b", "", 2, "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectKeys(t, queryKeys(t, iterator), "b", "c")
+
+	iterator, metadata, err = stub.GetStateByRangeWithPagination("b", "", 2, metadata.Bookmark)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectKeys(t, queryKeys(t, iterator), "d", "e")
+
+	if metadata.Bookmark != "" {
+		t.Fatalf("expected no bookmark after the last page, got %q", metadata.Bookmark)
+	}
+
+	for _, id := range []string{"1", "2", "3"} {
+		key, _ := stub.CreateCompositeKey("item", []string{id})
+		stub.Seed(key, []byte(id))
+	}
+
+	iterator, metadata, err = stub.GetStateByPartialCompositeKeyWithPagination("item", []string{}, 2, "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(queryKeys(t, iterator)) != 2 || metadata.Bookmark == "" {
+		t.Fatal("expected a full first page of composite keys")
+	}
+
+	iterator, _, err = stub.GetStateByPartialCompositeKeyWithPagination("item", []string{}, 2, metadata.Bookmark)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(queryKeys(t, iterator)) != 1 {
+		t.Fatal("expected one composite key on the second page")
+	}
+}
@@ -0,0 +1,496 @@
+// Package teststub provides a chaincode stub for unit tests. It wraps
+// shim.MockStub and fills in what MockStub leaves out: the creator,
+// transient data and timestamp of each transaction, key history, chaincode
+// events, rollback of the writes of failed transactions, paginated range
+// reads, and rich queries evaluated against the state. CheckDeterminism
+// compares what two stubs endorse for the same transaction, and Network
+// orders transactions from several organizations into validated blocks.
+package teststub
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Stub is a shim.ChaincodeStubInterface for tests. Transactions are run with
+// Init, Invoke or Run, which set the arguments, creator, transient data and
+// timestamp seen by the chaincode. The state is held in MockStub's State map,
+// but not in its Keys list; SortedKeys returns the keys in order. As on a
+// peer, reads within a transaction return the committed state, not the
+// transaction's own writes.
+type Stub struct {
+	*shim.MockStub
+
+	// History holds the committed modifications of each key, oldest first.
+	History map[string][]*queryresult.KeyModification
+
+	// Events holds the event set by each committed transaction, in order.
+	Events []*pb.ChaincodeEvent
+
+	chaincode shim.Chaincode
+	index     *keyIndex
+	args      [][]byte
+	creator   []byte
+	transient map[string][]byte
+	now       time.Time
+	txCount   int
+
+	// simulating makes Run roll back every transaction, as a peer simulates
+	// a proposal without committing it.
+	simulating bool
+
+	// The state of the transaction in progress: the keys and ranges it read,
+	// the value each written key had before it, for rollback, and the event
+	// it set.
+	txReads       map[string]bool
+	txRangeReads  []*RangeRead
+	txPriorValues map[string][]byte
+	txWriteOrder  []string
+	txEvent       *pb.ChaincodeEvent
+}
+
+// New returns a stub for chaincode. Its clock starts at the current time and
+// only moves when the test sets it.
+func New(name string, chaincode shim.Chaincode) *Stub {
+	return &Stub{
+		MockStub:  shim.NewMockStub(name, chaincode),
+		History:   map[string][]*queryresult.KeyModification{},
+		chaincode: chaincode,
+		index:     newKeyIndex(),
+		now:       time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+// SetCreator sets the MSP ID of the identity that submits the following
+// transactions.
+func (stub *Stub) SetCreator(mspId string) {
+	stub.SetCreatorIdentity(&msp.SerializedIdentity{Mspid: mspId})
+}
+
+// SetCreatorIdentity sets the serialized identity, MSP ID and certificate,
+// that submits the following transactions.
+func (stub *Stub) SetCreatorIdentity(identity *msp.SerializedIdentity) {
+	stub.creator, _ = proto.Marshal(identity)
+}
+
+// SetTransient sets the transient data of the next transaction only.
+func (stub *Stub) SetTransient(transient map[string][]byte) {
+	stub.transient = transient
+}
+
+// SetTime sets the timestamp of the following transactions.
+func (stub *Stub) SetTime(now time.Time) {
+	stub.now = now
+}
+
+// Now returns the timestamp of the following transactions.
+func (stub *Stub) Now() time.Time {
+	return stub.now
+}
+
+// Advance moves the timestamp of the following transactions forward by d.
+func (stub *Stub) Advance(d time.Duration) {
+	stub.now = stub.now.Add(d)
+}
+
+// Init runs the chaincode's Init as a transaction.
+func (stub *Stub) Init(args ...string) pb.Response {
+	return stub.Run(args, stub.chaincode.Init)
+}
+
+// Invoke runs the chaincode's Invoke as a transaction.
+func (stub *Stub) Invoke(args ...string) pb.Response {
+	return stub.Run(args, stub.chaincode.Invoke)
+}
+
+// Simulate runs the chaincode's Invoke as a transaction and discards its
+// writes, as a peer does for a transaction that is evaluated rather than
+// submitted.
+func (stub *Stub) Simulate(args ...string) pb.Response {
+	stub.simulating = true
+	defer func() { stub.simulating = false }()
+
+	return stub.Invoke(args...)
+}
+
+// Run runs fn as a transaction with args as the chaincode arguments. Like an
+// endorsement that fails, a transaction whose response is an error leaves the
+// state, history and events untouched.
+func (stub *Stub) Run(args []string, fn func(shim.ChaincodeStubInterface) pb.Response) pb.Response {
+	stub.txCount++
+	txId := "tx" + strconv.Itoa(stub.txCount)
+	stub.args = make([][]byte, len(args))
+
+	for i, arg := range args {
+		stub.args[i] = []byte(arg)
+	}
+
+	stub.MockTransactionStart(txId)
+	stub.txReads = map[string]bool{}
+	stub.txRangeReads = nil
+	stub.txPriorValues = map[string][]byte{}
+	stub.txWriteOrder = nil
+	stub.txEvent = nil
+
+	response := fn(stub)
+
+	if response.Status >= shim.ERRORTHRESHOLD || stub.simulating {
+		stub.rollback()
+	} else {
+		stub.commit(txId)
+	}
+
+	stub.MockTransactionEnd(txId)
+	stub.transient = nil
+	stub.txReads = nil
+	stub.txRangeReads = nil
+	stub.txPriorValues = nil
+	stub.txWriteOrder = nil
+
+	return response
+}
+
+// Seed writes key directly as a committed transaction, for state the
+// chaincode under test would not write itself, such as records in a legacy
+// layout.
+func (stub *Stub) Seed(key string, value []byte) {
+	stub.Run(nil, func(shim.ChaincodeStubInterface) pb.Response {
+		err := stub.PutState(key, value)
+
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		return shim.Success(nil)
+	})
+}
+
+// Load writes state directly, as if it had been committed before the test
+// began, without running transactions or recording history. It seeds large
+// states far faster than Seed.
+func (stub *Stub) Load(state map[string][]byte) {
+	for key, value := range state {
+		stub.setState(key, value)
+	}
+}
+
+// SortedKeys returns the keys of the state in order. The slice must not be
+// modified.
+func (stub *Stub) SortedKeys() []string {
+	return stub.index.keys()
+}
+
+// setState writes key without a transaction. As with PutState, an empty
+// value deletes the key.
+func (stub *Stub) setState(key string, value []byte) {
+	if len(value) == 0 {
+		stub.deleteState(key)
+		return
+	}
+
+	if _, ok := stub.State[key]; !ok {
+		stub.index.add(key)
+	}
+
+	stub.State[key] = value
+}
+
+func (stub *Stub) deleteState(key string) {
+	if _, ok := stub.State[key]; ok {
+		stub.index.remove(key)
+		delete(stub.State, key)
+	}
+}
+
+func (stub *Stub) commit(txId string) {
+	txTimestamp, _ := stub.GetTxTimestamp()
+
+	for _, key := range stub.txWriteOrder {
+		value, ok := stub.State[key]
+		stub.History[key] = append(stub.History[key], &queryresult.KeyModification{
+			TxId:      txId,
+			Value:     value,
+			Timestamp: txTimestamp,
+			IsDelete:  !ok,
+		})
+	}
+
+	if stub.txEvent != nil {
+		stub.Events = append(stub.Events, stub.txEvent)
+	}
+}
+
+func (stub *Stub) rollback() {
+	for key, value := range stub.txPriorValues {
+		stub.setState(key, value)
+	}
+}
+
+// recordWrite remembers the value key had before its first write in the
+// transaction in progress.
+func (stub *Stub) recordWrite(key string) {
+	if stub.txPriorValues == nil {
+		stub.txPriorValues = map[string][]byte{}
+	}
+
+	if _, ok := stub.txPriorValues[key]; ok {
+		return
+	}
+
+	stub.txPriorValues[key] = stub.State[key]
+	stub.txWriteOrder = append(stub.txWriteOrder, key)
+}
+
+// committedValue returns the value key had before the transaction in
+// progress wrote it.
+func (stub *Stub) committedValue(key string) []byte {
+	if value, ok := stub.txPriorValues[key]; ok {
+		return value
+	}
+
+	return stub.State[key]
+}
+
+// committedRangeKeys returns the keys from startKey up to but excluding
+// endKey, in order, as they were before the transaction in progress wrote
+// any of them.
+func (stub *Stub) committedRangeKeys(startKey string, endKey string) []string {
+	keys := stub.index.rangeKeys(startKey, endKey)
+
+	if len(stub.txPriorValues) == 0 {
+		return keys
+	}
+
+	committed := make([]string, 0, len(keys))
+
+	for _, key := range keys {
+		if stub.committedValue(key) != nil {
+			committed = append(committed, key)
+		}
+	}
+
+	for key, value := range stub.txPriorValues {
+		_, exists := stub.State[key]
+
+		if value != nil && !exists && key >= startKey && (endKey == "" || key < endKey) {
+			committed = append(committed, key)
+		}
+	}
+
+	sort.Strings(committed)
+
+	return committed
+}
+
+// recordRead remembers that the transaction in progress read key.
+func (stub *Stub) recordRead(key string) {
+	if stub.txReads != nil {
+		stub.txReads[key] = true
+	}
+}
+
+func (stub *Stub) GetArgs() [][]byte {
+	return stub.args
+}
+
+func (stub *Stub) GetStringArgs() []string {
+	args := make([]string, len(stub.args))
+
+	for i, arg := range stub.args {
+		args[i] = string(arg)
+	}
+
+	return args
+}
+
+func (stub *Stub) GetFunctionAndParameters() (string, []string) {
+	args := stub.GetStringArgs()
+
+	if len(args) == 0 {
+		return "", []string{}
+	}
+
+	return args[0], args[1:]
+}
+
+func (stub *Stub) GetCreator() ([]byte, error) {
+	return stub.creator, nil
+}
+
+func (stub *Stub) GetTransient() (map[string][]byte, error) {
+	return stub.transient, nil
+}
+
+func (stub *Stub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	if stub.TxID == "" {
+		return nil, errors.New("No transaction in progress")
+	}
+
+	return toTimestamp(stub.now), nil
+}
+
+func toTimestamp(t time.Time) *timestamp.Timestamp {
+	return &timestamp.Timestamp{Seconds: t.Unix(), Nanos: int32(t.Nanosecond())}
+}
+
+// GetState returns the committed value of key. As on a peer, the writes of
+// the transaction in progress are not visible to its own reads.
+func (stub *Stub) GetState(key string) ([]byte, error) {
+	stub.recordRead(key)
+
+	return stub.committedValue(key), nil
+}
+
+// GetStateByRange returns the simple keys of a range. As on a peer, an empty
+// startKey starts after the composite keys, and an empty endKey leaves the
+// range open.
+func (stub *Stub) GetStateByRange(startKey string, endKey string) (shim.StateQueryIteratorInterface, error) {
+	for _, key := range []string{startKey, endKey} {
+		if strings.HasPrefix(key, compositeKeyNamespace) {
+			return nil, fmt.Errorf("first character of the key [%s] contains a null character which is not allowed", key)
+		}
+	}
+
+	if startKey == "" {
+		startKey = emptyKeySubstitute
+	}
+
+	return stub.rangeIterator(startKey, endKey), nil
+}
+
+func (stub *Stub) GetStateByPartialCompositeKey(objectType string, attributes []string) (shim.StateQueryIteratorInterface, error) {
+	startKey, err := stub.CreateCompositeKey(objectType, attributes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return stub.rangeIterator(startKey, startKey+string(utf8.MaxRune)), nil
+}
+
+func (stub *Stub) PutState(key string, value []byte) error {
+	if stub.TxID == "" {
+		return errors.New("No transaction in progress")
+	}
+
+	stub.recordWrite(key)
+	stub.setState(key, value)
+
+	return nil
+}
+
+func (stub *Stub) DelState(key string) error {
+	if stub.TxID == "" {
+		return errors.New("No transaction in progress")
+	}
+
+	stub.recordWrite(key)
+	stub.deleteState(key)
+
+	return nil
+}
+
+// SetEvent sets the event of the transaction in progress. As on a peer, only
+// the last event set by a transaction is emitted.
+func (stub *Stub) SetEvent(name string, payload []byte) error {
+	if name == "" {
+		return errors.New("Event name can not be empty")
+	}
+
+	stub.txEvent = &pb.ChaincodeEvent{ChaincodeId: stub.Name, TxId: stub.TxID, EventName: name, Payload: payload}
+
+	return nil
+}
+
+func (stub *Stub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	return &historyIterator{modifications: stub.History[key]}, nil
+}
+
+type historyIterator struct {
+	modifications []*queryresult.KeyModification
+}
+
+func (iterator *historyIterator) HasNext() bool {
+	return len(iterator.modifications) > 0
+}
+
+func (iterator *historyIterator) Next() (*queryresult.KeyModification, error) {
+	if len(iterator.modifications) == 0 {
+		return nil, errors.New("No more history")
+	}
+
+	modification := iterator.modifications[0]
+	iterator.modifications = iterator.modifications[1:]
+
+	return modification, nil
+}
+
+func (iterator *historyIterator) Close() error {
+	return nil
+}
+
+const (
+	compositeKeyNamespace = "\x00"
+	emptyKeySubstitute    = "\x01"
+)
+
+// RangeRead is a range of keys read by a transaction, as recorded in a
+// Fabric read set: the keys the chaincode iterated over, and whether it
+// iterated to the end of the range.
+type RangeRead struct {
+	StartKey  string
+	EndKey    string
+	Keys      []string
+	Exhausted bool
+}
+
+// recordRange records the keys returned by iterator as reads of the
+// transaction in progress.
+func (stub *Stub) recordRange(startKey string, endKey string, iterator shim.StateQueryIteratorInterface) shim.StateQueryIteratorInterface {
+	rangeRead := &RangeRead{StartKey: startKey, EndKey: endKey}
+
+	if stub.txReads != nil {
+		stub.txRangeReads = append(stub.txRangeReads, rangeRead)
+	}
+
+	return &rangeRecorder{iterator, stub, rangeRead}
+}
+
+type rangeRecorder struct {
+	shim.StateQueryIteratorInterface
+	stub      *Stub
+	rangeRead *RangeRead
+}
+
+func (iterator *rangeRecorder) HasNext() bool {
+	hasNext := iterator.StateQueryIteratorInterface.HasNext()
+
+	if !hasNext {
+		iterator.rangeRead.Exhausted = true
+	}
+
+	return hasNext
+}
+
+func (iterator *rangeRecorder) Next() (*queryresult.KV, error) {
+	kv, err := iterator.StateQueryIteratorInterface.Next()
+
+	if err == nil {
+		iterator.stub.recordRead(kv.Key)
+		iterator.rangeRead.Keys = append(iterator.rangeRead.Keys, kv.Key)
+	}
+
+	return kv, err
+}
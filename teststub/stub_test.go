@@ -0,0 +1,241 @@
+package teststub
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// echoChaincode reports what it sees of its transaction, writes or deletes
+// keys on request, and reads keys to update them.
+type echoChaincode struct{}
+
+func (cc *echoChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (cc *echoChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	function, args := stub.GetFunctionAndParameters()
+
+	switch function {
+	case "creator":
+		creator, _ := stub.GetCreator()
+		identity := &msp.SerializedIdentity{}
+		proto.Unmarshal(creator, identity)
+
+		return shim.Success([]byte(identity.Mspid))
+	case "transient":
+		transient, _ := stub.GetTransient()
+
+		return shim.Success(transient[args[0]])
+	case "time":
+		timestamp, err := stub.GetTxTimestamp()
+
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		return shim.Success([]byte(strconv.FormatInt(timestamp.Seconds, 10)))
+	case "put":
+		stub.PutState(args[0], []byte(args[1]))
+		stub.SetEvent("put", []byte(args[0]))
+
+		return shim.Success(nil)
+	case "del":
+		stub.DelState(args[0])
+
+		return shim.Success(nil)
+	case "append":
+		value, _ := stub.GetState(args[0])
+		stub.PutState(args[0], append(value, args[1]...))
+
+		return shim.Success(nil)
+	case "count":
+		iterator, _ := stub.GetStateByRange(args[0], args[1])
+		count := 0
+
+		for iterator.HasNext() {
+			iterator.Next()
+			count++
+		}
+
+		iterator.Close()
+		stub.PutState("count", []byte(strconv.Itoa(count)))
+
+		return shim.Success(nil)
+	case "putAndFail":
+		stub.PutState(args[0], []byte(args[1]))
+		stub.SetEvent("put", []byte(args[0]))
+
+		return shim.Error("failed")
+	}
+
+	return shim.Error("unknown function")
+}
+
+func TestCreatorPerTransaction(t *testing.T) {
+	stub := New("echo", new(echoChaincode))
+
+	stub.SetCreator("Org1MSP")
+	response := stub.Invoke("creator")
+
+	if string(response.Payload) != "Org1MSP" {
+		t.Fatalf("expected Org1MSP, got %q", response.Payload)
+	}
+
+	stub.SetCreator("Org2MSP")
+	response = stub.Invoke("creator")
+
+	if string(response.Payload) != "Org2MSP" {
+		t.Fatalf("expected Org2MSP, got %q", response.Payload)
+	}
+}
+
+func TestTransientAppliesToNextTransaction(t *testing.T) {
+	stub := New("echo", new(echoChaincode))
+
+	stub.SetTransient(map[string][]byte{"secret": []byte("s1")})
+	response := stub.Invoke("transient", "secret")
+
+	if string(response.Payload) != "s1" {
+		t.Fatalf("expected s1, got %q", response.Payload)
+	}
+
+	response = stub.Invoke("transient", "secret")
+
+	if response.Payload != nil {
+		t.Fatalf("transient data leaked into the next transaction: %q", response.Payload)
+	}
+}
+
+func TestTimestamps(t *testing.T) {
+	stub := New("echo", new(echoChaincode))
+	stub.SetTime(time.Unix(1000, 0))
+
+	response := stub.Invoke("time")
+
+	if string(response.Payload) != "1000" {
+		t.Fatalf("expected 1000, got %q", response.Payload)
+	}
+
+	stub.Advance(time.Minute)
+	response = stub.Invoke("time")
+
+	if string(response.Payload) != "1060" {
+		t.Fatalf("expected 1060, got %q", response.Payload)
+	}
+}
+
+func TestHistoryAndEvents(t *testing.T) {
+	stub := New("echo", new(echoChaincode))
+
+	stub.Invoke("put", "k", "v1")
+	stub.Invoke("put", "k", "v2")
+	stub.Invoke("del", "k")
+
+	iterator, err := stub.GetHistoryForKey("k")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var values []string
+
+	for iterator.HasNext() {
+		modification, err := iterator.Next()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if modification.IsDelete {
+			values = append(values, "<deleted>")
+		} else {
+			values = append(values, string(modification.Value))
+		}
+	}
+
+	if len(values) != 3 || values[0] != "v1" || values[1] != "v2" || values[2] != "<deleted>" {
+		t.Fatalf("unexpected history %v", values)
+	}
+
+	if len(stub.Events) != 2 || stub.Events[0].EventName != "put" || stub.Events[1].TxId != "tx2" {
+		t.Fatalf("unexpected events %v", stub.Events)
+	}
+}
+
+func TestFailedTransactionIsRolledBack(t *testing.T) {
+	stub := New("echo", new(echoChaincode))
+	stub.Seed("k", []byte("v1"))
+
+	stub.Invoke("putAndFail", "k", "v2")
+	stub.Invoke("putAndFail", "other", "v2")
+
+	if string(stub.State["k"]) != "v1" {
+		t.Fatalf("expected k to be rolled back to v1, got %q", stub.State["k"])
+	}
+
+	if _, ok := stub.State["other"]; ok || len(stub.SortedKeys()) != 1 {
+		t.Fatal("a new key written by a failed transaction was kept")
+	}
+
+	if len(stub.History["k"]) != 1 || len(stub.Events) != 0 {
+		t.Fatal("a failed transaction was recorded")
+	}
+}
+
+func TestReadsDoNotSeeOwnWrites(t *testing.T) {
+	stub := New("echo", new(echoChaincode))
+	stub.Seed("a", []byte("1"))
+	stub.Seed("b", []byte("2"))
+
+	// read returns what a transaction sees of the state: GetState of each key
+	// and the entries of a range over every key.
+	read := func(txStub shim.ChaincodeStubInterface) (values []string, entries []string) {
+		for _, key := range []string{"a", "b", "c"} {
+			value, _ := txStub.GetState(key)
+			values = append(values, string(value))
+		}
+
+		iterator, _ := txStub.GetStateByRange("", "")
+
+		for iterator.HasNext() {
+			kv, _ := iterator.Next()
+			entries = append(entries, kv.Key+"="+string(kv.Value))
+		}
+
+		iterator.Close()
+
+		return values, entries
+	}
+
+	stub.Run(nil, func(txStub shim.ChaincodeStubInterface) pb.Response {
+		txStub.PutState("a", []byte("changed"))
+		txStub.DelState("b")
+		txStub.PutState("c", []byte("3"))
+
+		values, entries := read(txStub)
+
+		if fmt.Sprint(values) != "[1 2 ]" || fmt.Sprint(entries) != "[a=1 b=2]" {
+			t.Errorf("a transaction saw its own writes: %v %v", values, entries)
+		}
+
+		return shim.Success(nil)
+	})
+
+	stub.Run(nil, func(txStub shim.ChaincodeStubInterface) pb.Response {
+		values, entries := read(txStub)
+
+		if fmt.Sprint(values) != "[changed  3]" || fmt.Sprint(entries) != "[a=changed c=3]" {
+			t.Errorf("committed writes are not visible: %v %v", values, entries)
+		}
+
+		return shim.Success(nil)
+	})
+}
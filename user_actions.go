@@ -0,0 +1,148 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// authorizeUserAction checks the signature on an action taken on behalf of
+// user. Dependents that have not come of age are acted for by one of their
+// guardians; everyone else signs with their own key. The signed message is
+// function followed by params, the signer ID and the user's current nonce.
+// On success the nonce is advanced, so the caller must store user.
+func authorizeUserAction(stub shim.ChaincodeStubInterface, userId string, user *User, function string, params []string, signerId string, signature string) error {
+	parts := append([]string{}, params...)
+	message := signedMessage(function, append(parts, signerId, strconv.Itoa(user.Nonce))...)
+
+	err := checkIdentityActive(stub, user)
+
+	if err != nil {
+		return err
+	}
+
+	if len(user.Guardians) > 0 {
+		now, err := txTime(stub)
+
+		if err != nil {
+			return err
+		}
+
+		if now >= user.MajorityAt {
+			return newError(codeFailedPrecondition, "Dependent has come of age and must be promoted")
+		}
+
+		if !containsString(user.Guardians, signerId) {
+			return newError(codeUnauthorized, "Signer is not a guardian of this user")
+		}
+
+		guardian, err := loadUser(stub, signerId)
+
+		if err != nil {
+			return err
+		}
+
+		if guardian == nil {
+			return newError(codeNotFound, "Guardian not found")
+		}
+
+		err = checkIdentityActive(stub, guardian)
+
+		if err != nil {
+			return withContext("Guardian: ", err)
+		}
+
+		err = verifySignature(guardian.PublicKey, message, signature)
+
+		if err != nil {
+			return err
+		}
+	} else {
+		if signerId != userId {
+			return newError(codeUnauthorized, "Signer must be the user")
+		}
+
+		err = verifySignature(user.PublicKey, message, signature)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	user.Nonce++
+
+	return nil
+}
+
+// rotateUserKey replaces a user's public key, signed by the user or, for a
+// dependent, by a guardian.
+func (t *IdentityChaincode) rotateUserKey(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 4 {
+		return incorrectArgumentCount()
+	}
+
+	user, err := loadUser(stub, args[0])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if user == nil {
+		return notFound("User not found")
+	}
+
+	_, err = parsePublicKey(args[1])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	err = authorizeUserAction(stub, args[0], user, "rotateUserKey", args[:2], args[2], args[3])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	user.PublicKey = args[1]
+	err = storeUser(stub, args[0], user)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(nil)
+}
+
+// setUserMetadataHash replaces a user's metadata hash, signed by the user or,
+// for a dependent, by a guardian.
+func (t *IdentityChaincode) setUserMetadataHash(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 4 {
+		return incorrectArgumentCount()
+	}
+
+	user, err := loadUser(stub, args[0])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if user == nil {
+		return notFound("User not found")
+	}
+
+	err = authorizeUserAction(stub, args[0], user, "setUserMetadataHash", args[:2], args[2], args[3])
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	user.MetadataHash = args[1]
+	err = storeUser(stub, args[0], user)
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return shim.Success(nil)
+}